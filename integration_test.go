@@ -8,8 +8,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"sort"
-	"strings"
 	"testing"
 	"time"
 
@@ -18,15 +16,15 @@ import (
 
 // TestIntegrationCommands runs a small integration flow against a real Postgres
 // database. It is skipped unless the GATOR_TEST_DB environment variable is set.
-// The test will apply schema files from the sql/schema directory and then run
-// several CLI commands (register, login, addfeed, feeds) using `go run .`.
+// The test applies the embedded migrations with `gator migrate up` and then
+// runs several CLI commands (register, login, addfeed, feeds).
 func TestIntegrationCommands(t *testing.T) {
 	dbURL := os.Getenv("GATOR_TEST_DB")
 	if dbURL == "" {
 		t.Skip("skipping integration test; set GATOR_TEST_DB to run")
 	}
 
-	// connect and apply schema
+	// connect
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		t.Fatalf("open db: %v", err)
@@ -38,52 +36,6 @@ func TestIntegrationCommands(t *testing.T) {
 		t.Fatalf("reset db schema: %v", err)
 	}
 
-	// run schema files
-	root, err := os.Getwd()
-	if err != nil {
-		t.Fatalf("getwd: %v", err)
-	}
-	schemaDir := filepath.Join(root, "sql", "schema")
-	files, err := ioutil.ReadDir(schemaDir)
-	if err != nil {
-		t.Fatalf("read schema dir: %v", err)
-	}
-	// ensure schema files are applied in name order (001_..., 002_...)
-	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
-	for _, f := range files {
-		if f.IsDir() {
-			continue
-		}
-		raw, err := ioutil.ReadFile(filepath.Join(schemaDir, f.Name()))
-		if err != nil {
-			t.Fatalf("read schema file: %v", err)
-		}
-		content := string(raw)
-		// if file contains goose markers, extract the Up block only
-		if strings.Contains(content, "-- +goose Up") {
-			upIdx := strings.Index(content, "-- +goose Up")
-			downIdx := strings.Index(content, "-- +goose Down")
-			if upIdx >= 0 && downIdx > upIdx {
-				// extract between the markers
-				content = content[upIdx+len("-- +goose Up") : downIdx]
-			}
-		}
-		if _, err := db.Exec(content); err != nil {
-			t.Fatalf("apply %s: %v", f.Name(), err)
-		}
-		// quick sanity check: if we just applied users migration, ensure table exists
-		if strings.Contains(f.Name(), "001_users") {
-			var tbl sql.NullString
-			err := db.QueryRow("SELECT to_regclass('public.users')").Scan(&tbl)
-			if err != nil {
-				t.Fatalf("verify users table query failed: %v", err)
-			}
-			if !tbl.Valid {
-				t.Fatalf("users table not found after applying %s", f.Name())
-			}
-		}
-	}
-
 	// Prepare a clean HOME with config file pointing to our DB
 	home := t.TempDir()
 	cfg := map[string]string{"db_url": dbURL}
@@ -112,8 +64,31 @@ func TestIntegrationCommands(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
 
+	// commands are refused until the schema is migrated
+	out, err := run(ctx, "users")
+	if err == nil || !contains(out, "migrate up") {
+		t.Fatalf("expected users to be refused on an empty database, got err=%v\nout: %s", err, out)
+	}
+
+	// apply the embedded migrations
+	out, err = run(ctx, "migrate", "up")
+	if err != nil {
+		t.Fatalf("migrate up failed: %v\nout: %s", err, out)
+	}
+	var tbl sql.NullString
+	if err := db.QueryRow("SELECT to_regclass('public.users')").Scan(&tbl); err != nil {
+		t.Fatalf("verify users table query failed: %v", err)
+	}
+	if !tbl.Valid {
+		t.Fatalf("users table not found after migrate up\nout: %s", out)
+	}
+	out, err = run(ctx, "migrate", "status")
+	if err != nil || contains(out, "pending") {
+		t.Fatalf("expected no pending migrations, got err=%v\nout: %s", err, out)
+	}
+
 	// register user
-	out, err := run(ctx, "register", "itestuser")
+	out, err = run(ctx, "register", "itestuser")
 	if err != nil {
 		t.Fatalf("register failed: %v\nout: %s", err, out)
 	}
@@ -0,0 +1,639 @@
+// Package api serves gator's users, feeds, follows and posts as a JSON API
+// over HTTP. Requests authenticate with a per-user bearer token (see
+// NewToken). The Fever API for mobile readers is served under /fever.
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/feed"
+	"github.com/markcromwell/gator/internal/fever"
+	"github.com/markcromwell/gator/internal/publish"
+	"github.com/markcromwell/gator/internal/scraper"
+)
+
+// Server answers API requests from the database.
+type Server struct {
+	DB *database.Queries
+	// Pool runs the scrapes triggered through the API; the scrape
+	// endpoints answer 503 when it is nil.
+	Pool *scraper.Pool
+	// Out receives errors; os.Stdout when nil.
+	Out io.Writer
+
+	// ctx bounds background scrapes; set by Run.
+	ctx      context.Context
+	scraping atomic.Bool
+	wg       sync.WaitGroup
+}
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+	// maxTimelineLimit caps the posts in a published timeline.
+	maxTimelineLimit = 500
+)
+
+// Handler returns the API routes.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/me", s.authed(s.getMe))
+	mux.HandleFunc("GET /api/users", s.authed(s.listUsers))
+	mux.HandleFunc("GET /api/feeds", s.authed(s.listFeeds))
+	mux.HandleFunc("POST /api/feeds", s.authed(s.createFeed))
+	mux.HandleFunc("POST /api/feeds/{id}/scrape", s.authed(s.scrapeFeed))
+	mux.HandleFunc("GET /api/follows", s.authed(s.listFollows))
+	mux.HandleFunc("POST /api/follows", s.authed(s.createFollow))
+	mux.HandleFunc("DELETE /api/follows/{feedID}", s.authed(s.deleteFollow))
+	mux.HandleFunc("GET /api/posts", s.authed(s.listPosts))
+	mux.HandleFunc("POST /api/scrape", s.authed(s.triggerScrape))
+	mux.HandleFunc("GET /api/timeline/{format}", s.feedAuthed(s.publishTimeline))
+
+	// Fever clients authenticate with their own API key, not a bearer token.
+	fh := &fever.Handler{DB: s.DB, Out: s.Out}
+	mux.Handle("/fever", fh)
+	mux.Handle("/fever/", fh)
+	return mux
+}
+
+// Run serves the API on addr until ctx is cancelled, then shuts down,
+// waiting for requests and triggered scrapes to finish.
+func (s *Server) Run(ctx context.Context, addr string) error {
+	s.ctx = ctx
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	s.Wait()
+	return err
+}
+
+// Wait blocks until the scrapes started through the API have finished.
+func (s *Server) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Server) out() io.Writer {
+	if s.Out == nil {
+		return os.Stdout
+	}
+	return s.Out
+}
+
+// authed wraps handlers that need the user owning the request's bearer
+// token.
+func (s *Server) authed(handler func(w http.ResponseWriter, r *http.Request, user database.User)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gator"`)
+			writeError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+		user, err := s.DB.GetUserByAPIToken(r.Context(), HashToken(token))
+		if errors.Is(err, sql.ErrNoRows) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gator", error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		if err != nil {
+			s.internalError(w, r, err)
+			return
+		}
+		handler(w, r, user)
+	}
+}
+
+// feedAuthed is authed for feed URLs. Feed readers cannot always send
+// headers, so the token may also be given as the token query parameter.
+func (s *Server) feedAuthed(handler func(w http.ResponseWriter, r *http.Request, user database.User)) http.HandlerFunc {
+	inner := s.authed(handler)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("token"); token != "" && r.Header.Get("Authorization") == "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		inner(w, r)
+	}
+}
+
+type userJSON struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toUser(u database.User) userJSON {
+	return userJSON{ID: u.ID, Name: u.Name, CreatedAt: u.CreatedAt}
+}
+
+type feedJSON struct {
+	ID            uuid.UUID  `json:"id"`
+	Name          string     `json:"name"`
+	URL           string     `json:"url"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastFetchedAt *time.Time `json:"last_fetched_at"`
+	Disabled      bool       `json:"disabled"`
+}
+
+func toFeed(f database.Feed) feedJSON {
+	return feedJSON{
+		ID:            f.ID,
+		Name:          f.Name,
+		URL:           f.Url,
+		CreatedAt:     f.CreatedAt,
+		LastFetchedAt: nullTime(f.LastFetchedAt),
+		Disabled:      f.DisabledAt.Valid,
+	}
+}
+
+type followJSON struct {
+	FeedID    uuid.UUID `json:"feed_id"`
+	FeedName  string    `json:"feed_name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type postJSON struct {
+	ID          uuid.UUID `json:"id"`
+	FeedID      uuid.UUID `json:"feed_id"`
+	FeedName    string    `json:"feed_name"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Description string    `json:"description,omitempty"`
+	Author      string    `json:"author,omitempty"`
+	Categories  []string  `json:"categories"`
+	PublishedAt time.Time `json:"published_at"`
+	Read        bool      `json:"read"`
+	Highlighted bool      `json:"highlighted"`
+}
+
+type statsJSON struct {
+	New       int `json:"new"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Failed    int `json:"failed"`
+}
+
+func (s *Server) getMe(w http.ResponseWriter, r *http.Request, user database.User) {
+	writeJSON(w, http.StatusOK, toUser(user))
+}
+
+// listUsers answers with the caller alone: other users are not visible to
+// a token holder.
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request, user database.User) {
+	writeJSON(w, http.StatusOK, map[string]any{"users": []userJSON{toUser(user)}})
+}
+
+// listFeeds pages through the feeds the caller follows.
+func (s *Server) listFeeds(w http.ResponseWriter, r *http.Request, user database.User) {
+	limit, page, ok := paging(w, r)
+	if !ok {
+		return
+	}
+	feeds, err := s.DB.GetFollowedFeeds(r.Context(), database.GetFollowedFeedsParams{
+		UserID: user.ID,
+		Limit:  int32(limit),
+		Offset: int32((page - 1) * limit),
+	})
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	out := make([]feedJSON, 0, len(feeds))
+	for _, f := range feeds {
+		out = append(out, toFeed(f))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"feeds": out, "page": page, "limit": limit})
+}
+
+// createFeed adds a feed and follows it, like the addfeed command.
+func (s *Server) createFeed(w http.ResponseWriter, r *http.Request, user database.User) {
+	var body struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if _, err := url.ParseRequestURI(body.URL); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid url %q", body.URL))
+		return
+	}
+
+	const exists = "feed already exists; follow it instead"
+	ctx := r.Context()
+	if _, err := s.DB.GetFeedByURL(ctx, body.URL); err == nil {
+		writeError(w, http.StatusConflict, exists)
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		s.internalError(w, r, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	f, err := s.DB.CreateFeeds(ctx, database.CreateFeedsParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Name:      body.Name,
+		Url:       body.URL,
+		UserID:    user.ID,
+	})
+	// another request may have added the same URL since the check above
+	if isUniqueViolation(err) {
+		writeError(w, http.StatusConflict, exists)
+		return
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	if _, err := s.DB.UpsertFeedFollow(ctx, database.UpsertFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    user.ID,
+		FeedID:    f.ID,
+	}); err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toFeed(f))
+}
+
+// isUniqueViolation reports whether err is Postgres refusing a duplicate
+// key.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation"
+}
+
+// scrapeFeed fetches one of the caller's followed feeds now and reports
+// what was stored. The feed is claimed like any scrape, so it is refused
+// while another scraper is fetching it.
+func (s *Server) scrapeFeed(w http.ResponseWriter, r *http.Request, user database.User) {
+	if s.Pool == nil {
+		writeError(w, http.StatusServiceUnavailable, "scraping is not enabled")
+		return
+	}
+	feedID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid feed id")
+		return
+	}
+	f, err := s.DB.GetFollowedFeedByID(r.Context(), database.GetFollowedFeedByIDParams{UserID: user.ID, ID: feedID})
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "no such feed among your follows")
+		return
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	if f.DisabledAt.Valid {
+		writeError(w, http.StatusConflict, "feed is disabled; enable it first")
+		return
+	}
+
+	stats, err := s.Pool.ScrapeNow(r.Context(), f)
+	out := statsJSON{New: stats.New, Updated: stats.Updated, Unchanged: stats.Unchanged, Failed: stats.Failed}
+	var fetchErr *scraper.FetchError
+	switch {
+	case errors.Is(err, scraper.ErrFeedBusy):
+		writeError(w, http.StatusConflict, "feed is being scraped; try again later")
+	case errors.As(err, &fetchErr):
+		writeJSON(w, http.StatusBadGateway, map[string]any{"error": err.Error(), "stats": out})
+	case err != nil:
+		s.internalError(w, r, err)
+	default:
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+func (s *Server) listFollows(w http.ResponseWriter, r *http.Request, user database.User) {
+	limit, page, ok := paging(w, r)
+	if !ok {
+		return
+	}
+	follows, err := s.DB.GetFeedFollowsByUserID(r.Context(), database.GetFeedFollowsByUserIDParams{
+		UserID: user.ID,
+		Limit:  int32(limit),
+		Offset: int32((page - 1) * limit),
+	})
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	out := make([]followJSON, 0, len(follows))
+	for _, ff := range follows {
+		out = append(out, followJSON{FeedID: ff.FeedID, FeedName: ff.FeedName, CreatedAt: ff.CreatedAt})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"follows": out, "page": page, "limit": limit})
+}
+
+// createFollow follows an existing feed by URL. Following a feed twice is
+// not an error; the answer is 200 instead of 201.
+func (s *Server) createFollow(w http.ResponseWriter, r *http.Request, user database.User) {
+	var body struct {
+		URL    string `json:"url"`
+		Folder string `json:"folder"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	ctx := r.Context()
+	f, err := s.DB.GetFeedByURL(ctx, body.URL)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "no such feed; add it first")
+		return
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	follow, err := s.DB.UpsertFeedFollow(ctx, database.UpsertFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    user.ID,
+		FeedID:    f.ID,
+		Folder:    sql.NullString{String: body.Folder, Valid: body.Folder != ""},
+	})
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	status := http.StatusOK
+	if follow.Inserted {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, followJSON{FeedID: f.ID, FeedName: f.Name, CreatedAt: now})
+}
+
+func (s *Server) deleteFollow(w http.ResponseWriter, r *http.Request, user database.User) {
+	feedID, err := uuid.Parse(r.PathValue("feedID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid feed id")
+		return
+	}
+	if err := s.DB.DeleteFeedFollowByUserIDAndFeedID(r.Context(), database.DeleteFeedFollowByUserIDAndFeedIDParams{
+		FeedID: feedID,
+		UserID: user.ID,
+	}); err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listPosts pages through the posts of the user's followed feeds, like the
+// browse command. Query parameters: limit, page, feed (name or URL), since
+// (a date) and all (include read and muted posts).
+func (s *Server) listPosts(w http.ResponseWriter, r *http.Request, user database.User) {
+	limit, page, ok := paging(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	params := database.GetPostsForUserParams{
+		UserID: user.ID,
+		Feed:   sql.NullString{String: q.Get("feed"), Valid: q.Get("feed") != ""},
+		Limit:  int32(limit),
+		Offset: int32((page - 1) * limit),
+	}
+	if v := q.Get("all"); v != "" {
+		all, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid all parameter")
+			return
+		}
+		params.IncludeAll = all
+	}
+	if v := q.Get("since"); v != "" {
+		since, err := feed.ParseFeedDate(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid since date %q", v))
+			return
+		}
+		params.Since = sql.NullTime{Time: since.UTC(), Valid: true}
+	}
+
+	posts, err := s.DB.GetPostsForUser(r.Context(), params)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	out := make([]postJSON, 0, len(posts))
+	for _, p := range posts {
+		categories := p.Categories
+		if categories == nil {
+			categories = []string{}
+		}
+		out = append(out, postJSON{
+			ID:          p.ID,
+			FeedID:      p.FeedID,
+			FeedName:    p.FeedName,
+			Title:       p.Title,
+			URL:         p.Url,
+			Description: p.Description.String,
+			Author:      p.Author.String,
+			Categories:  categories,
+			PublishedAt: p.PublishedAt,
+			Read:        p.Read,
+			Highlighted: p.Highlighted,
+		})
+	}
+	resp := map[string]any{"posts": out, "page": page, "limit": limit}
+	if len(posts) == limit {
+		resp["next_page"] = page + 1
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// triggerScrape starts a scrape of every due feed in the background. Only
+// one runs at a time.
+func (s *Server) triggerScrape(w http.ResponseWriter, r *http.Request, user database.User) {
+	if s.Pool == nil {
+		writeError(w, http.StatusServiceUnavailable, "scraping is not enabled")
+		return
+	}
+	if !s.scraping.CompareAndSwap(false, true) {
+		writeError(w, http.StatusConflict, "a scrape is already running")
+		return
+	}
+
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.scraping.Store(false)
+		if err := s.Pool.RunOnce(ctx); err != nil {
+			fmt.Fprintln(s.out(), "Error scraping feeds:", err)
+		}
+	}()
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
+}
+
+// publishTimeline renders the user's timeline as an Atom or RSS feed. Query
+// parameters: folder, feed, only (highlighted, starred or unread) and limit.
+// The feed carries an ETag and Last-Modified, and conditional requests are
+// answered with 304 Not Modified.
+func (s *Server) publishTimeline(w http.ResponseWriter, r *http.Request, user database.User) {
+	format := r.PathValue("format")
+	if format != publish.Atom && format != publish.RSS {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown format %q", format))
+		return
+	}
+	q := r.URL.Query()
+	opts := publish.Options{
+		Folder:  q.Get("folder"),
+		Feed:    q.Get("feed"),
+		Only:    q.Get("only"),
+		SelfURL: selfURL(r),
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTimelineLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxTimelineLimit))
+			return
+		}
+		opts.Limit = n
+	}
+	if err := opts.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	t, err := publish.Build(r.Context(), s.DB, user, opts)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := publish.Write(&buf, format, t); err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	w.Header().Set("Content-Type", publish.ContentType(format))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	http.ServeContent(w, r, "", t.Updated, bytes.NewReader(buf.Bytes()))
+}
+
+// selfURL is the URL r was made to, without the token parameter, so the
+// published feed does not give the token away.
+func selfURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	q := r.URL.Query()
+	q.Del("token")
+	u := url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// paging reads the limit and page query parameters, answering 400 when they
+// are invalid.
+func paging(w http.ResponseWriter, r *http.Request) (limit, page int, ok bool) {
+	limit, page = defaultLimit, 1
+	q := r.URL.Query()
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxLimit))
+			return 0, 0, false
+		}
+		limit = n
+	}
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "page must be 1 or more")
+			return 0, 0, false
+		}
+		page = n
+	}
+	return limit, page, true
+}
+
+// readJSON decodes the request body into v, answering 400 when it is not
+// valid JSON.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// internalError reports err to Out and answers 500 without the details,
+// which may come from the database.
+func (s *Server) internalError(w http.ResponseWriter, r *http.Request, err error) {
+	fmt.Fprintf(s.out(), "Error serving %s %s: %v\n", r.Method, r.URL.Path, err)
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,380 @@
+package api_test
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/markcromwell/gator/internal/api"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/scraper"
+)
+
+const testToken = "secret-token"
+
+var feedColumns = []string{"id", "created_at", "last_fetched_at", "updated_at", "name", "url", "user_id", "etag", "last_modified", "claimed_until", "claimed_by", "fetch_interval_seconds", "next_fetch_at", "consecutive_failures", "last_error", "last_status", "last_success_at", "disabled_at", "retention_days", "retention_max_posts", "seq"}
+
+var postColumns = []string{"id", "created_at", "updated_at", "title", "url", "description", "published_at", "feed_id", "guid", "search_vector", "author", "categories", "seq", "feed_name", "read", "highlighted"}
+
+func newServer(t *testing.T) (*api.Server, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	q := database.New(db)
+	return &api.Server{DB: q, Pool: &scraper.Pool{Scraper: &scraper.Scraper{DB: q, Out: io.Discard}, Workers: 1}, Out: io.Discard}, mock
+}
+
+// expectAuth expects the token lookup for testToken.
+func expectAuth(mock sqlmock.Sqlmock, userID uuid.UUID) {
+	mock.ExpectQuery(`(?i)UPDATE api_tokens`).
+		WithArgs(api.HashToken(testToken)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "name"}).
+			AddRow(userID, time.Now(), time.Now(), "bob"))
+}
+
+func do(t *testing.T, s *api.Server, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuth(t *testing.T) {
+	s, mock := newServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("no token: status = %d, want 401", rec.Code)
+	}
+
+	mock.ExpectQuery(`(?i)UPDATE api_tokens`).
+		WithArgs(api.HashToken(testToken)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "name"}))
+	if rec := do(t, s, http.MethodGet, "/api/me", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unknown token: status = %d, want 401", rec.Code)
+	}
+
+	userID := uuid.New()
+	expectAuth(mock, userID)
+	rec = do(t, s, http.MethodGet, "/api/me", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var me struct {
+		ID   uuid.UUID `json:"id"`
+		Name string    `json:"name"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &me); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if me.ID != userID || me.Name != "bob" {
+		t.Errorf("unexpected user %+v", me)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestInternalErrorHidesDetails(t *testing.T) {
+	s, mock := newServer(t)
+	var out bytes.Buffer
+	s.Out = &out
+
+	expectAuth(mock, uuid.New())
+	mock.ExpectQuery(`(?i)SELECT .+ FROM posts p\s+JOIN feed_follows`).
+		WillReturnError(errors.New(`pq: relation "posts" does not exist`))
+
+	rec := do(t, s, http.MethodGet, "/api/posts", "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "relation") || !strings.Contains(body, `"internal error"`) {
+		t.Errorf("unexpected body %s", body)
+	}
+	if !strings.Contains(out.String(), `GET /api/posts: pq: relation "posts" does not exist`) {
+		t.Errorf("error not logged: %q", out.String())
+	}
+}
+
+func TestListPosts_Paging(t *testing.T) {
+	s, mock := newServer(t)
+	userID, feedID := uuid.New(), uuid.New()
+	now := time.Now()
+
+	expectAuth(mock, userID)
+	mock.ExpectQuery(`(?i)SELECT .+ FROM posts p\s+JOIN feed_follows`).
+		WithArgs(userID, true, "Example", sqlmock.AnyArg(), int32(2), int32(2)).
+		WillReturnRows(sqlmock.NewRows(postColumns).
+			AddRow(uuid.New(), now, now, "First", "https://example.com/1", nil, now, feedID, "g1", nil, nil, "{go}", int64(3), "Example", false, true).
+			AddRow(uuid.New(), now, now, "Second", "https://example.com/2", "body", now, feedID, "g2", nil, "alice", "{}", int64(4), "Example", true, false))
+
+	rec := do(t, s, http.MethodGet, "/api/posts?limit=2&page=2&feed=Example&all=true&since=2024-01-01", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Posts []struct {
+			Title       string   `json:"title"`
+			Categories  []string `json:"categories"`
+			Read        bool     `json:"read"`
+			Highlighted bool     `json:"highlighted"`
+		} `json:"posts"`
+		Page     int `json:"page"`
+		NextPage int `json:"next_page"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Posts) != 2 || resp.Page != 2 || resp.NextPage != 3 {
+		t.Fatalf("unexpected response %s", rec.Body)
+	}
+	if p := resp.Posts[0]; p.Title != "First" || !p.Highlighted || len(p.Categories) != 1 {
+		t.Errorf("unexpected first post %+v", p)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+
+	for _, target := range []string{"/api/posts?limit=0", "/api/posts?limit=101", "/api/posts?page=x", "/api/posts?since=soon"} {
+		expectAuth(mock, userID)
+		if rec := do(t, s, http.MethodGet, target, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", target, rec.Code)
+		}
+	}
+}
+
+func TestListUsersAndFeeds_OnlyCaller(t *testing.T) {
+	s, mock := newServer(t)
+	userID, feedID := uuid.New(), uuid.New()
+	now := time.Now()
+
+	// no query: the caller is the only user listed
+	expectAuth(mock, userID)
+	rec := do(t, s, http.MethodGet, "/api/users", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), userID.String()) || strings.Count(rec.Body.String(), `"id"`) != 1 {
+		t.Errorf("users: status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	expectAuth(mock, userID)
+	mock.ExpectQuery(`(?i)FROM feeds f\s+JOIN feed_follows ff`).
+		WithArgs(userID, int32(20), int32(0)).
+		WillReturnRows(sqlmock.NewRows(feedColumns).
+			AddRow(feedID, now, nil, now, "Example", "https://example.com/feed", uuid.New(), nil, nil, nil, nil, 3600, nil, 0, nil, nil, nil, nil, nil, nil, int64(1)))
+	rec = do(t, s, http.MethodGet, "/api/feeds", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), feedID.String()) {
+		t.Errorf("feeds: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCreateFeed_Conflict(t *testing.T) {
+	s, mock := newServer(t)
+	userID := uuid.New()
+	body := `{"name": "Example", "url": "https://example.com/feed"}`
+
+	// another request added the feed between the check and the insert
+	expectAuth(mock, userID)
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds\s+where url`).
+		WithArgs("https://example.com/feed").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`(?i)INSERT INTO feeds`).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "feeds_url_key"})
+
+	rec := do(t, s, http.MethodPost, "/api/feeds", body)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "follow it instead") {
+		t.Errorf("status = %d, want 409: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCreateFollow(t *testing.T) {
+	s, mock := newServer(t)
+	userID, feedID := uuid.New(), uuid.New()
+	now := time.Now()
+
+	feedRow := []driver.Value{feedID, now, nil, now, "Example", "https://example.com/feed", uuid.New(), nil, nil, nil, nil, 3600, nil, 0, nil, nil, nil, nil, nil, nil, int64(1)}
+
+	expectAuth(mock, userID)
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds\s+where url`).
+		WithArgs("https://example.com/feed").
+		WillReturnRows(sqlmock.NewRows(feedColumns).AddRow(feedRow...))
+	mock.ExpectQuery(`(?i)INSERT INTO feed_follows`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), userID, feedID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "inserted"}).AddRow(uuid.New(), true))
+
+	rec := do(t, s, http.MethodPost, "/api/follows", `{"url": "https://example.com/feed", "folder": "Tech"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), `"feed_name":"Example"`) {
+		t.Errorf("unexpected body %s", rec.Body)
+	}
+
+	expectAuth(mock, userID)
+	if rec := do(t, s, http.MethodPost, "/api/follows", `{"link": "x"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown field: status = %d, want 400", rec.Code)
+	}
+
+	expectAuth(mock, userID)
+	mock.ExpectExec(`(?i)DELETE FROM feed_follows`).
+		WithArgs(feedID, userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if rec := do(t, s, http.MethodDelete, "/api/follows/"+feedID.String(), ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete: status = %d, want 204", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestScrapeFeed(t *testing.T) {
+	feedSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<rss version="2.0"><channel><title>Example</title></channel></rss>`)
+	}))
+	defer feedSrv.Close()
+
+	s, mock := newServer(t)
+	userID, feedID := uuid.New(), uuid.New()
+	now := time.Now()
+	feedRow := func(disabled any) *sqlmock.Rows {
+		return sqlmock.NewRows(feedColumns).
+			AddRow(feedID, now, nil, now, "Example", feedSrv.URL, uuid.New(), nil, nil, nil, nil, 3600, nil, 0, nil, nil, nil, disabled, nil, nil, int64(1))
+	}
+	expectFeed := func(rows *sqlmock.Rows) {
+		expectAuth(mock, userID)
+		mock.ExpectQuery(`(?i)FROM feeds f\s+JOIN feed_follows ff .+ f.id = \$2`).
+			WithArgs(userID, feedID).
+			WillReturnRows(rows)
+	}
+	target := "/api/feeds/" + feedID.String() + "/scrape"
+
+	// claimed, fetched and released like a pool worker's fetch
+	expectFeed(feedRow(nil))
+	mock.ExpectQuery(`(?i)UPDATE feeds\s+SET claimed_until .+WHERE id = \$3`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), feedID).
+		WillReturnRows(feedRow(nil))
+	mock.ExpectExec(`UPDATE feeds\s+SET etag`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE feeds\s+SET last_fetched_at`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE feeds\s+SET consecutive_failures = 0`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE feeds\s+SET fetch_interval_seconds`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`WHERE claimed_by = \$1`).WillReturnResult(sqlmock.NewResult(0, 0))
+	if rec := do(t, s, http.MethodPost, target, ""); rec.Code != http.StatusOK {
+		t.Errorf("scrape: status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	// another scraper holds the feed
+	expectFeed(feedRow(nil))
+	mock.ExpectQuery(`(?i)UPDATE feeds\s+SET claimed_until .+WHERE id = \$3`).
+		WillReturnRows(sqlmock.NewRows(feedColumns))
+	if rec := do(t, s, http.MethodPost, target, ""); rec.Code != http.StatusConflict {
+		t.Errorf("busy: status = %d, want 409", rec.Code)
+	}
+
+	// disabled feeds are not fetched
+	expectFeed(feedRow(now))
+	if rec := do(t, s, http.MethodPost, target, ""); rec.Code != http.StatusConflict {
+		t.Errorf("disabled: status = %d, want 409", rec.Code)
+	}
+
+	// nor feeds the caller does not follow
+	expectFeed(sqlmock.NewRows(feedColumns))
+	if rec := do(t, s, http.MethodPost, target, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("not followed: status = %d, want 404", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestTriggerScrape(t *testing.T) {
+	s, mock := newServer(t)
+	userID := uuid.New()
+	mock.MatchExpectationsInOrder(false)
+
+	expectAuth(mock, userID)
+	expectAuth(mock, userID)
+	mock.ExpectQuery(`UPDATE feeds\s+SET claimed_until = NOW`).
+		WillDelayFor(100 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows(feedColumns))
+	mock.ExpectExec(`WHERE claimed_by = \$1`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if rec := do(t, s, http.MethodPost, "/api/scrape", ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", rec.Code, rec.Body)
+	}
+	if rec := do(t, s, http.MethodPost, "/api/scrape", ""); rec.Code != http.StatusConflict {
+		t.Errorf("second scrape: status = %d, want 409", rec.Code)
+	}
+	s.Wait()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPublishTimeline_Caching(t *testing.T) {
+	s, mock := newServer(t)
+	userID, postID := uuid.New(), uuid.New()
+	published := time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)
+	expectTimeline := func() {
+		expectAuth(mock, userID)
+		mock.ExpectQuery(`(?i)SELECT p.id, p.title, .+FROM posts p`).
+			WithArgs(userID, sqlmock.AnyArg(), sqlmock.AnyArg(), false, false, true, int32(10)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title", "url", "description", "author", "categories", "published_at", "updated_at", "feed_name", "feed_url"}).
+				AddRow(postID, "Post", "https://example.com/1", nil, nil, "{}", published, published, "Example", "https://example.com/feed"))
+	}
+
+	// feed readers may pass the token as a query parameter
+	expectTimeline()
+	req := httptest.NewRequest(http.MethodGet, "/api/timeline/rss?only=unread&limit=10&token="+testToken, nil)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Header().Get("Last-Modified") != published.Format(http.TimeFormat) ||
+		!strings.HasPrefix(rec.Header().Get("Content-Type"), "application/rss+xml") {
+		t.Errorf("unexpected headers %v", rec.Header())
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "<title>Post</title>") || strings.Contains(body, testToken) {
+		t.Errorf("unexpected body (the token must not be published):\n%s", body)
+	}
+
+	expectTimeline()
+	req = httptest.NewRequest(http.MethodGet, "/api/timeline/rss?only=unread&limit=10&token="+testToken, nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: status = %d, want 304", rec.Code)
+	}
+
+	expectAuth(mock, userID)
+	if rec := do(t, s, http.MethodGet, "/api/timeline/json", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown format: status = %d, want 404", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -10,6 +10,36 @@ import (
 type Config struct {
 	DbURL           string `json:"db_url"`
 	CurrentUserName string `json:"current_user_name"`
+	// ScrapeWorkers is how many feeds scrapeFeeds fetches concurrently.
+	ScrapeWorkers int `json:"scrape_workers,omitempty"`
+	// HostDelay is the minimum time between two requests to the same host,
+	// as a Go duration string (e.g. "2s").
+	HostDelay string `json:"host_delay,omitempty"`
+	// ScrapeLease is how long a scraper's claim on a feed lasts before
+	// another scraper may reclaim it (Go duration string, default "10m").
+	ScrapeLease string `json:"scrape_lease,omitempty"`
+	// MinFetchInterval and MaxFetchInterval bound the adaptive polling
+	// interval of each feed (Go duration strings, default "5m" and "24h").
+	MinFetchInterval string `json:"min_fetch_interval,omitempty"`
+	MaxFetchInterval string `json:"max_fetch_interval,omitempty"`
+	// DisableAfterFailures is how many consecutive failed fetches disable a
+	// feed (default 10).
+	DisableAfterFailures int `json:"disable_after_failures,omitempty"`
+	// RetentionDays and RetentionMaxPosts are the default post retention:
+	// posts older than this many days, or beyond this many per feed, are
+	// purged. 0 (the default) means no limit. Feeds can override both.
+	RetentionDays     int `json:"retention_days,omitempty"`
+	RetentionMaxPosts int `json:"retention_max_posts,omitempty"`
+	// PurgeInterval is how often scrapeFeeds purges old posts (Go duration
+	// string); unset disables the automatic purge.
+	PurgeInterval string `json:"purge_interval,omitempty"`
+	// SMTPAddr is the "host:port" of the mail server digests are sent
+	// through, as SMTPFrom. SMTPUsername and SMTPPassword, when set, log in
+	// with PLAIN auth, which net/smtp only allows over TLS or to localhost.
+	SMTPAddr     string `json:"smtp_addr,omitempty"`
+	SMTPUsername string `json:"smtp_username,omitempty"`
+	SMTPPassword string `json:"smtp_password,omitempty"`
+	SMTPFrom     string `json:"smtp_from,omitempty"`
 }
 
 const configFileName = ".gatorconfig.json"
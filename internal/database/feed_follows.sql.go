@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,7 +17,7 @@ const createFeedFollow = `-- name: CreateFeedFollow :one
 WITH inserted AS (
     INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id)
     VALUES ($1, $2, $3, $4, $5)
-    RETURNING id, created_at, updated_at, user_id, feed_id
+    RETURNING id, created_at, updated_at, user_id, feed_id, folder
 )
 SELECT 
     inserted.id,
@@ -170,3 +171,224 @@ func (q *Queries) GetFeedFollowsByUserID(ctx context.Context, arg GetFeedFollows
 	}
 	return items, nil
 }
+
+const getFollowedFeedByID = `-- name: GetFollowedFeedByID :one
+SELECT f.id, f.created_at, f.last_fetched_at, f.updated_at, f.name, f.url, f.user_id, f.etag, f.last_modified, f.claimed_until, f.claimed_by, f.fetch_interval_seconds, f.next_fetch_at, f.consecutive_failures, f.last_error, f.last_status, f.last_success_at, f.disabled_at, f.retention_days, f.retention_max_posts, f.seq
+FROM feeds f
+JOIN feed_follows ff ON ff.feed_id = f.id
+WHERE ff.user_id = $1 AND f.id = $2
+`
+
+type GetFollowedFeedByIDParams struct {
+	UserID uuid.UUID
+	ID     uuid.UUID
+}
+
+// the feed with this ID when the user follows it
+func (q *Queries) GetFollowedFeedByID(ctx context.Context, arg GetFollowedFeedByIDParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFollowedFeedByID, arg.UserID, arg.ID)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.LastFetchedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.Etag,
+		&i.LastModified,
+		&i.ClaimedUntil,
+		&i.ClaimedBy,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastStatus,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.RetentionDays,
+		&i.RetentionMaxPosts,
+		&i.Seq,
+	)
+	return i, err
+}
+
+const getFollowedFeedByURL = `-- name: GetFollowedFeedByURL :one
+SELECT f.id, f.created_at, f.last_fetched_at, f.updated_at, f.name, f.url, f.user_id, f.etag, f.last_modified, f.claimed_until, f.claimed_by, f.fetch_interval_seconds, f.next_fetch_at, f.consecutive_failures, f.last_error, f.last_status, f.last_success_at, f.disabled_at, f.retention_days, f.retention_max_posts, f.seq
+FROM feeds f
+JOIN feed_follows ff ON ff.feed_id = f.id
+WHERE ff.user_id = $1 AND f.url = $2
+`
+
+type GetFollowedFeedByURLParams struct {
+	UserID uuid.UUID
+	Url    string
+}
+
+// the feed with this URL when the user follows it
+func (q *Queries) GetFollowedFeedByURL(ctx context.Context, arg GetFollowedFeedByURLParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFollowedFeedByURL, arg.UserID, arg.Url)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.LastFetchedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.Etag,
+		&i.LastModified,
+		&i.ClaimedUntil,
+		&i.ClaimedBy,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastStatus,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.RetentionDays,
+		&i.RetentionMaxPosts,
+		&i.Seq,
+	)
+	return i, err
+}
+
+const getFollowedFeeds = `-- name: GetFollowedFeeds :many
+SELECT f.id, f.created_at, f.last_fetched_at, f.updated_at, f.name, f.url, f.user_id, f.etag, f.last_modified, f.claimed_until, f.claimed_by, f.fetch_interval_seconds, f.next_fetch_at, f.consecutive_failures, f.last_error, f.last_status, f.last_success_at, f.disabled_at, f.retention_days, f.retention_max_posts, f.seq
+FROM feeds f
+JOIN feed_follows ff ON ff.feed_id = f.id
+WHERE ff.user_id = $1
+ORDER BY f.name
+LIMIT $2 OFFSET $3
+`
+
+type GetFollowedFeedsParams struct {
+	UserID uuid.UUID
+	Limit  int32
+	Offset int32
+}
+
+// the feeds a user follows, by name
+func (q *Queries) GetFollowedFeeds(ctx context.Context, arg GetFollowedFeedsParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFollowedFeeds, arg.UserID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.LastFetchedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.Etag,
+			&i.LastModified,
+			&i.ClaimedUntil,
+			&i.ClaimedBy,
+			&i.FetchIntervalSeconds,
+			&i.NextFetchAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastStatus,
+			&i.LastSuccessAt,
+			&i.DisabledAt,
+			&i.RetentionDays,
+			&i.RetentionMaxPosts,
+			&i.Seq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFollowedFeedsForExport = `-- name: GetFollowedFeedsForExport :many
+SELECT f.name, f.url, ff.folder
+FROM feed_follows ff
+JOIN feeds f ON ff.feed_id = f.id
+WHERE ff.user_id = $1
+ORDER BY ff.folder NULLS FIRST, f.name
+`
+
+type GetFollowedFeedsForExportRow struct {
+	Name   string
+	Url    string
+	Folder sql.NullString
+}
+
+// every feed a user follows with its folder, grouped by folder
+func (q *Queries) GetFollowedFeedsForExport(ctx context.Context, userID uuid.UUID) ([]GetFollowedFeedsForExportRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFollowedFeedsForExport, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFollowedFeedsForExportRow
+	for rows.Next() {
+		var i GetFollowedFeedsForExportRow
+		if err := rows.Scan(&i.Name, &i.Url, &i.Folder); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertFeedFollow = `-- name: UpsertFeedFollow :one
+INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id, folder)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (user_id, feed_id) DO UPDATE
+SET folder = EXCLUDED.folder, updated_at = EXCLUDED.updated_at
+RETURNING id, (xmax = 0) AS inserted
+`
+
+type UpsertFeedFollowParams struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	FeedID    uuid.UUID
+	Folder    sql.NullString
+}
+
+type UpsertFeedFollowRow struct {
+	ID       uuid.UUID
+	Inserted bool
+}
+
+// follow a feed, or move an existing follow to folder; inserted is false when
+// the user already followed the feed
+func (q *Queries) UpsertFeedFollow(ctx context.Context, arg UpsertFeedFollowParams) (UpsertFeedFollowRow, error) {
+	row := q.db.QueryRowContext(ctx, upsertFeedFollow,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.UserID,
+		arg.FeedID,
+		arg.Folder,
+	)
+	var i UpsertFeedFollowRow
+	err := row.Scan(&i.ID, &i.Inserted)
+	return i, err
+}
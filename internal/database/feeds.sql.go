@@ -7,15 +7,134 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const claimFeed = `-- name: ClaimFeed :one
+UPDATE feeds
+SET claimed_until = NOW() + make_interval(secs => $1::int),
+    claimed_by = $2
+WHERE id = $3
+  AND (claimed_until IS NULL OR claimed_until < NOW())
+  AND disabled_at IS NULL
+RETURNING id, created_at, last_fetched_at, updated_at, name, url, user_id, etag, last_modified, claimed_until, claimed_by, fetch_interval_seconds, next_fetch_at, consecutive_failures, last_error, last_status, last_success_at, disabled_at, retention_days, retention_max_posts, seq
+`
+
+type ClaimFeedParams struct {
+	LeaseSeconds int32
+	ClaimedBy    sql.NullString
+	ID           uuid.UUID
+}
+
+// lease one enabled feed to a scraper, due or not, unless another scraper
+// holds it
+func (q *Queries) ClaimFeed(ctx context.Context, arg ClaimFeedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, claimFeed, arg.LeaseSeconds, arg.ClaimedBy, arg.ID)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.LastFetchedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.Etag,
+		&i.LastModified,
+		&i.ClaimedUntil,
+		&i.ClaimedBy,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastStatus,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.RetentionDays,
+		&i.RetentionMaxPosts,
+		&i.Seq,
+	)
+	return i, err
+}
+
+const claimFeedsToFetch = `-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET claimed_until = NOW() + make_interval(secs => $1::int),
+    claimed_by = $2
+WHERE id IN (
+    SELECT id
+    FROM feeds
+    WHERE (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+      AND (claimed_until IS NULL OR claimed_until < NOW())
+      AND disabled_at IS NULL
+    ORDER BY next_fetch_at ASC NULLS FIRST
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, last_fetched_at, updated_at, name, url, user_id, etag, last_modified, claimed_until, claimed_by, fetch_interval_seconds, next_fetch_at, consecutive_failures, last_error, last_status, last_success_at, disabled_at, retention_days, retention_max_posts, seq
+`
+
+type ClaimFeedsToFetchParams struct {
+	LeaseSeconds int32
+	ClaimedBy    sql.NullString
+	BatchSize    int32
+}
+
+// Atomically lease up to batch_size due feeds to one scraper. Rows locked by
+// a concurrent claim are skipped rather than waited on, and leases that have
+// expired (a crashed scraper) are claimable again.
+func (q *Queries) ClaimFeedsToFetch(ctx context.Context, arg ClaimFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimFeedsToFetch, arg.LeaseSeconds, arg.ClaimedBy, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.LastFetchedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.Etag,
+			&i.LastModified,
+			&i.ClaimedUntil,
+			&i.ClaimedBy,
+			&i.FetchIntervalSeconds,
+			&i.NextFetchAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastStatus,
+			&i.LastSuccessAt,
+			&i.DisabledAt,
+			&i.RetentionDays,
+			&i.RetentionMaxPosts,
+			&i.Seq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeeds = `-- name: CreateFeeds :one
 INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
 VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, created_at, last_fetched_at, updated_at, name, url, user_id
+RETURNING id, created_at, last_fetched_at, updated_at, name, url, user_id, etag, last_modified, claimed_until, claimed_by, fetch_interval_seconds, next_fetch_at, consecutive_failures, last_error, last_status, last_success_at, disabled_at, retention_days, retention_max_posts, seq
 `
 
 type CreateFeedsParams struct {
@@ -45,6 +164,20 @@ func (q *Queries) CreateFeeds(ctx context.Context, arg CreateFeedsParams) (Feed,
 		&i.Name,
 		&i.Url,
 		&i.UserID,
+		&i.Etag,
+		&i.LastModified,
+		&i.ClaimedUntil,
+		&i.ClaimedBy,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastStatus,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.RetentionDays,
+		&i.RetentionMaxPosts,
+		&i.Seq,
 	)
 	return i, err
 }
@@ -73,8 +206,82 @@ func (q *Queries) DeleteFeedByUserIDAndFeedID(ctx context.Context, arg DeleteFee
 	return err
 }
 
+const enableFeedByURL = `-- name: EnableFeedByURL :one
+UPDATE feeds
+SET disabled_at = NULL, consecutive_failures = 0, last_error = NULL,
+    next_fetch_at = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE url = $1
+RETURNING id, created_at, last_fetched_at, updated_at, name, url, user_id, etag, last_modified, claimed_until, claimed_by, fetch_interval_seconds, next_fetch_at, consecutive_failures, last_error, last_status, last_success_at, disabled_at, retention_days, retention_max_posts, seq
+`
+
+// re-enable a feed, clear its failure record and make it due immediately
+func (q *Queries) EnableFeedByURL(ctx context.Context, url string) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, enableFeedByURL, url)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.LastFetchedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.Etag,
+		&i.LastModified,
+		&i.ClaimedUntil,
+		&i.ClaimedBy,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastStatus,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.RetentionDays,
+		&i.RetentionMaxPosts,
+		&i.Seq,
+	)
+	return i, err
+}
+
+const getActiveFeeds = `-- name: GetActiveFeeds :many
+SELECT name, url
+FROM feeds
+WHERE disabled_at IS NULL
+ORDER BY name
+`
+
+type GetActiveFeedsRow struct {
+	Name string
+	Url  string
+}
+
+// every feed that is not disabled, by name
+func (q *Queries) GetActiveFeeds(ctx context.Context) ([]GetActiveFeedsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getActiveFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetActiveFeedsRow
+	for rows.Next() {
+		var i GetActiveFeedsRow
+		if err := rows.Scan(&i.Name, &i.Url); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getFeed = `-- name: GetFeed :many
-SELECT id, created_at, last_fetched_at, updated_at, name, url, user_id
+SELECT id, created_at, last_fetched_at, updated_at, name, url, user_id, etag, last_modified, claimed_until, claimed_by, fetch_interval_seconds, next_fetch_at, consecutive_failures, last_error, last_status, last_success_at, disabled_at, retention_days, retention_max_posts, seq
 FROM feeds
 ORDER BY created_at DESC
 LIMIT $1 OFFSET $2
@@ -102,6 +309,20 @@ func (q *Queries) GetFeed(ctx context.Context, arg GetFeedParams) ([]Feed, error
 			&i.Name,
 			&i.Url,
 			&i.UserID,
+			&i.Etag,
+			&i.LastModified,
+			&i.ClaimedUntil,
+			&i.ClaimedBy,
+			&i.FetchIntervalSeconds,
+			&i.NextFetchAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastStatus,
+			&i.LastSuccessAt,
+			&i.DisabledAt,
+			&i.RetentionDays,
+			&i.RetentionMaxPosts,
+			&i.Seq,
 		); err != nil {
 			return nil, err
 		}
@@ -117,7 +338,7 @@ func (q *Queries) GetFeed(ctx context.Context, arg GetFeedParams) ([]Feed, error
 }
 
 const getFeedByID = `-- name: GetFeedByID :one
-SELECT id, created_at, last_fetched_at, updated_at, name, url, user_id
+SELECT id, created_at, last_fetched_at, updated_at, name, url, user_id, etag, last_modified, claimed_until, claimed_by, fetch_interval_seconds, next_fetch_at, consecutive_failures, last_error, last_status, last_success_at, disabled_at, retention_days, retention_max_posts, seq
 FROM feeds
 WHERE id = $1
 `
@@ -133,12 +354,26 @@ func (q *Queries) GetFeedByID(ctx context.Context, id uuid.UUID) (Feed, error) {
 		&i.Name,
 		&i.Url,
 		&i.UserID,
+		&i.Etag,
+		&i.LastModified,
+		&i.ClaimedUntil,
+		&i.ClaimedBy,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastStatus,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.RetentionDays,
+		&i.RetentionMaxPosts,
+		&i.Seq,
 	)
 	return i, err
 }
 
 const getFeedByURL = `-- name: GetFeedByURL :one
-SELECT id, created_at, last_fetched_at, updated_at, name, url, user_id
+SELECT id, created_at, last_fetched_at, updated_at, name, url, user_id, etag, last_modified, claimed_until, claimed_by, fetch_interval_seconds, next_fetch_at, consecutive_failures, last_error, last_status, last_success_at, disabled_at, retention_days, retention_max_posts, seq
 FROM feeds
 where url = $1
 `
@@ -154,21 +389,199 @@ func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
 		&i.Name,
 		&i.Url,
 		&i.UserID,
+		&i.Etag,
+		&i.LastModified,
+		&i.ClaimedUntil,
+		&i.ClaimedBy,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastStatus,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.RetentionDays,
+		&i.RetentionMaxPosts,
+		&i.Seq,
 	)
 	return i, err
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, last_fetched_at, updated_at, name, url, user_id
+const getUnhealthyFeeds = `-- name: GetUnhealthyFeeds :many
+SELECT id, created_at, last_fetched_at, updated_at, name, url, user_id, etag, last_modified, claimed_until, claimed_by, fetch_interval_seconds, next_fetch_at, consecutive_failures, last_error, last_status, last_success_at, disabled_at, retention_days, retention_max_posts, seq
 FROM feeds
-WHERE last_fetched_at IS NULL
-	OR last_fetched_at <= NOW() - INTERVAL '10 minutes'
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1
+WHERE consecutive_failures > 0 OR disabled_at IS NOT NULL
+ORDER BY disabled_at IS NULL, consecutive_failures DESC, name
+`
+
+// feeds whose last fetch failed or that have been disabled, disabled first
+func (q *Queries) GetUnhealthyFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getUnhealthyFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.LastFetchedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.Etag,
+			&i.LastModified,
+			&i.ClaimedUntil,
+			&i.ClaimedBy,
+			&i.FetchIntervalSeconds,
+			&i.NextFetchAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastStatus,
+			&i.LastSuccessAt,
+			&i.DisabledAt,
+			&i.RetentionDays,
+			&i.RetentionMaxPosts,
+			&i.Seq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markFeedFetched = `-- name: MarkFeedFetched :exec
+UPDATE feeds
+SET last_fetched_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP,
+    next_fetch_at = CURRENT_TIMESTAMP + make_interval(secs => fetch_interval_seconds),
+    claimed_until = NULL, claimed_by = NULL
+WHERE id = $1
+`
+
+// set last_fetched_at and updated_at to current timestamp, schedule the next
+// fetch one interval from now, and release any claim
+func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, markFeedFetched, id)
+	return err
+}
+
+const recordFeedFailure = `-- name: RecordFeedFailure :one
+UPDATE feeds
+SET consecutive_failures = consecutive_failures + 1,
+    last_error = $1,
+    last_status = $2,
+    next_fetch_at = $3,
+    disabled_at = CASE
+        WHEN consecutive_failures + 1 >= $4::int THEN CURRENT_TIMESTAMP
+        ELSE disabled_at
+    END,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $5
+RETURNING consecutive_failures, disabled_at
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
+type RecordFeedFailureParams struct {
+	LastError    sql.NullString
+	LastStatus   sql.NullInt32
+	NextFetchAt  sql.NullTime
+	DisableAfter int32
+	ID           uuid.UUID
+}
+
+type RecordFeedFailureRow struct {
+	ConsecutiveFailures int32
+	DisabledAt          sql.NullTime
+}
+
+// count a failed fetch, back the feed off until next_fetch_at, and disable it
+// once it has failed disable_after times in a row
+func (q *Queries) RecordFeedFailure(ctx context.Context, arg RecordFeedFailureParams) (RecordFeedFailureRow, error) {
+	row := q.db.QueryRowContext(ctx, recordFeedFailure,
+		arg.LastError,
+		arg.LastStatus,
+		arg.NextFetchAt,
+		arg.DisableAfter,
+		arg.ID,
+	)
+	var i RecordFeedFailureRow
+	err := row.Scan(&i.ConsecutiveFailures, &i.DisabledAt)
+	return i, err
+}
+
+const recordFeedSuccess = `-- name: RecordFeedSuccess :exec
+UPDATE feeds
+SET consecutive_failures = 0, last_error = NULL, last_status = $2,
+    last_success_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type RecordFeedSuccessParams struct {
+	ID         uuid.UUID
+	LastStatus sql.NullInt32
+}
+
+// reset the failure count after a successful fetch
+func (q *Queries) RecordFeedSuccess(ctx context.Context, arg RecordFeedSuccessParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedSuccess, arg.ID, arg.LastStatus)
+	return err
+}
+
+const releaseFeedClaims = `-- name: ReleaseFeedClaims :exec
+UPDATE feeds
+SET claimed_until = NULL, claimed_by = NULL
+WHERE claimed_by = $1
+`
+
+// give back every lease a scraper still holds, e.g. on shutdown
+func (q *Queries) ReleaseFeedClaims(ctx context.Context, claimedBy sql.NullString) error {
+	_, err := q.db.ExecContext(ctx, releaseFeedClaims, claimedBy)
+	return err
+}
+
+const scheduleFeed = `-- name: ScheduleFeed :exec
+UPDATE feeds
+SET fetch_interval_seconds = $2, next_fetch_at = $3
+WHERE id = $1
+`
+
+type ScheduleFeedParams struct {
+	ID                   uuid.UUID
+	FetchIntervalSeconds int32
+	NextFetchAt          sql.NullTime
+}
+
+// store the adapted polling interval and when the feed is next due
+func (q *Queries) ScheduleFeed(ctx context.Context, arg ScheduleFeedParams) error {
+	_, err := q.db.ExecContext(ctx, scheduleFeed, arg.ID, arg.FetchIntervalSeconds, arg.NextFetchAt)
+	return err
+}
+
+const setFeedRetention = `-- name: SetFeedRetention :one
+UPDATE feeds
+SET retention_days = $2, retention_max_posts = $3, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, created_at, last_fetched_at, updated_at, name, url, user_id, etag, last_modified, claimed_until, claimed_by, fetch_interval_seconds, next_fetch_at, consecutive_failures, last_error, last_status, last_success_at, disabled_at, retention_days, retention_max_posts, seq
+`
+
+type SetFeedRetentionParams struct {
+	ID                uuid.UUID
+	RetentionDays     sql.NullInt32
+	RetentionMaxPosts sql.NullInt32
+}
+
+// override the retention policy for one feed; NULL falls back to the config
+func (q *Queries) SetFeedRetention(ctx context.Context, arg SetFeedRetentionParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, setFeedRetention, arg.ID, arg.RetentionDays, arg.RetentionMaxPosts)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -178,18 +591,38 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
 		&i.Name,
 		&i.Url,
 		&i.UserID,
+		&i.Etag,
+		&i.LastModified,
+		&i.ClaimedUntil,
+		&i.ClaimedBy,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastStatus,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.RetentionDays,
+		&i.RetentionMaxPosts,
+		&i.Seq,
 	)
 	return i, err
 }
 
-const markFeedFetched = `-- name: MarkFeedFetched :exec
+const updateFeedValidators = `-- name: UpdateFeedValidators :exec
 UPDATE feeds
-SET last_fetched_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+SET etag = $2, last_modified = $3, updated_at = CURRENT_TIMESTAMP
 WHERE id = $1
 `
 
-// set last_fetched_at and updated_at to current timestamp
-func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, markFeedFetched, id)
+type UpdateFeedValidatorsParams struct {
+	ID           uuid.UUID
+	Etag         sql.NullString
+	LastModified sql.NullString
+}
+
+// store the HTTP cache validators from the last successful fetch
+func (q *Queries) UpdateFeedValidators(ctx context.Context, arg UpdateFeedValidatorsParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedValidators, arg.ID, arg.Etag, arg.LastModified)
 	return err
 }
@@ -11,14 +11,62 @@ import (
 	"github.com/google/uuid"
 )
 
+type ApiToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	LastUsedAt sql.NullTime
+}
+
+type DigestSubscription struct {
+	UserID     uuid.UUID
+	CreatedAt  time.Time
+	Email      string
+	LastSeq    int64
+	LastSentAt sql.NullTime
+}
+
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	LastFetchedAt sql.NullTime
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	LastFetchedAt        sql.NullTime
+	UpdatedAt            time.Time
+	Name                 string
+	Url                  string
+	UserID               uuid.UUID
+	Etag                 sql.NullString
+	LastModified         sql.NullString
+	ClaimedUntil         sql.NullTime
+	ClaimedBy            sql.NullString
+	FetchIntervalSeconds int32
+	NextFetchAt          sql.NullTime
+	ConsecutiveFailures  int32
+	LastError            sql.NullString
+	LastStatus           sql.NullInt32
+	LastSuccessAt        sql.NullTime
+	DisabledAt           sql.NullTime
+	RetentionDays        sql.NullInt32
+	RetentionMaxPosts    sql.NullInt32
+	Seq                  int64
+}
+
+type FeverCredential struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ApiKey    string
+}
+
+type FilterRule struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	FeedID    uuid.NullUUID
+	Field     string
+	Pattern   string
+	IsRegex   bool
+	Action    string
 }
 
 type FeedFollow struct {
@@ -27,17 +75,40 @@ type FeedFollow struct {
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Folder    sql.NullString
 }
 
-type Post struct {
+type Notifier struct {
 	ID          uuid.UUID
 	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
+	UserID      uuid.UUID
+	Kind        string
 	Url         string
-	Description sql.NullString
-	PublishedAt time.Time
-	FeedID      uuid.UUID
+	RoomID      sql.NullString
+	AccessToken sql.NullString
+	FeedID      uuid.NullUUID
+}
+
+type Post struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Url          string
+	Description  sql.NullString
+	PublishedAt  time.Time
+	FeedID       uuid.UUID
+	Guid         string
+	SearchVector interface{}
+	Author       sql.NullString
+	Categories   []string
+	Seq          int64
+}
+
+type PurgedPost struct {
+	FeedID   uuid.UUID
+	Guid     string
+	PurgedAt time.Time
 }
 
 type User struct {
@@ -46,3 +117,36 @@ type User struct {
 	UpdatedAt time.Time
 	Name      string
 }
+
+type UserPostState struct {
+	UserID      uuid.UUID
+	PostID      uuid.UUID
+	Read        bool
+	ReadAt      sql.NullTime
+	Starred     bool
+	StarredAt   sql.NullTime
+	Note        sql.NullString
+	Muted       bool
+	Highlighted bool
+}
+
+type Webhook struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Url       string
+	Secret    sql.NullString
+	FeedID    uuid.NullUUID
+	Keyword   sql.NullString
+}
+
+type WebhookDelivery struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	WebhookID  uuid.UUID
+	PostID     uuid.UUID
+	Attempts   int32
+	StatusCode sql.NullInt32
+	Error      sql.NullString
+	Succeeded  bool
+}
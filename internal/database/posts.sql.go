@@ -11,36 +11,74 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+const getFollowedPostsForFilter = `-- name: GetFollowedPostsForFilter :many
+SELECT p.id, p.feed_id, p.title, p.description, p.author, p.categories
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = $1
 `
 
-type CreatePostParams struct {
+type GetFollowedPostsForFilterRow struct {
 	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	FeedID      uuid.UUID
 	Title       string
-	Url         string
 	Description sql.NullString
-	PublishedAt time.Time
-	FeedID      uuid.UUID
+	Author      sql.NullString
+	Categories  []string
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.ID,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Title,
-		arg.Url,
-		arg.Description,
-		arg.PublishedAt,
-		arg.FeedID,
-	)
+// every post in the user's followed feeds, with the fields filter rules
+// match on
+func (q *Queries) GetFollowedPostsForFilter(ctx context.Context, userID uuid.UUID) ([]GetFollowedPostsForFilterRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFollowedPostsForFilter, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFollowedPostsForFilterRow
+	for rows.Next() {
+		var i GetFollowedPostsForFilterRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.FeedID,
+			&i.Title,
+			&i.Description,
+			&i.Author,
+			pq.Array(&i.Categories),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostByURLForUser = `-- name: GetPostByURLForUser :one
+SELECT p.id, p.created_at, p.updated_at, p.title, p.url, p.description, p.published_at, p.feed_id, p.guid, p.search_vector, p.author, p.categories, p.seq
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = $1 AND p.url = $2
+ORDER BY p.published_at DESC
+LIMIT 1
+`
+
+type GetPostByURLForUserParams struct {
+	UserID uuid.UUID
+	Url    string
+}
+
+// the newest post with this link in a feed the user follows
+func (q *Queries) GetPostByURLForUser(ctx context.Context, arg GetPostByURLForUserParams) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPostByURLForUser, arg.UserID, arg.Url)
 	var i Post
 	err := row.Scan(
 		&i.ID,
@@ -51,34 +89,97 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.Description,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.Guid,
+		&i.SearchVector,
+		&i.Author,
+		pq.Array(&i.Categories),
+		&i.Seq,
 	)
 	return i, err
 }
 
+const getPostIDForUser = `-- name: GetPostIDForUser :one
+SELECT p.id
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = $1 AND p.id = $2
+`
+
+type GetPostIDForUserParams struct {
+	UserID uuid.UUID
+	ID     uuid.UUID
+}
+
+// the post's ID when it is in a feed the user follows
+func (q *Queries) GetPostIDForUser(ctx context.Context, arg GetPostIDForUserParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, getPostIDForUser, arg.UserID, arg.ID)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
 const getPostsForUser = `-- name: GetPostsForUser :many
-SELECT p.id, p.created_at, p.updated_at, p.title, p.url, p.description, p.published_at, p.feed_id
+SELECT p.id, p.created_at, p.updated_at, p.title, p.url, p.description, p.published_at, p.feed_id, p.guid, p.search_vector, p.author, p.categories, p.seq, f.name AS feed_name,
+    COALESCE(ups.read, FALSE)::bool AS read,
+    COALESCE(ups.highlighted, FALSE)::bool AS highlighted
 FROM posts p
-JOIN feeds f ON p.feed_id = f.id
-WHERE f.user_id = $1
+JOIN feed_follows ff ON ff.feed_id = p.feed_id AND ff.user_id = $1
+JOIN feeds f ON f.id = p.feed_id
+LEFT JOIN user_post_state ups ON ups.post_id = p.id AND ups.user_id = $1
+WHERE ($2::bool OR (ups.read IS NOT TRUE AND ups.muted IS NOT TRUE))
+  AND ($3::text IS NULL OR f.url = $3 OR f.name = $3)
+  AND ($4::timestamp IS NULL OR p.published_at >= $4)
 ORDER BY p.published_at DESC
-LIMIT $2 OFFSET $3
+LIMIT $5 OFFSET $6
 `
 
 type GetPostsForUserParams struct {
-	UserID uuid.UUID
-	Limit  int32
-	Offset int32
+	UserID     uuid.UUID
+	IncludeAll bool
+	Feed       sql.NullString
+	Since      sql.NullTime
+	Limit      int32
+	Offset     int32
 }
 
-func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]Post, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit, arg.Offset)
+type GetPostsForUserRow struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Url          string
+	Description  sql.NullString
+	PublishedAt  time.Time
+	FeedID       uuid.UUID
+	Guid         string
+	SearchVector interface{}
+	Author       sql.NullString
+	Categories   []string
+	Seq          int64
+	FeedName     string
+	Read         bool
+	Highlighted  bool
+}
+
+// newest posts first from the feeds the user follows, with the user's read
+// and highlight flags; read and muted posts are left out unless include_all
+// is set. feed (a name or URL) and since narrow the listing.
+func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForUser,
+		arg.UserID,
+		arg.IncludeAll,
+		arg.Feed,
+		arg.Since,
+		arg.Limit,
+		arg.Offset,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Post
+	var items []GetPostsForUserRow
 	for rows.Next() {
-		var i Post
+		var i GetPostsForUserRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
@@ -88,6 +189,14 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.Guid,
+			&i.SearchVector,
+			&i.Author,
+			pq.Array(&i.Categories),
+			&i.Seq,
+			&i.FeedName,
+			&i.Read,
+			&i.Highlighted,
 		); err != nil {
 			return nil, err
 		}
@@ -101,3 +210,391 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const getRecentPosts = `-- name: GetRecentPosts :many
+SELECT p.id, p.title, p.url, p.description, p.author, p.categories, p.published_at, p.updated_at,
+    f.name AS feed_name, f.url AS feed_url
+FROM posts p
+JOIN feeds f ON f.id = p.feed_id
+ORDER BY p.published_at DESC
+LIMIT $1
+`
+
+type GetRecentPostsRow struct {
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	Description sql.NullString
+	Author      sql.NullString
+	Categories  []string
+	PublishedAt time.Time
+	UpdatedAt   time.Time
+	FeedName    string
+	FeedUrl     string
+}
+
+// newest posts first from every feed, for publishing a site shared by all
+// users
+func (q *Queries) GetRecentPosts(ctx context.Context, limit int32) ([]GetRecentPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentPosts, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRecentPostsRow
+	for rows.Next() {
+		var i GetRecentPostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.Author,
+			pq.Array(&i.Categories),
+			&i.PublishedAt,
+			&i.UpdatedAt,
+			&i.FeedName,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTimelineForUser = `-- name: GetTimelineForUser :many
+SELECT p.id, p.title, p.url, p.description, p.author, p.categories, p.published_at, p.updated_at,
+    f.name AS feed_name, f.url AS feed_url
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id AND ff.user_id = $1
+JOIN feeds f ON f.id = p.feed_id
+LEFT JOIN user_post_state ups ON ups.post_id = p.id AND ups.user_id = $1
+WHERE ups.muted IS NOT TRUE
+  AND ($2::text IS NULL OR ff.folder = $2 OR ff.folder LIKE $2 || '/%')
+  AND ($3::text IS NULL OR f.url = $3 OR f.name = $3)
+  AND (NOT $4::bool OR ups.highlighted)
+  AND (NOT $5::bool OR ups.starred)
+  AND (NOT $6::bool OR ups.read IS NOT TRUE)
+ORDER BY p.published_at DESC
+LIMIT $7
+`
+
+type GetTimelineForUserParams struct {
+	UserID          uuid.UUID
+	Folder          sql.NullString
+	Feed            sql.NullString
+	HighlightedOnly bool
+	StarredOnly     bool
+	UnreadOnly      bool
+	Limit           int32
+}
+
+type GetTimelineForUserRow struct {
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	Description sql.NullString
+	Author      sql.NullString
+	Categories  []string
+	PublishedAt time.Time
+	UpdatedAt   time.Time
+	FeedName    string
+	FeedUrl     string
+}
+
+// newest unmuted posts first from the feeds the user follows, for
+// publishing. folder also matches its subfolders; feed is a name or URL;
+// the *_only flags keep just highlighted, starred or unread posts.
+func (q *Queries) GetTimelineForUser(ctx context.Context, arg GetTimelineForUserParams) ([]GetTimelineForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getTimelineForUser,
+		arg.UserID,
+		arg.Folder,
+		arg.Feed,
+		arg.HighlightedOnly,
+		arg.StarredOnly,
+		arg.UnreadOnly,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTimelineForUserRow
+	for rows.Next() {
+		var i GetTimelineForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.Author,
+			pq.Array(&i.Categories),
+			&i.PublishedAt,
+			&i.UpdatedAt,
+			&i.FeedName,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgePosts = `-- name: PurgePosts :many
+WITH policy AS (
+    SELECT f.id AS feed_id,
+        COALESCE(f.retention_days, $1::int) AS days,
+        COALESCE(f.retention_max_posts, $2::int) AS max_posts
+    FROM feeds f
+),
+ranked AS (
+    SELECT p.id, p.published_at, pol.days, pol.max_posts,
+        row_number() OVER (PARTITION BY p.feed_id ORDER BY p.published_at DESC, p.id) AS position
+    FROM posts p
+    JOIN policy pol ON pol.feed_id = p.feed_id
+    WHERE (pol.days > 0 OR pol.max_posts > 0)
+      AND NOT EXISTS (
+          SELECT 1 FROM user_post_state ups WHERE ups.post_id = p.id AND ups.starred
+      )
+),
+deleted AS (
+    DELETE FROM posts
+    WHERE id IN (
+        SELECT r.id
+        FROM ranked r
+        WHERE (r.days > 0 AND r.published_at < $3::timestamp - make_interval(days => r.days))
+           OR (r.max_posts > 0 AND r.position > r.max_posts)
+    )
+    RETURNING feed_id, guid
+),
+tombstones AS (
+    INSERT INTO purged_posts (feed_id, guid, purged_at)
+    SELECT feed_id, guid, $3::timestamp FROM deleted
+    ON CONFLICT (feed_id, guid) DO NOTHING
+)
+SELECT f.name AS feed_name, COUNT(*) AS deleted
+FROM deleted d
+JOIN feeds f ON f.id = d.feed_id
+GROUP BY f.name
+ORDER BY f.name
+`
+
+type PurgePostsParams struct {
+	DefaultDays     int32
+	DefaultMaxPosts int32
+	Now             time.Time
+}
+
+type PurgePostsRow struct {
+	FeedName string
+	Deleted  int64
+}
+
+// delete posts outside their feed's retention policy: published more than
+// days ago, or older than the newest max_posts. A feed's own settings override
+// the defaults and 0 means no limit. Starred posts are never deleted and do
+// not count toward max_posts. Each deleted post is recorded in purged_posts so
+// that UpsertPost does not store it again. Returns how many posts each feed
+// lost.
+func (q *Queries) PurgePosts(ctx context.Context, arg PurgePostsParams) ([]PurgePostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, purgePosts, arg.DefaultDays, arg.DefaultMaxPosts, arg.Now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PurgePostsRow
+	for rows.Next() {
+		var i PurgePostsRow
+		if err := rows.Scan(&i.FeedName, &i.Deleted); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchPostsForUser = `-- name: SearchPostsForUser :many
+SELECT p.id, p.title, p.url, p.published_at, f.name AS feed_name,
+    COALESCE(ups.read, FALSE)::bool AS read,
+    ts_rank(p.search_vector, q.query) AS rank
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id AND ff.user_id = $1
+JOIN feeds f ON f.id = p.feed_id
+CROSS JOIN websearch_to_tsquery('english', $2) AS q(query)
+LEFT JOIN user_post_state ups ON ups.post_id = p.id AND ups.user_id = $1
+WHERE p.search_vector @@ q.query
+  AND ($3::text IS NULL OR f.url = $3 OR f.name = $3)
+  AND ($4::timestamp IS NULL OR p.published_at >= $4)
+  AND ($5::timestamp IS NULL OR p.published_at < $5)
+ORDER BY rank DESC, p.published_at DESC
+LIMIT $6
+`
+
+type SearchPostsForUserParams struct {
+	UserID uuid.UUID
+	Query  string
+	Feed   sql.NullString
+	Since  sql.NullTime
+	Until  sql.NullTime
+	Limit  int32
+}
+
+type SearchPostsForUserRow struct {
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	PublishedAt time.Time
+	FeedName    string
+	Read        bool
+	Rank        float32
+}
+
+// rank posts in the user's followed feeds against a web-search style query
+// ("phrases", -negation, OR), optionally limited to one feed (name or URL)
+// and a published_at range
+func (q *Queries) SearchPostsForUser(ctx context.Context, arg SearchPostsForUserParams) ([]SearchPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPostsForUser,
+		arg.UserID,
+		arg.Query,
+		arg.Feed,
+		arg.Since,
+		arg.Until,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchPostsForUserRow
+	for rows.Next() {
+		var i SearchPostsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.PublishedAt,
+			&i.FeedName,
+			&i.Read,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertPost = `-- name: UpsertPost :one
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, guid, author, categories)
+SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+WHERE NOT EXISTS (
+    SELECT 1 FROM purged_posts pp WHERE pp.feed_id = $8 AND pp.guid = $9
+)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    author = EXCLUDED.author,
+    categories = EXCLUDED.categories,
+    updated_at = EXCLUDED.updated_at
+WHERE posts.title IS DISTINCT FROM EXCLUDED.title
+    OR posts.url IS DISTINCT FROM EXCLUDED.url
+    OR posts.description IS DISTINCT FROM EXCLUDED.description
+    OR posts.author IS DISTINCT FROM EXCLUDED.author
+    OR posts.categories IS DISTINCT FROM EXCLUDED.categories
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, guid, search_vector, author, categories, seq, (xmax = 0) AS inserted
+`
+
+type UpsertPostParams struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Url         string
+	Description sql.NullString
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	Author      sql.NullString
+	Categories  []string
+}
+
+type UpsertPostRow struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Url          string
+	Description  sql.NullString
+	PublishedAt  time.Time
+	FeedID       uuid.UUID
+	Guid         string
+	SearchVector interface{}
+	Author       sql.NullString
+	Categories   []string
+	Seq          int64
+	Inserted     bool
+}
+
+// Insert a new post, or refresh it when the publisher has edited the title,
+// link, description, author or categories. Returns no row when the stored
+// post is unchanged or was purged by retention.
+func (q *Queries) UpsertPost(ctx context.Context, arg UpsertPostParams) (UpsertPostRow, error) {
+	row := q.db.QueryRowContext(ctx, upsertPost,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.Title,
+		arg.Url,
+		arg.Description,
+		arg.PublishedAt,
+		arg.FeedID,
+		arg.Guid,
+		arg.Author,
+		pq.Array(arg.Categories),
+	)
+	var i UpsertPostRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.SearchVector,
+		&i.Author,
+		pq.Array(&i.Categories),
+		&i.Seq,
+		&i.Inserted,
+	)
+	return i, err
+}
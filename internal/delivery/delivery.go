@@ -0,0 +1,209 @@
+// Package delivery runs the outgoing requests of webhooks and chat
+// notifiers: in the background, one at a time per target, retrying
+// transient failures with a doubling backoff that gives way to the wait a
+// server asks for in Retry-After.
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Retry defaults, used when the Policy fields are zero.
+const (
+	DefaultAttempts = 3
+	DefaultBackoff  = time.Second
+)
+
+// MaxRetryAfter caps how long a Retry-After header may hold up a target.
+const MaxRetryAfter = 5 * time.Minute
+
+// RetryError is a failed attempt that may succeed if repeated: a network
+// error, 429 or 5xx. After is the wait the server asked for, if any.
+type RetryError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// Check returns nil for a 2xx response and an error naming the status
+// otherwise; a *RetryError for 429 and 5xx responses.
+func Check(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err := fmt.Errorf("HTTP %s", resp.Status)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return &RetryError{Err: err, After: retryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	}
+	return err
+}
+
+// retryAfter parses a Retry-After value, delay seconds or an HTTP date,
+// capped at MaxRetryAfter. It is zero when absent or invalid.
+func retryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = t.Sub(now)
+	}
+	return min(max(d, 0), MaxRetryAfter)
+}
+
+// Policy is how a failed delivery is retried.
+type Policy struct {
+	// Attempts is the most tries; DefaultAttempts when zero.
+	Attempts int
+	// Backoff is the wait before the second try, doubled before each one
+	// after; DefaultBackoff when zero. A Retry-After wait replaces it.
+	Backoff time.Duration
+}
+
+// Do calls attempt until it succeeds, fails with an error that is not a
+// *RetryError, or has been tried Attempts times, and returns the number of
+// tries and the last error. Cancelling ctx ends the wait for the next try
+// but not one in progress: attempt gets a context without ctx's
+// cancellation, so a request already sent still gets its answer.
+func (p Policy) Do(ctx context.Context, attempt func(ctx context.Context) error) (int, error) {
+	attempts := p.Attempts
+	if attempts <= 0 {
+		attempts = DefaultAttempts
+	}
+	backoff := p.Backoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+
+	for n := 1; ; n++ {
+		err := attempt(context.WithoutCancel(ctx))
+		var retry *RetryError
+		if err == nil || !errors.As(err, &retry) || n == attempts {
+			return n, err
+		}
+		wait := backoff
+		if retry.After > 0 {
+			wait = retry.After
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return n, err
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+// Queue runs jobs in the background, one at a time per key and in the
+// order they were added; jobs for different keys run concurrently.
+//
+// Jobs get the queue's own context rather than the one of the code that
+// queued them, so that work queued while serving a short request still runs
+// once the request is over. Shutdown cancels it, which makes a Policy stop
+// waiting between tries, and drops the jobs that have not started; call it
+// (or Wait) before exiting.
+type Queue struct {
+	mu      sync.Mutex
+	pending map[string][]func(ctx context.Context)
+	wg      sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelFunc
+	dropped int
+}
+
+// Add queues job behind the other jobs for key. Jobs added after Shutdown
+// are dropped.
+func (q *Queue) Add(key string, job func(ctx context.Context)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.init()
+	if q.ctx.Err() != nil {
+		q.dropped++
+		return
+	}
+	q.wg.Add(1)
+	jobs, running := q.pending[key]
+	q.pending[key] = append(jobs, job)
+	if !running {
+		go q.drain(key)
+	}
+}
+
+// init sets up the queue on first use; q.mu must be held.
+func (q *Queue) init() {
+	if q.pending == nil {
+		q.pending = make(map[string][]func(ctx context.Context))
+		q.ctx, q.cancel = context.WithCancel(context.Background())
+	}
+}
+
+// drain runs the jobs for key until there are none left, or drops them once
+// the queue is shut down.
+func (q *Queue) drain(key string) {
+	for {
+		q.mu.Lock()
+		jobs := q.pending[key]
+		if len(jobs) == 0 || q.ctx.Err() != nil {
+			delete(q.pending, key)
+			q.dropped += len(jobs)
+			q.wg.Add(-len(jobs))
+			q.mu.Unlock()
+			return
+		}
+		job := jobs[0]
+		q.pending[key] = jobs[1:]
+		q.mu.Unlock()
+
+		job(q.ctx)
+		q.wg.Done()
+	}
+}
+
+// Wait blocks until every job added so far has run.
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+// Shutdown cancels the context of the running jobs, drops the ones that
+// have not started and waits for the running ones to return, or for ctx to
+// be done. It returns how many jobs were dropped, and ctx's error if it
+// stopped waiting early.
+func (q *Queue) Shutdown(ctx context.Context) (int, error) {
+	q.mu.Lock()
+	q.init()
+	q.cancel()
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped, err
+}
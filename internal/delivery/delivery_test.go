@@ -0,0 +1,192 @@
+package delivery_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/markcromwell/gator/internal/delivery"
+)
+
+func response(status int, retryAfter string) *http.Response {
+	h := http.Header{}
+	if retryAfter != "" {
+		h.Set("Retry-After", retryAfter)
+	}
+	return &http.Response{StatusCode: status, Status: http.StatusText(status), Header: h}
+}
+
+func TestCheck(t *testing.T) {
+	if err := delivery.Check(response(http.StatusNoContent, "")); err != nil {
+		t.Errorf("204: %v", err)
+	}
+
+	var retry *delivery.RetryError
+	if err := delivery.Check(response(http.StatusGone, "")); err == nil || errors.As(err, &retry) {
+		t.Errorf("410: want a final error, got %#v", err)
+	}
+	if err := delivery.Check(response(http.StatusBadGateway, "")); !errors.As(err, &retry) || retry.After != 0 {
+		t.Errorf("502: want a retry without a wait, got %#v", err)
+	}
+
+	for _, tc := range []struct {
+		header string
+		want   time.Duration
+	}{
+		{"2", 2 * time.Second},
+		{"86400", delivery.MaxRetryAfter},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), delivery.MaxRetryAfter},
+		{"soon", 0},
+	} {
+		err := delivery.Check(response(http.StatusTooManyRequests, tc.header))
+		if !errors.As(err, &retry) || retry.After != tc.want {
+			t.Errorf("429 Retry-After %q: got %#v, want a retry after %s", tc.header, err, tc.want)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	p := delivery.Policy{Attempts: 3, Backoff: time.Millisecond}
+
+	// retries until an attempt succeeds
+	calls := 0
+	n, err := p.Do(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 2 {
+			return &delivery.RetryError{Err: errors.New("busy")}
+		}
+		return nil
+	})
+	if n != 2 || err != nil {
+		t.Errorf("Do = %d, %v; want 2, nil", n, err)
+	}
+
+	// a final error stops at once
+	n, err = p.Do(context.Background(), func(context.Context) error { return errors.New("gone") })
+	if n != 1 || err == nil {
+		t.Errorf("Do = %d, %v; want 1 and an error", n, err)
+	}
+
+	// gives up after Attempts
+	n, err = p.Do(context.Background(), func(context.Context) error {
+		return &delivery.RetryError{Err: errors.New("busy")}
+	})
+	if n != 3 || err == nil {
+		t.Errorf("Do = %d, %v; want 3 and an error", n, err)
+	}
+
+	// Retry-After replaces the backoff
+	start := time.Now()
+	calls = 0
+	p.Do(context.Background(), func(context.Context) error {
+		calls++
+		if calls == 1 {
+			return &delivery.RetryError{Err: errors.New("slow down"), After: 50 * time.Millisecond}
+		}
+		return nil
+	})
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("waited %s, want at least the Retry-After of 50ms", waited)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	var (
+		q       delivery.Queue
+		mu      sync.Mutex
+		order   = map[string][]int{}
+		running = map[string]*atomic.Int32{"a": {}, "b": {}}
+	)
+	for i := range 20 {
+		key := []string{"a", "b"}[i%2]
+		q.Add(key, func(context.Context) {
+			if running[key].Add(1) != 1 {
+				t.Errorf("two jobs for %s at once", key)
+			}
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			order[key] = append(order[key], i)
+			mu.Unlock()
+			running[key].Add(-1)
+		})
+	}
+	q.Wait()
+
+	for key, got := range order {
+		if len(got) != 10 {
+			t.Errorf("%s ran %d jobs, want 10", key, len(got))
+		}
+		for j := 1; j < len(got); j++ {
+			if got[j] < got[j-1] {
+				t.Errorf("%s ran out of order: %v", key, got)
+				break
+			}
+		}
+	}
+}
+
+func TestQueueShutdown(t *testing.T) {
+	var q delivery.Queue
+	p := delivery.Policy{Attempts: 3}
+
+	// the first job is in flight when Shutdown is called and then asked to
+	// come back in a minute; the second has not started
+	started, release := make(chan struct{}), make(chan struct{})
+	var attempts, canceled atomic.Int32
+	q.Add("a", func(ctx context.Context) {
+		p.Do(ctx, func(ctx context.Context) error {
+			if attempts.Add(1) == 1 {
+				close(started)
+				<-release
+			}
+			if ctx.Err() != nil {
+				canceled.Add(1)
+			}
+			return &delivery.RetryError{Err: errors.New("slow down"), After: time.Minute}
+		})
+	})
+	ran := false
+	q.Add("a", func(context.Context) { ran = true })
+
+	<-started
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	start := time.Now()
+	dropped, err := q.Shutdown(context.Background())
+	if err != nil || dropped != 1 {
+		t.Errorf("Shutdown = %d, %v; want 1 dropped, nil", dropped, err)
+	}
+	if waited := time.Since(start); waited > 5*time.Second {
+		t.Errorf("Shutdown waited %s through the Retry-After", waited)
+	}
+	if attempts.Load() != 1 || canceled.Load() != 0 || ran {
+		t.Errorf("attempts = %d, cancelled attempts = %d, second job ran = %v; want the in-flight attempt finished and nothing else", attempts.Load(), canceled.Load(), ran)
+	}
+
+	// jobs added afterwards are dropped too
+	q.Add("b", func(context.Context) { t.Error("job added after Shutdown ran") })
+	q.Wait()
+}
+
+func TestQueueShutdownTimeout(t *testing.T) {
+	var q delivery.Queue
+	started, block := make(chan struct{}), make(chan struct{})
+	defer close(block)
+	q.Add("a", func(context.Context) {
+		close(started)
+		<-block
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want the deadline to cut the wait short", err)
+	}
+}
@@ -0,0 +1,251 @@
+// Package digest emails subscribed users the unread posts stored since their
+// last digest, grouped by feed, as a plain-text and HTML message.
+package digest
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/markcromwell/gator/internal/database"
+)
+
+// DefaultLimit is the most posts in one digest when Options.Limit is 0.
+// Posts beyond it are left for the next digest.
+const DefaultLimit = 200
+
+// Sender delivers a complete RFC 5322 message to one recipient.
+type Sender interface {
+	Send(to string, msg []byte) error
+}
+
+// Mailer sends messages through an SMTP server.
+type Mailer struct {
+	Addr     string // host:port
+	Username string // optional; enables PLAIN auth
+	Password string
+	From     string
+}
+
+// Send implements Sender.
+func (m Mailer) Send(to string, msg []byte) error {
+	if m.Addr == "" {
+		return errors.New("no SMTP server configured (set smtp_addr)")
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid smtp_addr %q: %w", m.Addr, err)
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{to}, msg)
+}
+
+// Options controls a digest run.
+type Options struct {
+	From  string
+	Limit int32
+	// DryRun hands the messages to the sender but leaves every watermark
+	// where it was, so the next run covers the same posts.
+	DryRun bool
+}
+
+// Post is one post in a digest.
+type Post struct {
+	Title     string
+	URL       string
+	Published time.Time
+}
+
+// Feed is one feed's posts in a digest, newest first.
+type Feed struct {
+	Name  string
+	URL   string
+	Posts []Post
+}
+
+// Digest is what one user is sent.
+type Digest struct {
+	User    string
+	To      string
+	Feeds   []Feed // by name
+	Posts   int
+	LastSeq int64 // seq of the newest post included; the next watermark
+}
+
+// Collect builds sub's digest from the posts after its watermark. The digest
+// is empty when there is nothing new.
+func Collect(ctx context.Context, db *database.Queries, sub database.GetDigestSubscriptionsRow, limit int32) (Digest, error) {
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+	rows, err := db.GetDigestPosts(ctx, database.GetDigestPostsParams{
+		UserID:   sub.UserID,
+		AfterSeq: sub.LastSeq,
+		Limit:    limit,
+	})
+	if err != nil {
+		return Digest{}, fmt.Errorf("get posts for %s: %w", sub.Name, err)
+	}
+
+	d := Digest{User: sub.Name, To: sub.Email, Posts: len(rows), LastSeq: sub.LastSeq}
+	byURL := make(map[string]int)
+	// rows are oldest first; prepend so each feed lists its newest first
+	for _, r := range rows {
+		i, ok := byURL[r.FeedUrl]
+		if !ok {
+			i = len(d.Feeds)
+			byURL[r.FeedUrl] = i
+			d.Feeds = append(d.Feeds, Feed{Name: r.FeedName, URL: r.FeedUrl})
+		}
+		d.Feeds[i].Posts = append([]Post{{Title: r.Title, URL: r.Url, Published: r.PublishedAt}}, d.Feeds[i].Posts...)
+		d.LastSeq = max(d.LastSeq, r.Seq)
+	}
+	sort.SliceStable(d.Feeds, func(i, j int) bool {
+		return strings.ToLower(d.Feeds[i].Name) < strings.ToLower(d.Feeds[j].Name)
+	})
+	return d, nil
+}
+
+// Run sends each subscribed user with new posts their digest and moves
+// their watermark past the posts sent. It returns how many digests were
+// sent; a failure for one user does not stop the others, and their errors
+// are returned together.
+func Run(ctx context.Context, db *database.Queries, sender Sender, opts Options) (int, error) {
+	subs, err := db.GetDigestSubscriptions(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("get digest subscriptions: %w", err)
+	}
+
+	sent := 0
+	var errs []error
+	for _, sub := range subs {
+		d, err := Collect(ctx, db, sub, opts.Limit)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if d.Posts == 0 {
+			continue
+		}
+		now := time.Now().UTC()
+		msg, err := Message(opts.From, d, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("build digest for %s: %w", sub.Name, err))
+			continue
+		}
+		if err := sender.Send(d.To, msg); err != nil {
+			errs = append(errs, fmt.Errorf("send digest to %s: %w", sub.Name, err))
+			continue
+		}
+		sent++
+		if opts.DryRun {
+			continue
+		}
+		if err := db.MarkDigestSent(ctx, database.MarkDigestSentParams{
+			UserID:     sub.UserID,
+			LastSeq:    d.LastSeq,
+			LastSentAt: sql.NullTime{Time: now, Valid: true},
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("record digest for %s: %w", sub.Name, err))
+		}
+	}
+	return sent, errors.Join(errs...)
+}
+
+// Message renders d as a multipart/alternative email with a plain-text and
+// an HTML part.
+func Message(from string, d Digest, date time.Time) ([]byte, error) {
+	var text, html bytes.Buffer
+	writeText(&text, d)
+	if err := htmlTmpl.Execute(&html, d); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write(part.content); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	for _, h := range [][2]string{
+		{"From", from},
+		{"To", d.To},
+		{"Subject", mime.QEncoding.Encode("utf-8", Subject(d))},
+		{"Date", date.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", `multipart/alternative; boundary="` + mw.Boundary() + `"`},
+	} {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h[0], h[1])
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// Subject is the subject line of d's message.
+func Subject(d Digest) string {
+	if d.Posts == 1 {
+		return "gator digest: 1 new post"
+	}
+	return fmt.Sprintf("gator digest: %d new posts", d.Posts)
+}
+
+func writeText(w *bytes.Buffer, d Digest) {
+	fmt.Fprintf(w, "%s for %s\n", Subject(d), d.User)
+	for _, f := range d.Feeds {
+		fmt.Fprintf(w, "\n%s\n%s\n", f.Name, strings.Repeat("=", len([]rune(f.Name))))
+		for _, p := range f.Posts {
+			fmt.Fprintf(w, "\n* %s (%s)\n  %s\n", p.Title, p.Published.Format("2 Jan 2006"), p.URL)
+		}
+	}
+}
+
+var htmlTmpl = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html>
+<body>
+<h1>{{.Posts}} new post{{if ne .Posts 1}}s{{end}} for {{.User}}</h1>
+{{range .Feeds}}<h2><a href="{{.URL}}">{{.Name}}</a></h2>
+<ul>
+{{range .Posts}}<li><a href="{{.URL}}">{{.Title}}</a> <small>{{.Published.Format "2 Jan 2006"}}</small></li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,229 @@
+package digest_test
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/digest"
+)
+
+var (
+	subscriptionColumns = []string{"user_id", "name", "email", "last_seq", "last_sent_at"}
+	digestPostColumns   = []string{"seq", "title", "url", "published_at", "feed_name", "feed_url"}
+)
+
+// smtpMessage is a message as received by smtpServer.
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer is a minimal SMTP stand-in on a local port that accepts every
+// message and passes it to the returned channel.
+func smtpServer(t *testing.T) (string, <-chan smtpMessage) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	msgs := make(chan smtpMessage, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, msgs)
+		}
+	}()
+	return ln.Addr().String(), msgs
+}
+
+func serveSMTP(conn net.Conn, msgs chan<- smtpMessage) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+	reply("220 localhost ESMTP")
+	var msg smtpMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			msg = smtpMessage{from: strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")}
+			reply("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.data = data.String()
+			msgs <- msg
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// parts returns the text of each part of a multipart message by content type.
+func parts(t *testing.T, raw string) (*mail.Message, map[string]string) {
+	t.Helper()
+	m, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v)", m.Header.Get("Content-Type"), err)
+	}
+	out := make(map[string]string)
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart: %v", err)
+		}
+		// the reader undoes quoted-printable itself
+		b, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		ct, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		out[ct] = string(b)
+	}
+	return m, out
+}
+
+func TestRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+	addr, msgs := smtpServer(t)
+
+	bob, alice := uuid.New(), uuid.New()
+	published := time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`(?i)FROM digest_subscriptions`).
+		WillReturnRows(sqlmock.NewRows(subscriptionColumns).
+			AddRow(alice, "alice", "alice@example.com", int64(50), nil).
+			AddRow(bob, "bob", "bob@example.com", int64(40), published))
+	// nothing new for alice: no mail, watermark untouched
+	mock.ExpectQuery(`(?i)FROM posts p\s+JOIN feed_follows .+p.seq >`).
+		WithArgs(alice, int64(50), int32(digest.DefaultLimit)).
+		WillReturnRows(sqlmock.NewRows(digestPostColumns))
+	mock.ExpectQuery(`(?i)FROM posts p\s+JOIN feed_follows .+p.seq >`).
+		WithArgs(bob, int64(40), int32(digest.DefaultLimit)).
+		WillReturnRows(sqlmock.NewRows(digestPostColumns).
+			AddRow(int64(41), "Comic <1>", "https://xkcd.com/1", published, "xkcd", "https://xkcd.com/rss.xml").
+			AddRow(int64(43), "Go 1.23", "https://go.dev/blog/go1.23", published, "Go Blog", "https://go.dev/blog/feed.atom").
+			AddRow(int64(44), "Comic 2", "https://xkcd.com/2", published.Add(time.Hour), "xkcd", "https://xkcd.com/rss.xml"))
+	mock.ExpectExec(`(?i)UPDATE digest_subscriptions`).
+		WithArgs(bob, int64(44), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mailer := digest.Mailer{Addr: addr, From: "gator@example.com"}
+	n, err := digest.Run(context.Background(), database.New(db), mailer, digest.Options{From: mailer.From})
+	if err != nil || n != 1 {
+		t.Fatalf("Run = %d, %v; want 1, nil", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	msg := <-msgs
+	if msg.from != "gator@example.com" || len(msg.to) != 1 || msg.to[0] != "bob@example.com" {
+		t.Errorf("envelope from %q to %v", msg.from, msg.to)
+	}
+	m, body := parts(t, msg.data)
+	if got := m.Header.Get("Subject"); got != "gator digest: 3 new posts" {
+		t.Errorf("Subject = %q", got)
+	}
+	text := body["text/plain"]
+	goBlog, xkcd := strings.Index(text, "Go Blog"), strings.Index(text, "xkcd")
+	if goBlog < 0 || xkcd < goBlog || strings.Index(text, "Comic 2") > strings.Index(text, "Comic <1>") ||
+		!strings.Contains(text, "  https://go.dev/blog/go1.23") {
+		t.Errorf("unexpected text part:\n%s", text)
+	}
+	html := body["text/html"]
+	if !strings.Contains(html, `<a href="https://xkcd.com/1">Comic &lt;1&gt;</a>`) || !strings.Contains(html, "3 new posts for bob") {
+		t.Errorf("unexpected HTML part:\n%s", html)
+	}
+}
+
+func TestRun_SendError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	bob := uuid.New()
+	mock.ExpectQuery(`(?i)FROM digest_subscriptions`).
+		WillReturnRows(sqlmock.NewRows(subscriptionColumns).AddRow(bob, "bob", "bob@example.com", int64(0), sql.NullTime{}))
+	mock.ExpectQuery(`(?i)FROM posts p`).
+		WithArgs(bob, int64(0), int32(5)).
+		WillReturnRows(sqlmock.NewRows(digestPostColumns).
+			AddRow(int64(1), "Comic", "https://xkcd.com/1", time.Now(), "xkcd", "https://xkcd.com/rss.xml"))
+
+	// nothing listens on a closed port, so sending fails and the watermark
+	// is left alone
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	n, err := digest.Run(context.Background(), database.New(db), digest.Mailer{Addr: addr}, digest.Options{Limit: 5})
+	if n != 0 || err == nil || !strings.Contains(err.Error(), "send digest to bob") {
+		t.Fatalf("Run = %d, %v; want a send error", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	if err := (digest.Mailer{}).Send("bob@example.com", nil); err == nil {
+		t.Errorf("expected error without an SMTP server")
+	}
+}
@@ -0,0 +1,240 @@
+package feed
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// AtomFeed is an Atom 1.0 (RFC 4287) feed document.
+type AtomFeed struct {
+	Base     string       `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
+	ID       string       `xml:"id"`
+	Title    AtomText     `xml:"title"`
+	Subtitle AtomText     `xml:"subtitle"`
+	Updated  string       `xml:"updated"`
+	Links    []AtomLink   `xml:"link"`
+	Authors  []AtomPerson `xml:"author"`
+	Entries  []AtomEntry  `xml:"entry"`
+}
+
+// AtomEntry is a single <entry> of an Atom feed.
+type AtomEntry struct {
+	Base       string         `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
+	ID         string         `xml:"id"`
+	Title      AtomText       `xml:"title"`
+	Links      []AtomLink     `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Summary    AtomText       `xml:"summary"`
+	Content    AtomText       `xml:"content"`
+	Authors    []AtomPerson   `xml:"author"`
+	Categories []AtomCategory `xml:"category"`
+}
+
+// AtomLink is an Atom <link> element. An empty Rel means "alternate".
+type AtomLink struct {
+	Href     string `xml:"href,attr"`
+	Rel      string `xml:"rel,attr"`
+	Type     string `xml:"type,attr"`
+	Title    string `xml:"title,attr"`
+	Length   string `xml:"length,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+}
+
+// AtomPerson is an Atom person construct (<author> or <contributor>).
+type AtomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email"`
+	URI   string `xml:"uri"`
+}
+
+// AtomCategory is an Atom <category> element.
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+// AtomText is an Atom text construct. Type is "text", "html" or "xhtml";
+// Src is only set on out-of-line <content> elements.
+type AtomText struct {
+	Type     string `xml:"type,attr"`
+	Src      string `xml:"src,attr"`
+	Text     string `xml:",chardata"`
+	InnerXML string `xml:",innerxml"`
+}
+
+// Value returns the text construct as a string. For xhtml content the
+// wrapping <div> is removed and the markup is returned as-is.
+func (t AtomText) Value() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(stripWrapperDiv(t.InnerXML))
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// stripWrapperDiv removes the <div xmlns="http://www.w3.org/1999/xhtml">
+// wrapper that Atom requires around xhtml text constructs.
+func stripWrapperDiv(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "<div") {
+		return s
+	}
+	start := strings.Index(s, ">")
+	end := strings.LastIndex(s, "</div>")
+	if start < 0 || end < start {
+		return s
+	}
+	return s[start+1 : end]
+}
+
+// alternateLink picks the link a reader should follow: the first
+// rel="alternate" link, preferring text/html, falling back to the first link
+// with any href.
+func alternateLink(links []AtomLink) string {
+	var alt, htmlAlt, first string
+	for _, l := range links {
+		if l.Href == "" {
+			continue
+		}
+		if first == "" {
+			first = l.Href
+		}
+		if l.Rel != "" && l.Rel != "alternate" {
+			continue
+		}
+		if alt == "" {
+			alt = l.Href
+		}
+		if htmlAlt == "" && (l.Type == "" || strings.HasPrefix(l.Type, "text/html")) {
+			htmlAlt = l.Href
+		}
+	}
+	switch {
+	case htmlAlt != "":
+		return htmlAlt
+	case alt != "":
+		return alt
+	default:
+		return first
+	}
+}
+
+// joinPeople returns the names of people joined by ", ", using the email
+// address for anyone without a name.
+func joinPeople(people []AtomPerson) string {
+	names := make([]string, 0, len(people))
+	for _, p := range people {
+		name := strings.TrimSpace(p.Name)
+		if name == "" {
+			name = strings.TrimSpace(p.Email)
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// resolveRef resolves ref against each base in turn, returning ref unchanged
+// if it is already absolute or no base applies.
+func resolveRef(ref string, bases ...string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.IsAbs() {
+		return ref
+	}
+	for _, base := range bases {
+		b, err := url.Parse(base)
+		if err != nil || !b.IsAbs() {
+			continue
+		}
+		return b.ResolveReference(u).String()
+	}
+	return ref
+}
+
+// isHTTPURL reports whether s is an absolute http(s) URL.
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func parseAtom(b []byte) (*RSSFeed, error) {
+	var a AtomFeed
+	if err := newDecoder(b).Decode(&a); err != nil {
+		return nil, fmt.Errorf("xml unmarshal: %w", err)
+	}
+	return a.toRSS(), nil
+}
+
+// toRSS maps the Atom document onto the RSSFeed model that the rest of gator
+// stores. Entries inherit the feed's authors when they have none of their
+// own, and published is preferred over updated for the item date.
+func (a *AtomFeed) toRSS() *RSSFeed {
+	var out RSSFeed
+	feedLink := resolveRef(alternateLink(a.Links), a.Base)
+	out.Channel.Title = a.Title.Value()
+	out.Channel.Link = feedLink
+	out.Channel.Description = a.Subtitle.Value()
+
+	items := make([]RSSItem, 0, len(a.Entries))
+	for _, e := range a.Entries {
+		link := alternateLink(e.Links)
+		if link == "" && isHTTPURL(e.ID) {
+			link = e.ID
+		}
+		link = resolveRef(link, e.Base, a.Base, feedLink)
+
+		date := e.Published
+		if date == "" {
+			date = e.Updated
+		}
+
+		authors := e.Authors
+		if len(authors) == 0 {
+			authors = a.Authors
+		}
+
+		var content string
+		if e.Content.Src == "" {
+			content = e.Content.Value()
+		}
+
+		var categories []string
+		for _, c := range e.Categories {
+			if c.Label != "" {
+				categories = append(categories, c.Label)
+			} else {
+				categories = append(categories, c.Term)
+			}
+		}
+
+		var enclosures []RSSEnclosure
+		for _, l := range e.Links {
+			if l.Rel == "enclosure" && l.Href != "" {
+				enclosures = append(enclosures, RSSEnclosure{
+					URL:    resolveRef(l.Href, e.Base, a.Base, feedLink),
+					Length: l.Length,
+					Type:   l.Type,
+				})
+			}
+		}
+
+		items = append(items, RSSItem{
+			GUID:        strings.TrimSpace(e.ID),
+			Title:       e.Title.Value(),
+			Link:        link,
+			Description: e.Summary.Value(),
+			PubDate:     strings.TrimSpace(date),
+			Content:     content,
+			Author:      joinPeople(authors),
+			Categories:  trimAll(categories),
+			Enclosures:  enclosures,
+		})
+	}
+	out.Channel.Item = items
+	return &out
+}
@@ -0,0 +1,112 @@
+package feed_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/markcromwell/gator/internal/feed"
+)
+
+const sampleAtom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xml:base="https://github.com/">
+  <id>tag:github.com,2008:https://github.com/example/project/releases</id>
+  <title>Release notes from project</title>
+  <subtitle type="html">Releases &amp;amp; tags</subtitle>
+  <link rel="self" type="application/atom+xml" href="https://github.com/example/project/releases.atom"/>
+  <link rel="alternate" type="text/html" href="https://github.com/example/project/releases"/>
+  <author><name>Project Team</name></author>
+  <updated>2024-03-02T10:00:00Z</updated>
+  <entry>
+    <id>tag:github.com,2008:Repository/1/v1.2.0</id>
+    <title>v1.2.0</title>
+    <link rel="related" href="https://example.com/related"/>
+    <link rel="alternate" type="text/html" href="/example/project/releases/tag/v1.2.0"/>
+    <published>2024-03-01T09:00:00Z</published>
+    <updated>2024-03-02T10:00:00Z</updated>
+    <summary>Bug fixes</summary>
+    <content type="html">&lt;p&gt;Fixed &lt;b&gt;everything&lt;/b&gt;&lt;/p&gt;</content>
+    <author><name>alice</name></author>
+    <author><name>bob</name></author>
+    <category term="release" label="Release"/>
+    <category term="go"/>
+  </entry>
+  <entry>
+    <id>https://blog.example.com/posts/2</id>
+    <title type="text">Second</title>
+    <updated>2024-02-01T09:00:00Z</updated>
+    <content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Inline <em>xhtml</em></p></div></content>
+  </entry>
+</feed>`
+
+func TestParseAtom(t *testing.T) {
+	f, err := feed.Parse([]byte(sampleAtom))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	if f.Channel.Title != "Release notes from project" {
+		t.Errorf("unexpected channel title %q", f.Channel.Title)
+	}
+	if f.Channel.Link != "https://github.com/example/project/releases" {
+		t.Errorf("expected alternate feed link, got %q", f.Channel.Link)
+	}
+	if f.Channel.Description != "Releases & tags" {
+		t.Errorf("unexpected channel description %q", f.Channel.Description)
+	}
+	if len(f.Channel.Item) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(f.Channel.Item))
+	}
+
+	first := f.Channel.Item[0]
+	if first.Link != "https://github.com/example/project/releases/tag/v1.2.0" {
+		t.Errorf("expected resolved alternate link, got %q", first.Link)
+	}
+	if first.PubDate != "2024-03-01T09:00:00Z" {
+		t.Errorf("expected published date to win over updated, got %q", first.PubDate)
+	}
+	if first.Description != "Bug fixes" {
+		t.Errorf("unexpected description %q", first.Description)
+	}
+	if first.Content != "<p>Fixed <b>everything</b></p>" {
+		t.Errorf("unexpected content %q", first.Content)
+	}
+	if first.Author != "alice, bob" {
+		t.Errorf("unexpected author %q", first.Author)
+	}
+	if len(first.Categories) != 2 || first.Categories[0] != "Release" || first.Categories[1] != "go" {
+		t.Errorf("expected category labels falling back to terms, got %v", first.Categories)
+	}
+
+	second := f.Channel.Item[1]
+	if second.Link != "https://blog.example.com/posts/2" {
+		t.Errorf("expected id to be used as link, got %q", second.Link)
+	}
+	if second.PubDate != "2024-02-01T09:00:00Z" {
+		t.Errorf("expected updated date fallback, got %q", second.PubDate)
+	}
+	if second.Author != "Project Team" {
+		t.Errorf("expected feed author to be inherited, got %q", second.Author)
+	}
+	if second.Content != "<p>Inline <em>xhtml</em></p>" {
+		t.Errorf("unexpected xhtml content %q", second.Content)
+	}
+}
+
+func TestFetchFeed_Atom(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml")
+		fmt.Fprintln(w, sampleAtom)
+	}))
+	defer srv.Close()
+
+	f, err := feed.FetchFeed(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("FetchFeed error: %v", err)
+	}
+	if len(f.Channel.Item) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(f.Channel.Item))
+	}
+}
@@ -0,0 +1,50 @@
+package feed_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/markcromwell/gator/internal/feed"
+)
+
+func TestFetchFeedConditional(t *testing.T) {
+	const etag = `"v1"`
+	const lastModified = "Mon, 06 Sep 2021 12:00:00 GMT"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		fmt.Fprintln(w, sampleRSS)
+	}))
+	defer srv.Close()
+
+	first, err := feed.FetchFeedConditional(context.Background(), srv.URL, feed.Validators{})
+	if err != nil {
+		t.Fatalf("first fetch: %v", err)
+	}
+	if first.NotModified || first.Feed == nil || len(first.Feed.Channel.Item) != 2 {
+		t.Fatalf("expected full feed on first fetch, got %+v", first)
+	}
+	if first.Validators.ETag != etag || first.Validators.LastModified != lastModified {
+		t.Fatalf("unexpected validators: %+v", first.Validators)
+	}
+
+	second, err := feed.FetchFeedConditional(context.Background(), srv.URL, first.Validators)
+	if err != nil {
+		t.Fatalf("second fetch: %v", err)
+	}
+	if !second.NotModified || second.Feed != nil {
+		t.Fatalf("expected not modified, got %+v", second)
+	}
+	// A 304 without validator headers keeps the ones we sent.
+	if second.Validators != first.Validators {
+		t.Fatalf("expected validators to be kept, got %+v", second.Validators)
+	}
+}
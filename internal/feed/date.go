@@ -0,0 +1,74 @@
+package feed
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParseFeedDate attempts to parse a date string from RSS/Atom feeds using a comprehensive list of common formats.
+// It supports variations from RFC 822 (RSS) and RFC 3339/ISO 8601 (Atom), including:
+// - With/without weekdays
+// - Days with/without leading zeros
+// - Named timezones (e.g., MST, EST)
+// - Numeric offsets (e.g., -0700, +0200)
+// - UTC 'Z' designator
+// - Fractional seconds
+// - Rare cases with space instead of 'T' in ISO formats
+// - W3C-DTF dates used by Dublin Core (minute precision, date only)
+//
+// If parsing fails for all formats, it returns a zero time.Time and an error.
+func ParseFeedDate(dateStr string) (time.Time, error) {
+	formats := []string{
+		// RFC 822 / RSS variations (with weekday)
+		time.RFC1123,                   // "Mon, 02 Jan 2006 15:04:05 MST" (named TZ)
+		time.RFC1123Z,                  // "Mon, 02 Jan 2006 15:04:05 -0700" (numeric TZ)
+		"Mon, 2 Jan 2006 15:04:05 MST", // Day without leading zero, named TZ
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"Mon, 02 Jan 2006 15:04:05 +0000", // +0000 offset
+		"Mon, 2 Jan 2006 15:04:05 +0000",
+
+		// Without weekday
+		"02 Jan 2006 15:04:05 MST",
+		"02 Jan 2006 15:04:05 -0700",
+		"2 Jan 2006 15:04:05 MST",
+		"2 Jan 2006 15:04:05 -0700",
+		"02 Jan 2006 15:04:05 +0000",
+		"2 Jan 2006 15:04:05 +0000",
+
+		// RFC 3339 / Atom variations
+		time.RFC3339,                     // "2006-01-02T15:04:05Z07:00" (wait, actually "2006-01-02T15:04:05-07:00")
+		time.RFC3339Nano,                 // With nanoseconds: "2006-01-02T15:04:05.999999999-07:00"
+		"2006-01-02T15:04:05Z",           // Z without offset
+		"2006-01-02T15:04:05.999999999Z", // Z with nano
+		"2006-01-02T15:04:05+00:00",      // +00:00
+		"2006-01-02T15:04:05-00:00",      // -00:00
+
+		// Rare: Space instead of 'T' (some non-standard feeds)
+		"2006-01-02 15:04:05Z",
+		"2006-01-02 15:04:05-07:00",
+		"2006-01-02 15:04:05+00:00",
+		"2006-01-02 15:04:05.999999999Z",
+
+		// W3C-DTF (Dublin Core dc:date in RSS 1.0): minutes precision and date only
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02",
+
+		// Other observed formats from feeds
+		"Mon, 02 Jan 2006 15:04:05 GMT", // GMT specifically
+		"Mon, 2 Jan 2006 15:04:05 GMT",
+		"02 Jan 2006 15:04:05 GMT",
+		"2 Jan 2006 15:04:05 GMT",
+		"Mon, 02 Jan 2006 15:04:05 EST", // EST, etc.
+	}
+
+	var parsedTime time.Time
+	var lastErr error
+	for _, format := range formats {
+		parsedTime, lastErr = time.Parse(format, dateStr)
+		if lastErr == nil {
+			return parsedTime.UTC(), nil // Normalize to UTC for consistency
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unable to parse date '%s' with any known format: %w", dateStr, lastErr)
+}
@@ -0,0 +1,25 @@
+package feed_test
+
+import (
+	"testing"
+
+	"github.com/markcromwell/gator/internal/feed"
+)
+
+func TestParseFeedDate(t *testing.T) {
+	for _, in := range []string{
+		"Mon, 06 Sep 2021 12:00:00 GMT",
+		"Tue, 7 Sep 2021 14:30:00 -0700",
+		"2024-03-01T09:00:00Z",
+		"2024-03-01T09:30+01:00",
+		"2024-03-01",
+	} {
+		if _, err := feed.ParseFeedDate(in); err != nil {
+			t.Errorf("ParseFeedDate(%q): %v", in, err)
+		}
+	}
+
+	if _, err := feed.ParseFeedDate("yesterday"); err == nil {
+		t.Errorf("expected error for unparseable date")
+	}
+}
@@ -0,0 +1,180 @@
+package feed
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Candidate is a feed found by Discover.
+type Candidate struct {
+	URL   string
+	Title string
+	// Type is the advertised MIME type, empty for feeds found by probing.
+	Type string
+}
+
+// feedLinkTypes are the <link rel="alternate"> types that announce a feed.
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+}
+
+// commonFeedPaths are probed, relative to the site root, when an HTML page
+// announces no feeds.
+var commonFeedPaths = []string{"/feed", "/rss.xml", "/atom.xml", "/index.xml"}
+
+// maxPageSize caps how much of a page Discover reads.
+const maxPageSize = 5 << 20
+
+var (
+	linkTagRe = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+	baseTagRe = regexp.MustCompile(`(?is)<base\b[^>]*>`)
+	attrRe    = regexp.MustCompile(`(?s)([a-zA-Z_:][-a-zA-Z0-9_:.]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// Discover finds the feeds for pageURL. A URL that already serves a feed is
+// returned as the only candidate. For an HTML page the feeds it announces
+// with <link rel="alternate"> are returned in page order; when there are
+// none, common feed paths on the same site are tried.
+func Discover(ctx context.Context, pageURL string) ([]Candidate, error) {
+	body, contentType, finalURL, err := getPage(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isHTML(contentType, body) {
+		f, err := parseBody(body, contentType)
+		if err != nil {
+			return nil, fmt.Errorf("%s is neither a feed nor an HTML page: %w", pageURL, err)
+		}
+		return []Candidate{{URL: pageURL, Title: f.Channel.Title, Type: mediaType(contentType)}}, nil
+	}
+
+	if found := feedLinks(body, finalURL); len(found) > 0 {
+		return found, nil
+	}
+
+	var found []Candidate
+	for _, p := range commonFeedPaths {
+		u := resolveRef(p, finalURL)
+		b, ct, _, err := getPage(ctx, u)
+		if err != nil || isHTML(ct, b) {
+			continue
+		}
+		if f, err := parseBody(b, ct); err == nil {
+			found = append(found, Candidate{URL: u, Title: f.Channel.Title})
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no feed found at %s", pageURL)
+	}
+	return found, nil
+}
+
+// getPage fetches u and returns its body, content type and the URL it was
+// served from after redirects.
+func getPage(ctx context.Context, u string) ([]byte, string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "gator")
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("http do: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", "", &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, "", "", fmt.Errorf("read body: %w", err)
+	}
+	return b, resp.Header.Get("Content-Type"), resp.Request.URL.String(), nil
+}
+
+// isHTML reports whether a response is an HTML page rather than a feed,
+// from its content type or, failing that, its first bytes.
+func isHTML(contentType string, body []byte) bool {
+	switch mediaType(contentType) {
+	case "text/html", "application/xhtml+xml":
+		return true
+	}
+	head := bytes.ToLower(bytes.TrimSpace(body[:min(len(body), 512)]))
+	return bytes.HasPrefix(head, []byte("<!doctype html")) || bytes.HasPrefix(head, []byte("<html"))
+}
+
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+// feedLinks returns the feeds announced by <link rel="alternate"> tags in
+// page, resolved against the page's <base href> or pageURL.
+func feedLinks(page []byte, pageURL string) []Candidate {
+	base := pageURL
+	if tag := baseTagRe.Find(page); tag != nil {
+		if href := tagAttrs(tag)["href"]; href != "" {
+			base = resolveRef(href, pageURL)
+		}
+	}
+
+	var found []Candidate
+	seen := make(map[string]bool)
+	for _, tag := range linkTagRe.FindAll(page, -1) {
+		attrs := tagAttrs(tag)
+		typ := strings.ToLower(strings.TrimSpace(attrs["type"]))
+		if !hasToken(attrs["rel"], "alternate") || !feedLinkTypes[typ] || attrs["href"] == "" {
+			continue
+		}
+		u := resolveRef(attrs["href"], base)
+		if seen[u] {
+			continue
+		}
+		seen[u] = true
+		found = append(found, Candidate{URL: u, Title: attrs["title"], Type: typ})
+	}
+	return found
+}
+
+// tagAttrs returns the attributes of a single HTML tag, keyed by lower-case
+// name, with entities unescaped.
+func tagAttrs(tag []byte) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range attrRe.FindAllSubmatch(tag, -1) {
+		name := strings.ToLower(string(m[1]))
+		if _, dup := attrs[name]; dup {
+			continue
+		}
+		value := string(m[2]) + string(m[3]) + string(m[4])
+		attrs[name] = strings.TrimSpace(html.UnescapeString(value))
+	}
+	return attrs
+}
+
+// hasToken reports whether the space-separated list contains token,
+// ignoring case.
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
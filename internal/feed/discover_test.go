@@ -0,0 +1,99 @@
+package feed_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/markcromwell/gator/internal/feed"
+)
+
+const discoverRSS = `<rss version="2.0"><channel><title>Blog posts</title></channel></rss>`
+
+func TestDiscover_LinkTags(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<!DOCTYPE html>
+<html><head>
+<link rel="stylesheet" href="/style.css">
+<link rel="alternate" type="application/rss+xml" title="Posts &amp; notes" href="/feed.xml">
+<link type='application/atom+xml' rel='alternate' href='https://cdn.example.com/atom.xml' title='Atom'>
+<LINK REL="alternate" TYPE="application/feed+json" HREF="feed.json">
+<link rel="alternate" type="application/rss+xml" href="/feed.xml">
+<link rel="alternate" hreflang="de" href="/de/">
+</head><body></body></html>`)
+	}))
+	defer srv.Close()
+
+	got, err := feed.Discover(context.Background(), srv.URL+"/blog/")
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	want := []feed.Candidate{
+		{URL: srv.URL + "/feed.xml", Title: "Posts & notes", Type: "application/rss+xml"},
+		{URL: "https://cdn.example.com/atom.xml", Title: "Atom", Type: "application/atom+xml"},
+		{URL: srv.URL + "/blog/feed.json", Type: "application/feed+json"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestDiscover_FeedURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, discoverRSS)
+	}))
+	defer srv.Close()
+
+	got, err := feed.Discover(context.Background(), srv.URL+"/rss")
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if len(got) != 1 || got[0].URL != srv.URL+"/rss" || got[0].Title != "Blog posts" {
+		t.Fatalf("expected the URL itself, got %+v", got)
+	}
+}
+
+func TestDiscover_CommonPaths(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.xml":
+			fmt.Fprint(w, discoverRSS)
+		case "/feed":
+			// some sites answer unknown paths with their homepage
+			fmt.Fprint(w, "<html><body>home</body></html>")
+		case "/":
+			fmt.Fprint(w, "<!doctype html><html><head><title>Home</title></head></html>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	got, err := feed.Discover(context.Background(), srv.URL+"/")
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if len(got) != 1 || got[0].URL != srv.URL+"/index.xml" {
+		t.Fatalf("expected /index.xml, got %+v", got)
+	}
+}
+
+func TestDiscover_NoFeed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "<html><body>nothing here</body></html>")
+	}))
+	defer srv.Close()
+
+	if _, err := feed.Discover(context.Background(), srv.URL); err == nil {
+		t.Fatalf("expected error when no feed is found")
+	}
+}
@@ -8,15 +8,38 @@ import (
 	"html"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
 // RSSItem represents a single item in an RSS feed.
 type RSSItem struct {
+	// GUID identifies the item within its feed (RSS <guid>, Atom <id>, JSON
+	// Feed id, RSS 1.0 rdf:about). It may be empty.
+	GUID        string `xml:"guid"`
 	Title       string `xml:"title"`
 	Link        string `xml:"link"`
 	Description string `xml:"description"`
 	PubDate     string `xml:"pubDate"`
+	// Content holds the full body of the item when the feed provides one
+	// separately from the description (content:encoded, Atom <content>).
+	Content string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	// Author is the item author; multiple authors are joined with ", ".
+	Author string `xml:"author"`
+	// Creator is the Dublin Core dc:creator many RSS 2.0 feeds use instead
+	// of <author>; parsing copies it into Author when Author is empty.
+	Creator string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	// Categories are the item's categories or tags (RSS <category>, Atom
+	// <category>, JSON Feed tags, RSS 1.0 dc:subject).
+	Categories []string       `xml:"category"`
+	Enclosures []RSSEnclosure `xml:"enclosure"`
+}
+
+// RSSEnclosure is a media attachment on an item (podcast audio, images).
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
 }
 
 // RSSFeed is a minimal representation of an RSS document's channel and items.
@@ -26,18 +49,72 @@ type RSSFeed struct {
 		Link        string    `xml:"link"`
 		Description string    `xml:"description"`
 		Item        []RSSItem `xml:"item"`
+
+		// Polling hints from the publisher; see PollHints.
+		TTL             string   `xml:"ttl"`
+		UpdatePeriod    string   `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string   `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+		SkipHours       []string `xml:"skipHours>hour"`
+		SkipDays        []string `xml:"skipDays>day"`
 	} `xml:"channel"`
 }
 
-// FetchFeed fetches the RSS feed at feedURL, parses it into an RSSFeed struct,
-// and returns the parsed result. The request uses a `User-Agent: gator` header
-// and a reasonable timeout.
+// Validators are the HTTP cache validators returned with a feed. Sending
+// them back on the next request lets the server answer 304 Not Modified.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// FetchResult is the outcome of a conditional fetch. Feed is nil when the
+// server answered 304 Not Modified.
+type FetchResult struct {
+	Feed        *RSSFeed
+	NotModified bool
+	// Validators are the ones to send next time: the response's headers, or
+	// the request's when a 304 did not repeat them.
+	Validators Validators
+	// StatusCode is the HTTP status of the response.
+	StatusCode int
+}
+
+// HTTPError is returned when the server answers with a status other than
+// 2xx or 304.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("unexpected status: %s", e.Status)
+}
+
+// FetchFeed fetches the RSS (2.0 or 1.0/RDF), Atom or JSON Feed document at
+// feedURL, parses it into an RSSFeed struct, and returns the parsed result.
+// The request uses a `User-Agent: gator` header and a reasonable timeout.
 func FetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
+	res, err := FetchFeedConditional(ctx, feedURL, Validators{})
+	if err != nil {
+		return nil, err
+	}
+	return res.Feed, nil
+}
+
+// FetchFeedConditional is FetchFeed with If-None-Match / If-Modified-Since
+// headers built from v. A 304 response is not an error: it returns a result
+// with NotModified set and no feed.
+func FetchFeedConditional(ctx context.Context, feedURL string, v Validators) (*FetchResult, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("User-Agent", "gator")
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
 
 	client := &http.Client{Timeout: 15 * time.Second}
 	resp, err := client.Do(req)
@@ -46,8 +123,23 @@ func FetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
 	}
 	defer resp.Body.Close()
 
+	next := Validators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		if next.ETag == "" {
+			next.ETag = v.ETag
+		}
+		if next.LastModified == "" {
+			next.LastModified = v.LastModified
+		}
+		return &FetchResult{NotModified: true, Validators: next, StatusCode: resp.StatusCode}, nil
+	}
+
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	b, err := io.ReadAll(resp.Body)
@@ -55,57 +147,50 @@ func FetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
 		return nil, fmt.Errorf("read body: %w", err)
 	}
 
-	var parsed RSSFeed
-	// Use a decoder and allow common HTML named entities that appear inside
-	// some feeds (e.g. &ldquo;, &rdquo;). Leave standard XML entities alone.
-	dec := xml.NewDecoder(bytes.NewReader(b))
-	dec.Entity = map[string]string{
-		"ldquo":  "\u201C",
-		"rdquo":  "\u201D",
-		"ndash":  "-",
-		"mdash":  "-",
-		"hellip": "\u2026",
+	parsed, err := parseBody(b, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
 	}
-	if err := dec.Decode(&parsed); err != nil {
+	return &FetchResult{Feed: parsed, Validators: next, StatusCode: resp.StatusCode}, nil
+}
+
+// Parse detects the format of a feed document and parses it into an RSSFeed.
+// Bodies that start with "{" are decoded as JSON Feed; XML documents are
+// dispatched on their root element (Atom 1.0 <feed>, RSS 1.0 <rdf:RDF>,
+// otherwise RSS 2.0).
+func Parse(b []byte) (*RSSFeed, error) {
+	if looksLikeJSON(b) {
+		return finish(parseJSONFeed(b))
+	}
+
+	root, err := rootElement(b)
+	if err != nil {
 		return nil, fmt.Errorf("xml unmarshal: %w", err)
 	}
 
-	// If no RSS <item> entries were found, attempt to parse Atom <entry> elements
-	// and convert them into RSSItem values.
-	if len(parsed.Channel.Item) == 0 {
-		type atomLink struct {
-			Href string `xml:"href,attr"`
-		}
-		type atomEntry struct {
-			Title   string   `xml:"title"`
-			Link    atomLink `xml:"link"`
-			Summary string   `xml:"summary"`
-			Updated string   `xml:"updated"`
-			Id      string   `xml:"id"`
-		}
-		type atomFeed struct {
-			Entries []atomEntry `xml:"entry"`
-		}
+	switch root.Local {
+	case "feed":
+		return finish(parseAtom(b))
+	case "RDF":
+		return finish(parseRDF(b))
+	default:
+		return finish(parseRSS(b))
+	}
+}
 
-		var a atomFeed
-		dec2 := xml.NewDecoder(bytes.NewReader(b))
-		// Ignore decode error here; fallback to RSS if Atom parse fails
-		if err := dec2.Decode(&a); err == nil && len(a.Entries) > 0 {
-			items := make([]RSSItem, 0, len(a.Entries))
-			for _, e := range a.Entries {
-				link := e.Link.Href
-				if link == "" {
-					link = e.Id
-				}
-				items = append(items, RSSItem{
-					Title:       e.Title,
-					Link:        link,
-					Description: e.Summary,
-					PubDate:     e.Updated,
-				})
-			}
-			parsed.Channel.Item = items
-		}
+// parseBody parses a fetched document, trusting a JSON Feed content type
+// over sniffing the body.
+func parseBody(b []byte, contentType string) (*RSSFeed, error) {
+	if isJSONFeedType(contentType) {
+		return finish(parseJSONFeed(b))
+	}
+	return Parse(b)
+}
+
+// finish applies the post-processing shared by every format.
+func finish(parsed *RSSFeed, err error) (*RSSFeed, error) {
+	if err != nil {
+		return nil, err
 	}
 
 	// Unescape HTML entities for the channel and each item
@@ -116,5 +201,65 @@ func FetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
 		parsed.Channel.Item[i].Description = html.UnescapeString(parsed.Channel.Item[i].Description)
 	}
 
+	return parsed, nil
+}
+
+// newDecoder returns an XML decoder that allows common HTML named entities
+// that appear inside some feeds (e.g. &ldquo;, &rdquo;). Standard XML
+// entities are left alone.
+func newDecoder(b []byte) *xml.Decoder {
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	dec.Entity = map[string]string{
+		"ldquo":  "\u201C",
+		"rdquo":  "\u201D",
+		"ndash":  "-",
+		"mdash":  "-",
+		"hellip": "\u2026",
+	}
+	return dec
+}
+
+// rootElement returns the name of the first start element in b.
+func rootElement(b []byte) (xml.Name, error) {
+	dec := newDecoder(b)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return xml.Name{}, err
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			return se.Name, nil
+		}
+	}
+}
+
+func parseRSS(b []byte) (*RSSFeed, error) {
+	var parsed RSSFeed
+	if err := newDecoder(b).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("xml unmarshal: %w", err)
+	}
+	for i, item := range parsed.Channel.Item {
+		parsed.Channel.Item[i].GUID = strings.TrimSpace(item.GUID)
+		parsed.Channel.Item[i].Categories = trimAll(item.Categories)
+		if strings.TrimSpace(item.Author) == "" {
+			parsed.Channel.Item[i].Author = strings.TrimSpace(item.Creator)
+		}
+		// <guid> defaults to isPermaLink="true", so it doubles as the link
+		// for items that omit <link>.
+		if strings.TrimSpace(item.Link) == "" && isHTTPURL(parsed.Channel.Item[i].GUID) {
+			parsed.Channel.Item[i].Link = parsed.Channel.Item[i].GUID
+		}
+	}
 	return &parsed, nil
 }
+
+// trimAll returns the non-blank values of ss with surrounding space removed.
+func trimAll(ss []string) []string {
+	var out []string
+	for _, s := range ss {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -11,7 +11,7 @@ import (
 )
 
 const sampleRSS = `<?xml version="1.0" encoding="UTF-8" ?>
-<rss xmlns:atom="http://www.w3.org/2005/Atom" version="2.0">
+<rss xmlns:atom="http://www.w3.org/2005/Atom" xmlns:dc="http://purl.org/dc/elements/1.1/" version="2.0">
 <channel>
   <title>RSS Feed Example &amp; &ldquo;Quote&rdquo;</title>
   <link>https://www.example.com</link>
@@ -21,6 +21,9 @@ const sampleRSS = `<?xml version="1.0" encoding="UTF-8" ?>
     <link>https://www.example.com/article1</link>
     <description>This is the content of the first article.</description>
     <pubDate>Mon, 06 Sep 2021 12:00:00 GMT</pubDate>
+    <dc:creator>Jane Writer</dc:creator>
+    <category>News</category>
+    <category domain="https://www.example.com/tags"> Go </category>
   </item>
   <item>
     <title>Second Article</title>
@@ -54,4 +57,12 @@ func TestFetchFeed(t *testing.T) {
 	if len(f.Channel.Item) != 2 {
 		t.Fatalf("expected 2 items, got %d", len(f.Channel.Item))
 	}
+
+	first := f.Channel.Item[0]
+	if first.Author != "Jane Writer" {
+		t.Errorf("expected dc:creator as author, got %q", first.Author)
+	}
+	if len(first.Categories) != 2 || first.Categories[0] != "News" || first.Categories[1] != "Go" {
+		t.Errorf("unexpected categories %v", first.Categories)
+	}
 }
@@ -2,6 +2,7 @@ package feed_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -17,9 +18,14 @@ func TestFetchFeed_Non200(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	if _, err := feed.FetchFeed(context.Background(), srv.URL); err == nil {
+	_, err := feed.FetchFeed(context.Background(), srv.URL)
+	if err == nil {
 		t.Fatalf("expected error for non-200 status")
 	}
+	var httpErr *feed.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected HTTPError with status 500, got %v", err)
+	}
 }
 
 func TestFetchFeed_BadXML(t *testing.T) {
@@ -0,0 +1,96 @@
+package feed
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PollHints are the publisher's suggestions for how often to poll a feed.
+type PollHints struct {
+	// MinInterval is the shortest interval the publisher asks for, from
+	// RSS <ttl> or the syndication module; zero when none is given.
+	MinInterval time.Duration
+	// SkipHours are the UTC hours (0-23) during which not to poll.
+	SkipHours map[int]bool
+	// SkipDays are the UTC weekdays during which not to poll.
+	SkipDays map[time.Weekday]bool
+}
+
+// PollHints collects the polling hints from the channel. Unparseable values
+// are ignored. When both <ttl> and sy:updatePeriod are present the longer
+// interval wins.
+func (f *RSSFeed) PollHints() PollHints {
+	h := PollHints{SkipHours: map[int]bool{}, SkipDays: map[time.Weekday]bool{}}
+	c := f.Channel
+
+	if ttl, err := strconv.Atoi(strings.TrimSpace(c.TTL)); err == nil && ttl > 0 {
+		h.MinInterval = time.Duration(ttl) * time.Minute
+	}
+	if period := syndicationInterval(c.UpdatePeriod, c.UpdateFrequency); period > h.MinInterval {
+		h.MinInterval = period
+	}
+
+	for _, hour := range c.SkipHours {
+		// RSS uses 0-23; some feeds use 24 for midnight.
+		if n, err := strconv.Atoi(strings.TrimSpace(hour)); err == nil && n >= 0 && n <= 24 {
+			h.SkipHours[n%24] = true
+		}
+	}
+	for _, day := range c.SkipDays {
+		if wd, ok := weekdays[strings.ToLower(strings.TrimSpace(day))]; ok {
+			h.SkipDays[wd] = true
+		}
+	}
+	return h
+}
+
+// Skips reports whether t falls in a skipped hour or day.
+func (h PollHints) Skips(t time.Time) bool {
+	t = t.UTC()
+	return h.SkipHours[t.Hour()] || h.SkipDays[t.Weekday()]
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// syndicationInterval converts sy:updatePeriod / sy:updateFrequency into an
+// interval. The period defaults to daily and the frequency to 1.
+func syndicationInterval(period, frequency string) time.Duration {
+	period = strings.ToLower(strings.TrimSpace(period))
+	frequency = strings.TrimSpace(frequency)
+	if period == "" && frequency == "" {
+		return 0
+	}
+
+	var base time.Duration
+	switch period {
+	case "hourly":
+		base = time.Hour
+	case "", "daily":
+		base = 24 * time.Hour
+	case "weekly":
+		base = 7 * 24 * time.Hour
+	case "monthly":
+		base = 30 * 24 * time.Hour
+	case "yearly":
+		base = 365 * 24 * time.Hour
+	default:
+		return 0
+	}
+
+	n := 1
+	if frequency != "" {
+		if v, err := strconv.Atoi(frequency); err == nil && v > 0 {
+			n = v
+		}
+	}
+	return base / time.Duration(n)
+}
@@ -0,0 +1,41 @@
+package feed_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/markcromwell/gator/internal/feed"
+)
+
+func TestPollHints(t *testing.T) {
+	const doc = `<rss version="2.0" xmlns:sy="http://purl.org/rss/1.0/modules/syndication/">
+<channel>
+  <title>hinted</title>
+  <ttl>60</ttl>
+  <sy:updatePeriod>daily</sy:updatePeriod>
+  <sy:updateFrequency>4</sy:updateFrequency>
+  <skipHours><hour>0</hour><hour>24</hour><hour>3</hour></skipHours>
+  <skipDays><day>Sunday</day></skipDays>
+</channel>
+</rss>`
+
+	f, err := feed.Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	h := f.PollHints()
+
+	// daily/4 = 6h is longer than the 60 minute ttl
+	if h.MinInterval != 6*time.Hour {
+		t.Errorf("expected 6h min interval, got %s", h.MinInterval)
+	}
+	if !h.SkipHours[0] || !h.SkipHours[3] || len(h.SkipHours) != 2 {
+		t.Errorf("unexpected skip hours: %v", h.SkipHours)
+	}
+	if !h.Skips(time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected Sunday to be skipped")
+	}
+	if h.Skips(time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("did not expect Monday noon to be skipped")
+	}
+}
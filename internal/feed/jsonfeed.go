@@ -0,0 +1,180 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// JSONFeed is a JSON Feed document (https://jsonfeed.org, versions 1.0 and 1.1).
+type JSONFeed struct {
+	Version     string `json:"version"`
+	Title       string `json:"title"`
+	HomePageURL string `json:"home_page_url"`
+	FeedURL     string `json:"feed_url"`
+	Description string `json:"description"`
+	// Author is the JSON Feed 1.0 single author; 1.1 uses Authors.
+	Author  *JSONFeedAuthor  `json:"author"`
+	Authors []JSONFeedAuthor `json:"authors"`
+	Items   []JSONFeedItem   `json:"items"`
+}
+
+// JSONFeedItem is a single entry in a JSON Feed's items array.
+type JSONFeedItem struct {
+	ID            jsonString           `json:"id"`
+	URL           string               `json:"url"`
+	ExternalURL   string               `json:"external_url"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	ContentText   string               `json:"content_text"`
+	Summary       string               `json:"summary"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Author        *JSONFeedAuthor      `json:"author"`
+	Authors       []JSONFeedAuthor     `json:"authors"`
+	Tags          []string             `json:"tags"`
+	Attachments   []JSONFeedAttachment `json:"attachments"`
+}
+
+// JSONFeedAuthor describes an author of a feed or item.
+type JSONFeedAuthor struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Avatar string `json:"avatar"`
+}
+
+// JSONFeedAttachment is a related resource such as a podcast episode.
+type JSONFeedAttachment struct {
+	URL         string  `json:"url"`
+	MimeType    string  `json:"mime_type"`
+	Title       string  `json:"title"`
+	SizeInBytes float64 `json:"size_in_bytes"`
+}
+
+// jsonString accepts either a JSON string or number. The spec requires item
+// ids to be strings but numeric ids are common in the wild.
+type jsonString string
+
+func (s *jsonString) UnmarshalJSON(b []byte) error {
+	var str string
+	if err := json.Unmarshal(b, &str); err == nil {
+		*s = jsonString(str)
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(b, &num); err != nil {
+		return err
+	}
+	*s = jsonString(num.String())
+	return nil
+}
+
+// isJSONFeedType reports whether a Content-Type header names a JSON document.
+func isJSONFeedType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/feed+json" || mediaType == "application/json"
+}
+
+// looksLikeJSON reports whether the first non-space byte of b (after an
+// optional UTF-8 byte order mark) opens a JSON object.
+func looksLikeJSON(b []byte) bool {
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+	b = bytes.TrimLeft(b, " \t\r\n")
+	return len(b) > 0 && b[0] == '{'
+}
+
+func parseJSONFeed(b []byte) (*RSSFeed, error) {
+	var j JSONFeed
+	if err := json.Unmarshal(bytes.TrimPrefix(b, []byte("\xef\xbb\xbf")), &j); err != nil {
+		return nil, fmt.Errorf("json unmarshal: %w", err)
+	}
+	if !strings.HasPrefix(j.Version, "https://jsonfeed.org/version/") {
+		return nil, fmt.Errorf("json unmarshal: not a JSON Feed (version %q)", j.Version)
+	}
+	return j.toRSS(), nil
+}
+
+// toRSS maps the JSON Feed onto the RSSFeed model. Items without their own
+// authors inherit the feed's.
+func (j *JSONFeed) toRSS() *RSSFeed {
+	var out RSSFeed
+	out.Channel.Title = j.Title
+	out.Channel.Link = j.HomePageURL
+	out.Channel.Description = j.Description
+
+	feedAuthors := jsonFeedAuthors(j.Author, j.Authors)
+
+	items := make([]RSSItem, 0, len(j.Items))
+	for _, it := range j.Items {
+		link := it.URL
+		if link == "" {
+			link = it.ExternalURL
+		}
+		if link == "" && isHTTPURL(string(it.ID)) {
+			link = string(it.ID)
+		}
+		link = resolveRef(link, j.HomePageURL, j.FeedURL)
+
+		content := it.ContentHTML
+		if content == "" {
+			content = it.ContentText
+		}
+
+		date := it.DatePublished
+		if date == "" {
+			date = it.DateModified
+		}
+
+		authors := jsonFeedAuthors(it.Author, it.Authors)
+		if authors == "" {
+			authors = feedAuthors
+		}
+
+		var enclosures []RSSEnclosure
+		for _, a := range it.Attachments {
+			if a.URL == "" {
+				continue
+			}
+			var length string
+			if a.SizeInBytes > 0 {
+				length = strconv.FormatInt(int64(a.SizeInBytes), 10)
+			}
+			enclosures = append(enclosures, RSSEnclosure{URL: a.URL, Length: length, Type: a.MimeType})
+		}
+
+		items = append(items, RSSItem{
+			GUID:        strings.TrimSpace(string(it.ID)),
+			Title:       it.Title,
+			Link:        link,
+			Description: it.Summary,
+			PubDate:     date,
+			Content:     content,
+			Author:      authors,
+			Categories:  trimAll(it.Tags),
+			Enclosures:  enclosures,
+		})
+	}
+	out.Channel.Item = items
+	return &out
+}
+
+// jsonFeedAuthors joins the names of the 1.1 authors array, falling back to
+// the 1.0 author object.
+func jsonFeedAuthors(single *JSONFeedAuthor, many []JSONFeedAuthor) string {
+	if len(many) == 0 && single != nil {
+		many = []JSONFeedAuthor{*single}
+	}
+	names := make([]string, 0, len(many))
+	for _, a := range many {
+		if name := strings.TrimSpace(a.Name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
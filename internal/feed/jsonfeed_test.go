@@ -0,0 +1,103 @@
+package feed_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/markcromwell/gator/internal/feed"
+)
+
+const sampleJSONFeed = `{
+  "version": "https://jsonfeed.org/version/1.1",
+  "title": "My Example Feed",
+  "home_page_url": "https://example.org/",
+  "feed_url": "https://example.org/feed.json",
+  "authors": [{"name": "Site Owner"}],
+  "items": [
+    {
+      "id": "2",
+      "url": "https://example.org/second-item",
+      "title": "Second item",
+      "content_html": "<p>Hello, world!</p>",
+      "summary": "A greeting",
+      "date_published": "2024-05-02T10:00:00-07:00",
+      "authors": [{"name": "Jane"}, {"name": "John"}],
+      "tags": ["greetings", " "],
+      "attachments": [
+        {"url": "https://example.org/ep2.mp3", "mime_type": "audio/mpeg", "size_in_bytes": 12345}
+      ]
+    },
+    {
+      "id": 1,
+      "external_url": "https://elsewhere.example.com/story",
+      "content_text": "Plain text body",
+      "date_modified": "2024-05-01T10:00:00Z"
+    }
+  ]
+}`
+
+func TestParseJSONFeed(t *testing.T) {
+	f, err := feed.Parse([]byte(sampleJSONFeed))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if f.Channel.Title != "My Example Feed" || f.Channel.Link != "https://example.org/" {
+		t.Errorf("unexpected channel: %+v", f.Channel)
+	}
+	if len(f.Channel.Item) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(f.Channel.Item))
+	}
+
+	first := f.Channel.Item[0]
+	if first.Link != "https://example.org/second-item" || first.Title != "Second item" {
+		t.Errorf("unexpected first item: %+v", first)
+	}
+	if first.Description != "A greeting" || first.Content != "<p>Hello, world!</p>" {
+		t.Errorf("unexpected first item body: %+v", first)
+	}
+	if first.Author != "Jane, John" {
+		t.Errorf("unexpected author %q", first.Author)
+	}
+	if len(first.Categories) != 1 || first.Categories[0] != "greetings" {
+		t.Errorf("expected tags as categories, got %v", first.Categories)
+	}
+	if len(first.Enclosures) != 1 || first.Enclosures[0].Length != "12345" || first.Enclosures[0].Type != "audio/mpeg" {
+		t.Errorf("unexpected enclosures: %+v", first.Enclosures)
+	}
+
+	second := f.Channel.Item[1]
+	if second.Link != "https://elsewhere.example.com/story" {
+		t.Errorf("expected external_url fallback, got %q", second.Link)
+	}
+	if second.Content != "Plain text body" || second.PubDate != "2024-05-01T10:00:00Z" {
+		t.Errorf("unexpected second item: %+v", second)
+	}
+	if second.Author != "Site Owner" {
+		t.Errorf("expected feed author to be inherited, got %q", second.Author)
+	}
+}
+
+func TestParseJSONFeed_NotAFeed(t *testing.T) {
+	if _, err := feed.Parse([]byte(`{"hello": "world"}`)); err == nil {
+		t.Fatalf("expected error for JSON document without a JSON Feed version")
+	}
+}
+
+func TestFetchFeed_JSONFeedContentType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+		fmt.Fprint(w, sampleJSONFeed)
+	}))
+	defer srv.Close()
+
+	f, err := feed.FetchFeed(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("FetchFeed error: %v", err)
+	}
+	if len(f.Channel.Item) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(f.Channel.Item))
+	}
+}
@@ -0,0 +1,90 @@
+package feed
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RDFFeed is an RSS 1.0 (RDF Site Summary) document. Unlike RSS 2.0 the
+// <item> elements are siblings of <channel> under the <rdf:RDF> root, and
+// dates and authors come from the Dublin Core module.
+type RDFFeed struct {
+	Channel RDFChannel `xml:"channel"`
+	Items   []RDFItem  `xml:"item"`
+}
+
+// RDFChannel holds the feed-level metadata of an RSS 1.0 document.
+type RDFChannel struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	// The syndication module originated in RSS 1.0.
+	UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+	UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+}
+
+// RDFItem is a single RSS 1.0 <item>.
+type RDFItem struct {
+	About       string   `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creators    []string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Subjects    []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+}
+
+func parseRDF(b []byte) (*RSSFeed, error) {
+	var r RDFFeed
+	if err := newDecoder(b).Decode(&r); err != nil {
+		return nil, fmt.Errorf("xml unmarshal: %w", err)
+	}
+	return r.toRSS(), nil
+}
+
+// toRSS maps the RDF document onto the RSSFeed model. Items without a
+// <link> fall back to their rdf:about URI, and items without dc:creator
+// inherit the channel's.
+func (r *RDFFeed) toRSS() *RSSFeed {
+	var out RSSFeed
+	out.Channel.Title = strings.TrimSpace(r.Channel.Title)
+	out.Channel.Link = strings.TrimSpace(r.Channel.Link)
+	out.Channel.Description = strings.TrimSpace(r.Channel.Description)
+	out.Channel.UpdatePeriod = r.Channel.UpdatePeriod
+	out.Channel.UpdateFrequency = r.Channel.UpdateFrequency
+
+	items := make([]RSSItem, 0, len(r.Items))
+	for _, it := range r.Items {
+		link := strings.TrimSpace(it.Link)
+		if link == "" && isHTTPURL(it.About) {
+			link = it.About
+		}
+
+		creators := make([]string, 0, len(it.Creators))
+		for _, c := range it.Creators {
+			if c = strings.TrimSpace(c); c != "" {
+				creators = append(creators, c)
+			}
+		}
+		author := strings.Join(creators, ", ")
+		if author == "" {
+			author = strings.TrimSpace(r.Channel.Creator)
+		}
+
+		items = append(items, RSSItem{
+			GUID:        strings.TrimSpace(it.About),
+			Title:       strings.TrimSpace(it.Title),
+			Link:        link,
+			Description: strings.TrimSpace(it.Description),
+			PubDate:     strings.TrimSpace(it.Date),
+			Content:     strings.TrimSpace(it.Content),
+			Author:      author,
+			Categories:  trimAll(it.Subjects),
+		})
+	}
+	out.Channel.Item = items
+	return &out
+}
@@ -0,0 +1,74 @@
+package feed_test
+
+import (
+	"testing"
+
+	"github.com/markcromwell/gator/internal/feed"
+)
+
+const sampleRDF = `<?xml version="1.0" encoding="UTF-8"?>
+<rdf:RDF
+  xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+  xmlns:dc="http://purl.org/dc/elements/1.1/"
+  xmlns="http://purl.org/rss/1.0/">
+  <channel rdf:about="https://journal.example.org/rss">
+    <title>Journal of Examples</title>
+    <link>https://journal.example.org/</link>
+    <description>Latest articles</description>
+    <dc:creator>Editorial Office</dc:creator>
+    <items>
+      <rdf:Seq>
+        <rdf:li rdf:resource="https://journal.example.org/a/1"/>
+        <rdf:li rdf:resource="https://journal.example.org/a/2"/>
+      </rdf:Seq>
+    </items>
+  </channel>
+  <item rdf:about="https://journal.example.org/a/1">
+    <title>On the Nature of Examples</title>
+    <link>https://journal.example.org/a/1</link>
+    <description>An abstract.</description>
+    <dc:date>2024-03-01T09:30+01:00</dc:date>
+    <dc:creator>A. Author</dc:creator>
+    <dc:creator>B. Author</dc:creator>
+    <dc:subject>Methodology</dc:subject>
+  </item>
+  <item rdf:about="https://journal.example.org/a/2">
+    <title>Second Article</title>
+    <dc:date>2024-03-02</dc:date>
+  </item>
+</rdf:RDF>`
+
+func TestParseRDF(t *testing.T) {
+	f, err := feed.Parse([]byte(sampleRDF))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if f.Channel.Title != "Journal of Examples" || f.Channel.Link != "https://journal.example.org/" {
+		t.Errorf("unexpected channel: %+v", f.Channel)
+	}
+	if len(f.Channel.Item) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(f.Channel.Item))
+	}
+
+	first := f.Channel.Item[0]
+	if first.Title != "On the Nature of Examples" || first.Description != "An abstract." {
+		t.Errorf("unexpected first item: %+v", first)
+	}
+	if first.PubDate != "2024-03-01T09:30+01:00" {
+		t.Errorf("expected dc:date as pub date, got %q", first.PubDate)
+	}
+	if first.Author != "A. Author, B. Author" {
+		t.Errorf("unexpected author %q", first.Author)
+	}
+	if len(first.Categories) != 1 || first.Categories[0] != "Methodology" {
+		t.Errorf("expected dc:subject as category, got %v", first.Categories)
+	}
+
+	second := f.Channel.Item[1]
+	if second.Link != "https://journal.example.org/a/2" {
+		t.Errorf("expected rdf:about link fallback, got %q", second.Link)
+	}
+	if second.Author != "Editorial Office" {
+		t.Errorf("expected channel creator to be inherited, got %q", second.Author)
+	}
+}
@@ -0,0 +1,365 @@
+// Package fever implements the Fever API, which mobile readers such as
+// Reeder and NetNewsWire use to sync subscriptions, items, read state and
+// saved (starred) items.
+//
+// Fever identifies feeds and items by integer, so feeds and posts are
+// exposed by their seq column. Groups are the folders of a user's follows;
+// a group's ID is a hash of its folder path, so it stays the same while the
+// folder exists. Favicons, links and sparks are not supported and are
+// always empty.
+package fever
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/markcromwell/gator/internal/database"
+)
+
+// APIVersion is the Fever API version reported to clients.
+const APIVersion = 3
+
+// maxItems is the most items answered per request, as in Fever.
+const maxItems = 50
+
+// Handler answers Fever API requests.
+type Handler struct {
+	DB *database.Queries
+	// Out receives errors; os.Stdout when nil.
+	Out io.Writer
+}
+
+// APIKey returns the key a Fever client sends for username and password:
+// the hex MD5 of "username:password".
+func APIKey(username, password string) string {
+	sum := md5.Sum([]byte(username + ":" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+type group struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+type feedsGroup struct {
+	GroupID int64  `json:"group_id"`
+	FeedIDs string `json:"feed_ids"`
+}
+
+type feed struct {
+	ID                int64  `json:"id"`
+	FaviconID         int64  `json:"favicon_id"`
+	Title             string `json:"title"`
+	URL               string `json:"url"`
+	SiteURL           string `json:"site_url"`
+	IsSpark           int    `json:"is_spark"`
+	LastUpdatedOnTime int64  `json:"last_updated_on_time"`
+}
+
+type item struct {
+	ID            int64  `json:"id"`
+	FeedID        int64  `json:"feed_id"`
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	HTML          string `json:"html"`
+	URL           string `json:"url"`
+	IsSaved       int    `json:"is_saved"`
+	IsRead        int    `json:"is_read"`
+	CreatedOnTime int64  `json:"created_on_time"`
+}
+
+// internalError reports err to Out and answers 500 without the details,
+// which may come from the database.
+func (h *Handler) internalError(w http.ResponseWriter, r *http.Request, err error) {
+	out := h.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintf(out, "Error serving %s %s: %v\n", r.Method, r.URL.Path, err)
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
+
+// ServeHTTP answers a Fever request. Parameters may be in the query string
+// or the form body; the api_key is checked first, and writes (mark) happen
+// before the requested lists are read.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	if !r.Form.Has("api") {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	resp := map[string]any{"api_version": APIVersion, "auth": 0}
+	user, err := h.DB.GetUserByFeverAPIKey(ctx, strings.ToLower(r.Form.Get("api_key")))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSON(w, resp)
+		return
+	}
+	if err != nil {
+		h.internalError(w, r, err)
+		return
+	}
+	resp["auth"] = 1
+
+	feeds, err := h.DB.GetFeverFeeds(ctx, user.ID)
+	if err != nil {
+		h.internalError(w, r, err)
+		return
+	}
+	var lastRefreshed time.Time
+	for _, f := range feeds {
+		if f.LastFetchedAt.Valid && f.LastFetchedAt.Time.After(lastRefreshed) {
+			lastRefreshed = f.LastFetchedAt.Time
+		}
+	}
+	resp["last_refreshed_on_time"] = unix(lastRefreshed)
+
+	if r.Form.Has("mark") {
+		if err := h.mark(ctx, r, user, feeds); err != nil {
+			h.internalError(w, r, err)
+			return
+		}
+	}
+
+	if r.Form.Has("groups") {
+		resp["groups"] = groups(feeds)
+		resp["feeds_groups"] = feedsGroups(feeds)
+	}
+	if r.Form.Has("feeds") {
+		out := make([]feed, 0, len(feeds))
+		for _, f := range feeds {
+			out = append(out, feed{
+				ID:                f.Seq,
+				Title:             f.Name,
+				URL:               f.Url,
+				SiteURL:           f.Url,
+				LastUpdatedOnTime: unix(f.LastFetchedAt.Time),
+			})
+		}
+		resp["feeds"] = out
+		resp["feeds_groups"] = feedsGroups(feeds)
+	}
+	if r.Form.Has("favicons") {
+		resp["favicons"] = []any{}
+	}
+	if r.Form.Has("links") {
+		resp["links"] = []any{}
+	}
+	if r.Form.Has("items") {
+		items, total, err := h.items(ctx, r, user)
+		if err != nil {
+			h.internalError(w, r, err)
+			return
+		}
+		resp["items"] = items
+		resp["total_items"] = total
+	}
+	if r.Form.Has("unread_item_ids") {
+		ids, err := h.DB.GetFeverUnreadItemIDs(ctx, user.ID)
+		if err != nil {
+			h.internalError(w, r, err)
+			return
+		}
+		resp["unread_item_ids"] = joinIDs(ids)
+	}
+	if r.Form.Has("saved_item_ids") {
+		ids, err := h.DB.GetFeverSavedItemIDs(ctx, user.ID)
+		if err != nil {
+			h.internalError(w, r, err)
+			return
+		}
+		resp["saved_item_ids"] = joinIDs(ids)
+	}
+	writeJSON(w, resp)
+}
+
+// items answers an items request: since_id, max_id or with_ids (at most
+// 50, comma-separated) select which.
+func (h *Handler) items(ctx context.Context, r *http.Request, user database.User) ([]item, int64, error) {
+	params := database.GetFeverItemsParams{UserID: user.ID, Limit: maxItems}
+	if id, err := strconv.ParseInt(r.Form.Get("since_id"), 10, 64); err == nil {
+		params.SinceID = sql.NullInt64{Int64: id, Valid: true}
+	}
+	if id, err := strconv.ParseInt(r.Form.Get("max_id"), 10, 64); err == nil && id > 0 {
+		params.MaxID = sql.NullInt64{Int64: id, Valid: true}
+	}
+	if v := r.Form.Get("with_ids"); v != "" {
+		params.WithIds = []int64{}
+		for _, s := range strings.Split(v, ",") {
+			if id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil && len(params.WithIds) < maxItems {
+				params.WithIds = append(params.WithIds, id)
+			}
+		}
+	}
+
+	rows, err := h.DB.GetFeverItems(ctx, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := h.DB.CountFeverItems(ctx, user.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	out := make([]item, 0, len(rows))
+	for _, p := range rows {
+		out = append(out, item{
+			ID:            p.Seq,
+			FeedID:        p.FeedSeq,
+			Title:         p.Title,
+			Author:        p.Author.String,
+			HTML:          p.Description.String,
+			URL:           p.Url,
+			IsSaved:       boolInt(p.Starred),
+			IsRead:        boolInt(p.Read),
+			CreatedOnTime: unix(p.PublishedAt),
+		})
+	}
+	return out, total, nil
+}
+
+// mark applies a write: mark=item with as=read, unread, saved or unsaved,
+// or mark=feed or mark=group with as=read and before, a Unix time. Group 0
+// is every followed feed. Unknown IDs are ignored, as Fever does, and so are
+// items in feeds the user does not follow.
+func (h *Handler) mark(ctx context.Context, r *http.Request, user database.User, feeds []database.GetFeverFeedsRow) error {
+	id, err := strconv.ParseInt(r.Form.Get("id"), 10, 64)
+	if err != nil {
+		return nil
+	}
+	as := r.Form.Get("as")
+
+	switch r.Form.Get("mark") {
+	case "item":
+		postID, err := h.DB.GetPostIDBySeqForUser(ctx, database.GetPostIDBySeqForUserParams{UserID: user.ID, Seq: id})
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch as {
+		case "read", "unread":
+			return h.DB.SetPostRead(ctx, database.SetPostReadParams{UserID: user.ID, PostID: postID, Read: as == "read"})
+		case "saved", "unsaved":
+			return h.DB.SetPostStarred(ctx, database.SetPostStarredParams{UserID: user.ID, PostID: postID, Starred: as == "saved"})
+		}
+	case "feed", "group":
+		if as != "read" {
+			return nil
+		}
+		params := database.MarkFeedsReadBeforeParams{UserID: user.ID, Before: time.Now().UTC()}
+		if before, err := strconv.ParseInt(r.Form.Get("before"), 10, 64); err == nil && before > 0 {
+			params.Before = time.Unix(before, 0).UTC()
+		}
+		if r.Form.Get("mark") == "feed" {
+			params.FeedSeq = sql.NullInt64{Int64: id, Valid: true}
+		} else if id != 0 {
+			folder, ok := folderForGroup(feeds, id)
+			if !ok {
+				return nil
+			}
+			params.Folder = sql.NullString{String: folder, Valid: true}
+		}
+		_, err := h.DB.MarkFeedsReadBefore(ctx, params)
+		return err
+	}
+	return nil
+}
+
+// groupID returns the Fever group ID for a folder path: a positive 31-bit
+// hash, so clients storing IDs in 32-bit integers are safe.
+func groupID(folder string) int64 {
+	h := fnv.New32a()
+	h.Write([]byte(folder))
+	id := int64(h.Sum32() & 0x7fffffff)
+	if id == 0 {
+		id = 1
+	}
+	return id
+}
+
+func groups(feeds []database.GetFeverFeedsRow) []group {
+	out := []group{}
+	seen := map[string]bool{}
+	for _, f := range feeds {
+		if !f.Folder.Valid || seen[f.Folder.String] {
+			continue
+		}
+		seen[f.Folder.String] = true
+		out = append(out, group{ID: groupID(f.Folder.String), Title: f.Folder.String})
+	}
+	return out
+}
+
+func feedsGroups(feeds []database.GetFeverFeedsRow) []feedsGroup {
+	out := []feedsGroup{}
+	index := map[string]int{}
+	for _, f := range feeds {
+		if !f.Folder.Valid {
+			continue
+		}
+		i, ok := index[f.Folder.String]
+		if !ok {
+			i = len(out)
+			index[f.Folder.String] = i
+			out = append(out, feedsGroup{GroupID: groupID(f.Folder.String)})
+		}
+		if out[i].FeedIDs != "" {
+			out[i].FeedIDs += ","
+		}
+		out[i].FeedIDs += strconv.FormatInt(f.Seq, 10)
+	}
+	return out
+}
+
+func folderForGroup(feeds []database.GetFeverFeedsRow, id int64) (string, bool) {
+	for _, f := range feeds {
+		if f.Folder.Valid && groupID(f.Folder.String) == id {
+			return f.Folder.String, true
+		}
+	}
+	return "", false
+}
+
+func joinIDs(ids []int64) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(s, ",")
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
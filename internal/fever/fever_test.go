@@ -0,0 +1,219 @@
+package fever_test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/fever"
+)
+
+var feverFeedColumns = []string{"seq", "name", "url", "folder", "last_fetched_at"}
+
+func newHandler(t *testing.T) (*fever.Handler, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &fever.Handler{DB: database.New(db)}, mock
+}
+
+// expectLogin expects bob's API key lookup and his followed feeds.
+func expectLogin(mock sqlmock.Sqlmock, userID uuid.UUID, fetched time.Time) {
+	mock.ExpectQuery(`(?i)FROM users\s+JOIN fever_credentials`).
+		WithArgs(fever.APIKey("bob", "hunter2")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "name"}).
+			AddRow(userID, fetched, fetched, "bob"))
+	mock.ExpectQuery(`(?i)SELECT f.seq, f.name`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows(feverFeedColumns).
+			AddRow(int64(1), "Go Blog", "https://go.dev/blog/feed.atom", "Tech/Go", fetched).
+			AddRow(int64(2), "xkcd", "https://xkcd.com/rss.xml", nil, nil).
+			AddRow(int64(3), "Rust Blog", "https://blog.rust-lang.org/feed.xml", "Tech/Go", nil))
+}
+
+func post(t *testing.T, h *fever.Handler, query string, form url.Values) map[string]any {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/fever/?"+query, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	return resp
+}
+
+func login() url.Values {
+	return url.Values{"api_key": {fever.APIKey("bob", "hunter2")}}
+}
+
+func TestAPIKey(t *testing.T) {
+	// echo -n "bob:hunter2" | md5sum
+	if got, want := fever.APIKey("bob", "hunter2"), "d39a872bee9499af9e1e70db437dd86b"; got != want {
+		t.Errorf("APIKey = %q, want %q", got, want)
+	}
+}
+
+func TestServeHTTP_Auth(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery(`(?i)FROM users\s+JOIN fever_credentials`).
+		WithArgs("wrong").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "name"}))
+
+	resp := post(t, h, "api", url.Values{"api_key": {"WRONG"}})
+	if resp["auth"] != float64(0) || resp["api_version"] != float64(3) {
+		t.Errorf("unexpected response %v", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestServeHTTP_GroupsAndFeeds(t *testing.T) {
+	h, mock := newHandler(t)
+	fetched := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	expectLogin(mock, uuid.New(), fetched)
+
+	resp := post(t, h, "api&groups&feeds", login())
+	if resp["auth"] != float64(1) || resp["last_refreshed_on_time"] != float64(fetched.Unix()) {
+		t.Fatalf("unexpected response %v", resp)
+	}
+	groups := resp["groups"].([]any)
+	if len(groups) != 1 || groups[0].(map[string]any)["title"] != "Tech/Go" {
+		t.Errorf("unexpected groups %v", groups)
+	}
+	feedsGroups := resp["feeds_groups"].([]any)
+	if len(feedsGroups) != 1 || feedsGroups[0].(map[string]any)["feed_ids"] != "1,3" ||
+		feedsGroups[0].(map[string]any)["group_id"] != groups[0].(map[string]any)["id"] {
+		t.Errorf("unexpected feeds_groups %v", feedsGroups)
+	}
+	if feeds := resp["feeds"].([]any); len(feeds) != 3 || feeds[1].(map[string]any)["title"] != "xkcd" {
+		t.Errorf("unexpected feeds %v", feeds)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestServeHTTP_Items(t *testing.T) {
+	h, mock := newHandler(t)
+	userID := uuid.New()
+	published := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	expectLogin(mock, userID, published)
+	mock.ExpectQuery(`(?i)FROM posts p\s+JOIN feed_follows .+LIMIT`).
+		WithArgs(userID, sql.NullInt64{Int64: 41, Valid: true}, sql.NullInt64{}, nil, int32(50)).
+		WillReturnRows(sqlmock.NewRows([]string{"seq", "feed_seq", "title", "author", "description", "url", "published_at", "read", "starred"}).
+			AddRow(int64(42), int64(1), "Go 1.23", "gopher", "<p>Iterators</p>", "https://go.dev/blog/go1.23", published, false, true))
+	mock.ExpectQuery(`(?i)SELECT COUNT\(\*\)`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(120)))
+	mock.ExpectQuery(`(?i)WHERE ups.read IS NOT TRUE`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"seq"}).AddRow(int64(42)).AddRow(int64(43)))
+
+	resp := post(t, h, "api&items&since_id=41&unread_item_ids", login())
+	items := resp["items"].([]any)
+	if len(items) != 1 || resp["total_items"] != float64(120) {
+		t.Fatalf("unexpected response %v", resp)
+	}
+	it := items[0].(map[string]any)
+	if it["id"] != float64(42) || it["feed_id"] != float64(1) || it["html"] != "<p>Iterators</p>" ||
+		it["is_saved"] != float64(1) || it["is_read"] != float64(0) || it["created_on_time"] != float64(published.Unix()) {
+		t.Errorf("unexpected item %v", it)
+	}
+	if resp["unread_item_ids"] != "42,43" {
+		t.Errorf("unread_item_ids = %v, want 42,43", resp["unread_item_ids"])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestServeHTTP_Mark(t *testing.T) {
+	h, mock := newHandler(t)
+	userID, postID := uuid.New(), uuid.New()
+	now := time.Now()
+
+	// saving an item stars its post
+	expectLogin(mock, userID, now)
+	mock.ExpectQuery(`(?i)FROM posts p\s+JOIN feed_follows ff .+p.seq`).
+		WithArgs(userID, int64(42)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(postID))
+	mock.ExpectExec(`(?i)INSERT INTO user_post_state .+starred`).
+		WithArgs(userID, postID, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	form := login()
+	form.Set("mark", "item")
+	form.Set("as", "saved")
+	form.Set("id", "42")
+	post(t, h, "api", form)
+
+	// an item in a feed the user does not follow is left alone
+	expectLogin(mock, userID, now)
+	mock.ExpectQuery(`(?i)FROM posts p\s+JOIN feed_follows ff .+p.seq`).
+		WithArgs(userID, int64(43)).
+		WillReturnError(sql.ErrNoRows)
+	form.Set("id", "43")
+	post(t, h, "api", form)
+
+	// marking a group read marks its folder read before the given time
+	expectLogin(mock, userID, now)
+	groupID := post(t, h, "api&groups", login())["groups"].([]any)[0].(map[string]any)["id"].(float64)
+	expectLogin(mock, userID, now)
+	mock.ExpectExec(`(?i)INSERT INTO user_post_state .+SELECT ff.user_id`).
+		WithArgs(userID, sql.NullInt64{}, sql.NullString{String: "Tech/Go", Valid: true}, time.Unix(1714560000, 0).UTC()).
+		WillReturnResult(sqlmock.NewResult(0, 7))
+	form = login()
+	form.Set("mark", "group")
+	form.Set("as", "read")
+	form.Set("id", strconv.FormatInt(int64(groupID), 10))
+	form.Set("before", "1714560000")
+	post(t, h, "api", form)
+
+	// an unknown group is ignored
+	expectLogin(mock, userID, now)
+	form.Set("id", "7")
+	post(t, h, "api", form)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestInternalErrorHidesDetails(t *testing.T) {
+	h, mock := newHandler(t)
+	var out bytes.Buffer
+	h.Out = &out
+	mock.ExpectQuery(`(?i)FROM users\s+JOIN fever_credentials`).
+		WillReturnError(errors.New(`pq: relation "users" does not exist`))
+
+	req := httptest.NewRequest(http.MethodPost, "/fever/?api", strings.NewReader("api_key=x"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "relation") {
+		t.Errorf("status = %d, body %q", rec.Code, rec.Body)
+	}
+	if !strings.Contains(out.String(), `pq: relation "users" does not exist`) {
+		t.Errorf("error not logged: %q", out.String())
+	}
+}
@@ -0,0 +1,162 @@
+// Package filter evaluates the per-user rules that mute, highlight, mark
+// read or star posts as they are scraped.
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+)
+
+// Field is the part of a post a rule matches against.
+type Field string
+
+const (
+	FieldAny         Field = "any"
+	FieldTitle       Field = "title"
+	FieldDescription Field = "description"
+	FieldAuthor      Field = "author"
+	FieldCategory    Field = "category"
+)
+
+// Action is what a matching rule does to a post.
+type Action string
+
+const (
+	ActionMute      Action = "mute"
+	ActionHighlight Action = "highlight"
+	ActionRead      Action = "read"
+	ActionStar      Action = "star"
+)
+
+// Rule matches a pattern against one field of a post. Keyword patterns match
+// case-insensitively anywhere in the field; regex patterns use RE2 syntax as
+// written. A rule with a FeedID only applies to that feed's posts.
+type Rule struct {
+	ID      uuid.UUID
+	FeedID  uuid.NullUUID
+	Field   Field
+	Pattern string
+	Regex   bool
+	Action  Action
+
+	re *regexp.Regexp
+}
+
+// NewRule validates field and action and compiles pattern.
+func NewRule(field, pattern string, regex bool, action string) (Rule, error) {
+	r := Rule{Field: Field(field), Pattern: pattern, Regex: regex, Action: Action(action)}
+	switch r.Field {
+	case FieldAny, FieldTitle, FieldDescription, FieldAuthor, FieldCategory:
+	default:
+		return Rule{}, fmt.Errorf("unknown field %q: want any, title, description, author or category", field)
+	}
+	switch r.Action {
+	case ActionMute, ActionHighlight, ActionRead, ActionStar:
+	default:
+		return Rule{}, fmt.Errorf("unknown action %q: want mute, highlight, read or star", action)
+	}
+	if strings.TrimSpace(pattern) == "" {
+		return Rule{}, fmt.Errorf("empty pattern")
+	}
+	if regex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid regex %q: %w", pattern, err)
+		}
+		r.re = re
+	}
+	return r, nil
+}
+
+// FromDB builds a Rule from a stored filter rule.
+func FromDB(row database.FilterRule) (Rule, error) {
+	r, err := NewRule(row.Field, row.Pattern, row.IsRegex, row.Action)
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %s: %w", row.ID, err)
+	}
+	r.ID = row.ID
+	r.FeedID = row.FeedID
+	return r, nil
+}
+
+// Post holds the parts of a post rules can match.
+type Post struct {
+	FeedID      uuid.UUID
+	Title       string
+	Description string
+	Author      string
+	Categories  []string
+}
+
+// Matches reports whether the rule applies to p.
+func (r Rule) Matches(p Post) bool {
+	if r.FeedID.Valid && r.FeedID.UUID != p.FeedID {
+		return false
+	}
+	for _, value := range r.values(p) {
+		if r.match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) values(p Post) []string {
+	switch r.Field {
+	case FieldTitle:
+		return []string{p.Title}
+	case FieldDescription:
+		return []string{p.Description}
+	case FieldAuthor:
+		return []string{p.Author}
+	case FieldCategory:
+		return p.Categories
+	default:
+		return append([]string{p.Title, p.Description, p.Author}, p.Categories...)
+	}
+}
+
+func (r Rule) match(value string) bool {
+	if r.re != nil {
+		return r.re.MatchString(value)
+	}
+	return strings.Contains(strings.ToLower(value), strings.ToLower(r.Pattern))
+}
+
+// Result is the combined effect of every rule that matched a post.
+type Result struct {
+	Mute      bool
+	Highlight bool
+	Read      bool
+	Star      bool
+}
+
+// Any reports whether some rule matched.
+func (res Result) Any() bool {
+	return res.Mute || res.Highlight || res.Read || res.Star
+}
+
+// Evaluate applies rules to p. Every matching rule contributes its action.
+func Evaluate(rules []Rule, p Post) Result {
+	var res Result
+	for _, r := range rules {
+		if !r.Matches(p) {
+			continue
+		}
+		switch r.Action {
+		case ActionMute:
+			res.Mute = true
+		case ActionHighlight:
+			res.Highlight = true
+		case ActionRead:
+			res.Read = true
+		case ActionStar:
+			res.Star = true
+		}
+	}
+	return res
+}
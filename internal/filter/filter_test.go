@@ -0,0 +1,102 @@
+package filter_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/filter"
+)
+
+func mustRule(t *testing.T, field, pattern string, regex bool, action string) filter.Rule {
+	t.Helper()
+	r, err := filter.NewRule(field, pattern, regex, action)
+	if err != nil {
+		t.Fatalf("NewRule(%q, %q): %v", field, pattern, err)
+	}
+	return r
+}
+
+func TestRuleMatches(t *testing.T) {
+	post := filter.Post{
+		FeedID:      uuid.New(),
+		Title:       "Sponsored: Try our new product",
+		Description: "A word from our sponsor",
+		Author:      "Marketing Team",
+		Categories:  []string{"Ads", "Go"},
+	}
+
+	tests := []struct {
+		name    string
+		field   string
+		pattern string
+		regex   bool
+		want    bool
+	}{
+		{"keyword is case-insensitive", "title", "sponsored", false, true},
+		{"keyword on other field", "description", "product", false, false},
+		{"regex", "title", `^Sponsored:`, true, true},
+		{"regex is case-sensitive", "title", `^sponsored:`, true, false},
+		{"author", "author", "marketing", false, true},
+		{"category", "category", "go", false, true},
+		{"any field", "any", "sponsor", false, true},
+		{"no match", "any", "kubernetes", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mustRule(t, tt.field, tt.pattern, tt.regex, "mute")
+			if got := r.Matches(post); got != tt.want {
+				t.Errorf("Matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleMatches_FeedScope(t *testing.T) {
+	feedID := uuid.New()
+	r, err := filter.FromDB(database.FilterRule{
+		ID:      uuid.New(),
+		FeedID:  uuid.NullUUID{UUID: feedID, Valid: true},
+		Field:   "title",
+		Pattern: "release",
+		Action:  "highlight",
+	})
+	if err != nil {
+		t.Fatalf("FromDB: %v", err)
+	}
+	if !r.Matches(filter.Post{FeedID: feedID, Title: "New release"}) {
+		t.Errorf("expected rule to match its own feed")
+	}
+	if r.Matches(filter.Post{FeedID: uuid.New(), Title: "New release"}) {
+		t.Errorf("expected rule not to match another feed")
+	}
+}
+
+func TestNewRule_Invalid(t *testing.T) {
+	for _, tt := range []struct{ field, pattern, action string }{
+		{"body", "x", "mute"},
+		{"title", "x", "delete"},
+		{"title", " ", "mute"},
+		{"title", "(", "mute"},
+	} {
+		if _, err := filter.NewRule(tt.field, tt.pattern, tt.pattern == "(", tt.action); err == nil {
+			t.Errorf("NewRule(%q, %q, %q): expected error", tt.field, tt.pattern, tt.action)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	rules := []filter.Rule{
+		mustRule(t, "title", "release", false, "highlight"),
+		mustRule(t, "title", "release", false, "star"),
+		mustRule(t, "category", "ads", false, "mute"),
+	}
+
+	res := filter.Evaluate(rules, filter.Post{Title: "v1.0 release"})
+	if !res.Highlight || !res.Star || res.Mute || res.Read {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if res := filter.Evaluate(rules, filter.Post{Title: "nothing to see"}); res.Any() {
+		t.Errorf("expected no match, got %+v", res)
+	}
+}
@@ -0,0 +1,352 @@
+// Package migrate applies the goose-style SQL migrations in sql/schema and
+// records which versions have been applied in the schema_migrations table.
+// Databases created by goose itself are adopted by importing the versions
+// recorded in goose_db_version; ones created by hand are adopted with
+// Baseline.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	upMarker   = "-- +goose Up"
+	downMarker = "-- +goose Down"
+)
+
+// Migration is a single NNN_name.sql file split into its Up and Down SQL.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and when it was applied, if it has been.
+type Status struct {
+	Migration
+	AppliedAt sql.NullTime
+}
+
+// Load reads every .sql file in fsys, ordered by version. File names must
+// start with a numeric version followed by an underscore.
+func Load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(names))
+	seen := make(map[int64]string)
+	for _, name := range names {
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: name must be NNN_description.sql", name)
+		}
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", name, err)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, name, version)
+		}
+		seen[version] = name
+
+		raw, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		up, down, err := split(string(raw))
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", name, err)
+		}
+		migrations = append(migrations, Migration{Version: version, Name: path.Base(name), Up: up, Down: down})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// split returns the SQL between the Up and Down markers and after the Down
+// marker.
+func split(content string) (up, down string, err error) {
+	upIdx := strings.Index(content, upMarker)
+	if upIdx < 0 {
+		return "", "", fmt.Errorf("missing %q", upMarker)
+	}
+	rest := content[upIdx+len(upMarker):]
+	downIdx := strings.Index(rest, downMarker)
+	if downIdx < 0 {
+		return strings.TrimSpace(rest), "", nil
+	}
+	return strings.TrimSpace(rest[:downIdx]), strings.TrimSpace(rest[downIdx+len(downMarker):]), nil
+}
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+// New loads the migrations in fsys for db.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+// Status reports every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Status, 0, len(m.Migrations))
+	for _, mig := range m.Migrations {
+		st := Status{Migration: mig}
+		if at, ok := applied[mig.Version]; ok {
+			st.AppliedAt = sql.NullTime{Time: at, Valid: true}
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// Pending returns the migrations that have not been applied, in order. It
+// does not create the tracking table.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, mig := range m.Migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			pending = append(pending, mig)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration in version order, each in its own
+// transaction, and returns the ones it applied. It stops at the first
+// failure.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mig := range pending {
+		err := m.inTx(ctx, mig.Up, `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`, mig.Version, time.Now().UTC())
+		if err != nil {
+			return done, fmt.Errorf("apply %s: %w", mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Down rolls back the most recently applied migration and returns it, or
+// nil when nothing is applied.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		mig := m.Migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if err := m.inTx(ctx, mig.Down, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version); err != nil {
+			return nil, fmt.Errorf("roll back %s: %w", mig.Name, err)
+		}
+		return &mig, nil
+	}
+	return nil, nil
+}
+
+// Baseline records every migration up to and including version as applied
+// without running it, for a database whose schema was created some other
+// way, and returns the ones it recorded.
+func (m *Migrator) Baseline(ctx context.Context, version int64) ([]Migration, error) {
+	known := false
+	for _, mig := range m.Migrations {
+		known = known || mig.Version == version
+	}
+	if !known {
+		return nil, fmt.Errorf("no migration with version %d", version)
+	}
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var done []Migration
+	now := time.Now().UTC()
+	for _, mig := range m.Migrations {
+		if _, ok := applied[mig.Version]; ok || mig.Version > version {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`, mig.Version, now); err != nil {
+			return nil, fmt.Errorf("record %s: %w", mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// inTx runs the migration SQL and the bookkeeping statement in one
+// transaction.
+func (m *Migrator) inTx(ctx context.Context, migration, record string, args ...any) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if migration != "" {
+		if _, err := tx.ExecContext(ctx, migration); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ensureTable creates the tracking table. When goose managed the database
+// before, the versions it applied are recorded in the same transaction so
+// that they are not run again.
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	exists, err := m.tableExists(ctx, "schema_migrations")
+	if err != nil || exists {
+		return err
+	}
+	imported, err := m.gooseApplied(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL
+)`); err != nil {
+		return err
+	}
+	for version, at := range imported {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`, version, at); err != nil {
+			return fmt.Errorf("import goose version %d: %w", version, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// applied returns the applied versions. A database without the tracking
+// table has none, unless goose managed it: then the versions goose applied
+// count, as ensureTable imports them.
+func (m *Migrator) applied(ctx context.Context) (map[int64]time.Time, error) {
+	exists, err := m.tableExists(ctx, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return m.gooseApplied(ctx)
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// gooseApplied returns the versions applied according to goose_db_version,
+// which logs every up and down: a version is applied when its latest entry
+// is. It is empty when the table does not exist.
+func (m *Migrator) gooseApplied(ctx context.Context) (map[int64]time.Time, error) {
+	applied := make(map[int64]time.Time)
+	exists, err := m.tableExists(ctx, "goose_db_version")
+	if err != nil || !exists {
+		return applied, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT DISTINCT ON (version_id) version_id, is_applied, tstamp
+FROM goose_db_version
+ORDER BY version_id, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("read goose_db_version: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var at sql.NullTime
+		if err := rows.Scan(&version, &isApplied, &at); err != nil {
+			return nil, err
+		}
+		// goose seeds the table with version 0
+		if !isApplied || version == 0 {
+			continue
+		}
+		if !at.Valid {
+			at.Time = time.Now().UTC()
+		}
+		applied[version] = at.Time
+	}
+	return applied, rows.Err()
+}
+
+func (m *Migrator) tableExists(ctx context.Context, name string) (bool, error) {
+	var table sql.NullString
+	if err := m.DB.QueryRowContext(ctx, `SELECT to_regclass($1)::text`, name).Scan(&table); err != nil {
+		return false, fmt.Errorf("check %s: %w", name, err)
+	}
+	return table.Valid, nil
+}
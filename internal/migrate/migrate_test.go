@@ -0,0 +1,263 @@
+package migrate_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/markcromwell/gator/internal/migrate"
+	"github.com/markcromwell/gator/sql/schema"
+)
+
+var testFS = fstest.MapFS{
+	"002_feeds.sql": {Data: []byte("-- +goose Up\nCREATE TABLE feeds (id INT);\n\n-- +goose Down\nDROP TABLE feeds;\n")},
+	"001_users.sql": {Data: []byte("-- +goose Up\nCREATE TABLE users (id INT);\n-- +goose Down\nDROP TABLE users;\n")},
+	"README.md":     {Data: []byte("not a migration")},
+}
+
+func TestLoad(t *testing.T) {
+	migs, err := migrate.Load(testFS)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(migs) != 2 || migs[0].Version != 1 || migs[1].Version != 2 {
+		t.Fatalf("expected versions 1 and 2 in order, got %+v", migs)
+	}
+	if migs[1].Up != "CREATE TABLE feeds (id INT);" || migs[1].Down != "DROP TABLE feeds;" {
+		t.Fatalf("unexpected split: up=%q down=%q", migs[1].Up, migs[1].Down)
+	}
+
+	bad := fstest.MapFS{"users.sql": {Data: []byte("-- +goose Up\nSELECT 1;")}}
+	if _, err := migrate.Load(bad); err == nil {
+		t.Fatalf("expected error for migration without a version")
+	}
+	dup := fstest.MapFS{
+		"001_a.sql": {Data: []byte("-- +goose Up\nSELECT 1;")},
+		"1_b.sql":   {Data: []byte("-- +goose Up\nSELECT 1;")},
+	}
+	if _, err := migrate.Load(dup); err == nil {
+		t.Fatalf("expected error for duplicate versions")
+	}
+}
+
+// TestEmbeddedSchema guards against a migration being added outside
+// sql/schema or with a gap in numbering.
+func TestEmbeddedSchema(t *testing.T) {
+	migs, err := migrate.Load(schema.FS)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for i, m := range migs {
+		if m.Version != int64(i+1) {
+			t.Fatalf("expected version %d, got %s", i+1, m.Name)
+		}
+		if m.Up == "" || m.Down == "" {
+			t.Errorf("%s: missing Up or Down section", m.Name)
+		}
+	}
+}
+
+func TestUpAppliesPending(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db, testFS)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	for range 2 {
+		mock.ExpectQuery(`SELECT to_regclass`).WithArgs("schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow("schema_migrations"))
+	}
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, time.Now()))
+	// only 002 is pending
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE feeds`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(int64(2), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	applied, err := m.Up(context.Background())
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if len(applied) != 1 || applied[0].Name != "002_feeds.sql" {
+		t.Fatalf("unexpected applied migrations: %+v", applied)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDownRollsBackLatest(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db, testFS)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	now := time.Now()
+	for range 2 {
+		mock.ExpectQuery(`SELECT to_regclass`).WithArgs("schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow("schema_migrations"))
+	}
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, now).AddRow(2, now))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DROP TABLE feeds`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM schema_migrations`).WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mig, err := m.Down(context.Background())
+	if err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if mig == nil || mig.Version != 2 {
+		t.Fatalf("expected to roll back version 2, got %+v", mig)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPendingWithoutTrackingTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db, testFS)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// a fresh database: nothing is created, everything is pending
+	mock.ExpectQuery(`SELECT to_regclass`).WithArgs("schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow(nil))
+	mock.ExpectQuery(`SELECT to_regclass`).WithArgs("goose_db_version").WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow(nil))
+
+	pending, err := m.Pending(context.Background())
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("expected 2 pending migrations, got %d", len(pending))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// TestUpImportsGooseVersions adopts a database migrated by goose: the
+// versions it applied are recorded rather than run again.
+func TestUpImportsGooseVersions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db, testFS)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	gooseRows := func() *sqlmock.Rows {
+		// goose seeds version 0; 001 was applied, 002 applied and rolled back
+		return sqlmock.NewRows([]string{"version_id", "is_applied", "tstamp"}).
+			AddRow(0, true, time.Now()).
+			AddRow(1, true, time.Now()).
+			AddRow(2, false, nil)
+	}
+
+	// Pending, as checkSchema calls it, only reads goose's history
+	mock.ExpectQuery(`SELECT to_regclass`).WithArgs("schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow(nil))
+	mock.ExpectQuery(`SELECT to_regclass`).WithArgs("goose_db_version").WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow("goose_db_version"))
+	mock.ExpectQuery(`FROM goose_db_version`).WillReturnRows(gooseRows())
+
+	pending, err := m.Pending(context.Background())
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Version != 2 {
+		t.Fatalf("expected only 002 pending, got %+v", pending)
+	}
+
+	// Up imports it, then applies the rest
+	mock.ExpectQuery(`SELECT to_regclass`).WithArgs("schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow(nil))
+	mock.ExpectQuery(`SELECT to_regclass`).WithArgs("goose_db_version").WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow("goose_db_version"))
+	mock.ExpectQuery(`FROM goose_db_version`).WillReturnRows(gooseRows())
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(int64(1), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT to_regclass`).WithArgs("schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow("schema_migrations"))
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE feeds`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(int64(2), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	applied, err := m.Up(context.Background())
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if len(applied) != 1 || applied[0].Name != "002_feeds.sql" {
+		t.Fatalf("unexpected applied migrations: %+v", applied)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// TestBaseline adopts a database whose tables were created by hand: the
+// migrations up to the baseline are recorded without running their SQL.
+func TestBaseline(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db, testFS)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if _, err := m.Baseline(context.Background(), 7); err == nil {
+		t.Fatalf("expected an error for an unknown version")
+	}
+
+	mock.ExpectQuery(`SELECT to_regclass`).WithArgs("schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow(nil))
+	mock.ExpectQuery(`SELECT to_regclass`).WithArgs("goose_db_version").WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow(nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT to_regclass`).WithArgs("schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow("schema_migrations"))
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(int64(1), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	done, err := m.Baseline(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Baseline: %v", err)
+	}
+	if len(done) != 1 || done[0].Name != "001_users.sql" {
+		t.Fatalf("unexpected baselined migrations: %+v", done)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,275 @@
+// Package notify announces newly scraped posts in chat. A Notifier formats a
+// post for one service; Slack and Discord incoming webhooks and Matrix rooms
+// are built in. Users configure them per user and, optionally, per feed.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/delivery"
+)
+
+// Kinds of notifier.
+const (
+	KindSlack   = "slack"
+	KindDiscord = "discord"
+	KindMatrix  = "matrix"
+)
+
+// DefaultTimeout bounds each request when a notifier has no Client.
+const DefaultTimeout = 10 * time.Second
+
+// Post is what a notification announces.
+type Post struct {
+	// ID identifies the notification, the same for each retry of it, so
+	// that a retry after a lost response is not posted twice where the
+	// service supports it (Matrix). A random one is used when empty.
+	ID          string
+	Title       string
+	URL         string
+	Author      string
+	PublishedAt time.Time
+	FeedName    string
+	FeedURL     string
+}
+
+func (p Post) title() string {
+	if p.Title == "" {
+		return p.URL
+	}
+	return p.Title
+}
+
+// Notifier sends a message about a new post.
+type Notifier interface {
+	Notify(ctx context.Context, p Post) error
+}
+
+// New returns the notifier of kind posting to target: the incoming webhook
+// URL for Slack and Discord, the homeserver URL for Matrix. Matrix also
+// needs the room ID and an access token of the account posting.
+func New(kind, target, roomID, accessToken string) (Notifier, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid %s URL %q: want an http or https URL", kind, target)
+	}
+	switch kind {
+	case KindSlack:
+		return &Slack{WebhookURL: target}, nil
+	case KindDiscord:
+		return &Discord{WebhookURL: target}, nil
+	case KindMatrix:
+		if !strings.HasPrefix(roomID, "!") || accessToken == "" {
+			return nil, fmt.Errorf("matrix needs a room ID (!room:server) and an access token")
+		}
+		return &Matrix{Homeserver: target, RoomID: roomID, AccessToken: accessToken}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q: want slack, discord or matrix", kind)
+	}
+}
+
+// FromDB builds the Notifier a stored row describes.
+func FromDB(n database.Notifier) (Notifier, error) {
+	return New(n.Kind, n.Url, n.RoomID.String, n.AccessToken.String)
+}
+
+// Slack posts to a Slack incoming webhook.
+type Slack struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+// Notify implements Notifier.
+func (s *Slack) Notify(ctx context.Context, p Post) error {
+	text := fmt.Sprintf("*<%s|%s>*\n<%s|%s>", p.FeedURL, slackEscape(p.FeedName), p.URL, slackEscape(p.title()))
+	if p.Author != "" {
+		text += " by " + slackEscape(p.Author)
+	}
+	return send(ctx, s.Client, http.MethodPost, s.WebhookURL, "", map[string]any{"text": text})
+}
+
+// slackEscape escapes the characters Slack's mrkdwn gives meaning to.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// Discord posts to a Discord webhook as an embed.
+type Discord struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+// Notify implements Notifier.
+func (d *Discord) Notify(ctx context.Context, p Post) error {
+	embed := map[string]any{
+		"title":  truncate(p.title(), 256),
+		"url":    p.URL,
+		"author": map[string]string{"name": truncate(p.FeedName, 256), "url": p.FeedURL},
+	}
+	if p.Author != "" {
+		embed["footer"] = map[string]string{"text": truncate(p.Author, 2048)}
+	}
+	if !p.PublishedAt.IsZero() {
+		embed["timestamp"] = p.PublishedAt.UTC().Format(time.RFC3339)
+	}
+	return send(ctx, d.Client, http.MethodPost, d.WebhookURL, "", map[string]any{
+		"username": "gator",
+		"embeds":   []any{embed},
+	})
+}
+
+// Matrix sends an m.room.message to a room through the client-server API.
+type Matrix struct {
+	Homeserver  string
+	RoomID      string
+	AccessToken string
+	Client      *http.Client
+}
+
+// Notify implements Notifier.
+func (m *Matrix) Notify(ctx context.Context, p Post) error {
+	txnID := p.ID
+	if txnID == "" {
+		txnID = uuid.NewString()
+	}
+	endpoint := strings.TrimSuffix(m.Homeserver, "/") + "/_matrix/client/v3/rooms/" +
+		url.PathEscape(m.RoomID) + "/send/m.room.message/" + url.PathEscape(txnID)
+	body := fmt.Sprintf("%s: %s\n%s", p.FeedName, p.title(), p.URL)
+	formatted := fmt.Sprintf(`<b>%s</b>: <a href="%s">%s</a>`, html.EscapeString(p.FeedName), html.EscapeString(p.URL), html.EscapeString(p.title()))
+	if p.Author != "" {
+		body += "\nby " + p.Author
+		formatted += " by " + html.EscapeString(p.Author)
+	}
+	return send(ctx, m.Client, http.MethodPut, endpoint, m.AccessToken, map[string]string{
+		"msgtype":        "m.notice",
+		"body":           body,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": formatted,
+	})
+}
+
+// send makes one JSON request and fails unless the response is 2xx;
+// failures worth retrying are *delivery.RetryError.
+func send(ctx context.Context, client *http.Client, method, target, bearer string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gator-notify")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return &delivery.RetryError{Err: err}
+	}
+	defer resp.Body.Close()
+	if err := delivery.Check(resp); err != nil {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if msg := strings.TrimSpace(string(msg)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return nil
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// Dispatcher sends notifications on a delivery.Queue keyed by notifier, so
+// that a burst of new posts does not trip the service's rate limit.
+// Failures are retried under a delivery.Policy and reported to Out once
+// they run out of attempts.
+type Dispatcher struct {
+	// Attempts and Backoff are the retry policy; the delivery defaults
+	// when zero.
+	Attempts int
+	Backoff  time.Duration
+	// Out receives errors; os.Stdout when nil.
+	Out io.Writer
+
+	queue delivery.Queue
+}
+
+// Dispatch queues post, newly stored in f, for each of targets that applies
+// to f.
+func (d *Dispatcher) Dispatch(targets []database.Notifier, f database.Feed, row database.UpsertPostRow) {
+	p := Post{
+		Title:       row.Title,
+		URL:         row.Url,
+		Author:      row.Author.String,
+		PublishedAt: row.PublishedAt,
+		FeedName:    f.Name,
+		FeedURL:     f.Url,
+	}
+	policy := delivery.Policy{Attempts: d.Attempts, Backoff: d.Backoff}
+	for _, t := range targets {
+		if t.FeedID.Valid && t.FeedID.UUID != f.ID {
+			continue
+		}
+		n, err := FromDB(t)
+		if err != nil {
+			fmt.Fprintf(d.out(), "Skipping notifier %s: %v\n", t.ID, err)
+			continue
+		}
+		p := p
+		p.ID = uuid.NewString()
+		d.queue.Add(t.ID.String(), func(ctx context.Context) {
+			tries, err := policy.Do(ctx, func(ctx context.Context) error {
+				return n.Notify(ctx, p)
+			})
+			if err != nil {
+				fmt.Fprintf(d.out(), "Error sending %s notification after %d attempts: %v\n", t.Kind, tries, err)
+			}
+		})
+	}
+}
+
+// Wait blocks until every dispatched notification has been sent or failed.
+func (d *Dispatcher) Wait() {
+	d.queue.Wait()
+}
+
+// Shutdown stops retrying, drops the notifications that have not started
+// and waits until ctx is done for the requests in flight.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	dropped, err := d.queue.Shutdown(ctx)
+	if dropped > 0 {
+		fmt.Fprintf(d.out(), "Dropped %d queued notifications\n", dropped)
+	}
+	return err
+}
+
+func (d *Dispatcher) out() io.Writer {
+	if d.Out == nil {
+		return os.Stdout
+	}
+	return d.Out
+}
@@ -0,0 +1,314 @@
+package notify_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/delivery"
+	"github.com/markcromwell/gator/internal/notify"
+)
+
+var post = notify.Post{
+	Title:       "Go 1.23 <iterators> & more",
+	URL:         "https://go.dev/blog/go1.23",
+	Author:      "gopher",
+	PublishedAt: time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC),
+	FeedName:    "Go Blog",
+	FeedURL:     "https://go.dev/blog/feed.atom",
+}
+
+type request struct {
+	method string
+	path   string
+	auth   string
+	body   map[string]any
+}
+
+// standIn records the requests made to it and answers with status.
+func standIn(t *testing.T, status int) (*httptest.Server, func() []request) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		reqs []request
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{method: r.Method, path: r.URL.EscapedPath(), auth: r.Header.Get("Authorization")}
+		if err := json.NewDecoder(r.Body).Decode(&req.body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		mu.Lock()
+		reqs = append(reqs, req)
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []request {
+		mu.Lock()
+		defer mu.Unlock()
+		return reqs
+	}
+}
+
+func TestSlack(t *testing.T) {
+	srv, reqs := standIn(t, http.StatusOK)
+	n, err := notify.New(notify.KindSlack, srv.URL+"/services/T/B/x", "", "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := n.Notify(context.Background(), post); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	got := reqs()
+	want := "*<https://go.dev/blog/feed.atom|Go Blog>*\n<https://go.dev/blog/go1.23|Go 1.23 &lt;iterators&gt; &amp; more> by gopher"
+	if len(got) != 1 || got[0].method != http.MethodPost || got[0].path != "/services/T/B/x" || got[0].body["text"] != want {
+		t.Errorf("unexpected requests %+v", got)
+	}
+}
+
+func TestDiscord(t *testing.T) {
+	srv, reqs := standIn(t, http.StatusNoContent)
+	n, err := notify.New(notify.KindDiscord, srv.URL+"/api/webhooks/1/x", "", "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := n.Notify(context.Background(), post); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	got := reqs()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(got))
+	}
+	embeds, _ := got[0].body["embeds"].([]any)
+	if len(embeds) != 1 {
+		t.Fatalf("unexpected body %v", got[0].body)
+	}
+	embed := embeds[0].(map[string]any)
+	if embed["title"] != post.Title || embed["url"] != post.URL || embed["timestamp"] != "2024-05-02T09:00:00Z" ||
+		embed["author"].(map[string]any)["name"] != "Go Blog" || embed["footer"].(map[string]any)["text"] != "gopher" {
+		t.Errorf("unexpected embed %v", embed)
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	srv, reqs := standIn(t, http.StatusOK)
+	n, err := notify.New(notify.KindMatrix, srv.URL+"/", "!abc:example.org", "syt_secret")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := n.Notify(context.Background(), post); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	got := reqs()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(got))
+	}
+	r := got[0]
+	if r.method != http.MethodPut || !strings.HasPrefix(r.path, "/_matrix/client/v3/rooms/%21abc:example.org/send/m.room.message/") ||
+		r.auth != "Bearer syt_secret" {
+		t.Errorf("unexpected request %s %s (auth %q)", r.method, r.path, r.auth)
+	}
+	if r.body["msgtype"] != "m.notice" || r.body["body"] != "Go Blog: Go 1.23 <iterators> & more\nhttps://go.dev/blog/go1.23\nby gopher" ||
+		r.body["formatted_body"] != `<b>Go Blog</b>: <a href="https://go.dev/blog/go1.23">Go 1.23 &lt;iterators&gt; &amp; more</a> by gopher` {
+		t.Errorf("unexpected body %v", r.body)
+	}
+}
+
+func TestNotify_Errors(t *testing.T) {
+	srv, _ := standIn(t, http.StatusForbidden)
+	n, err := notify.New(notify.KindSlack, srv.URL, "", "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := n.Notify(context.Background(), post); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected HTTP 403 error, got %v", err)
+	}
+
+	for _, tc := range []struct{ kind, url, room, token string }{
+		{"irc", "https://example.com", "", ""},
+		{notify.KindSlack, "not a url", "", ""},
+		{notify.KindDiscord, "ftp://example.com", "", ""},
+		{notify.KindMatrix, "https://matrix.example.org", "", "token"},
+		{notify.KindMatrix, "https://matrix.example.org", "#alias:example.org", "token"},
+		{notify.KindMatrix, "https://matrix.example.org", "!abc:example.org", ""},
+	} {
+		if _, err := notify.New(tc.kind, tc.url, tc.room, tc.token); err == nil {
+			t.Errorf("expected error for %+v", tc)
+		}
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	slack, slackReqs := standIn(t, http.StatusOK)
+	discord, discordReqs := standIn(t, http.StatusInternalServerError)
+
+	feed := database.Feed{ID: uuid.New(), Name: "Go Blog", Url: "https://go.dev/blog/feed.atom"}
+	row := database.UpsertPostRow{ID: uuid.New(), Title: "Go 1.23", Url: "https://go.dev/blog/go1.23", FeedID: feed.ID, Inserted: true}
+	targets := []database.Notifier{
+		{ID: uuid.New(), Kind: notify.KindSlack, Url: slack.URL},
+		{ID: uuid.New(), Kind: notify.KindDiscord, Url: discord.URL},
+		// scoped to another feed
+		{ID: uuid.New(), Kind: notify.KindSlack, Url: slack.URL, FeedID: uuid.NullUUID{UUID: uuid.New(), Valid: true}},
+		// broken settings are skipped
+		{ID: uuid.New(), Kind: notify.KindMatrix, Url: slack.URL, RoomID: sql.NullString{}},
+	}
+
+	var out bytes.Buffer
+	d := &notify.Dispatcher{Backoff: time.Millisecond, Out: &out}
+	d.Dispatch(targets, feed, row)
+	d.Wait()
+
+	// the failing discord notification is retried
+	if len(slackReqs()) != 1 || len(discordReqs()) != delivery.DefaultAttempts {
+		t.Errorf("requests: slack %d, discord %d; want 1 and %d", len(slackReqs()), len(discordReqs()), delivery.DefaultAttempts)
+	}
+	if !strings.Contains(out.String(), "Error sending discord notification after 3 attempts: HTTP 500") ||
+		!strings.Contains(out.String(), "Skipping notifier "+targets[3].ID.String()) {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+}
+
+func TestDispatcher_RateLimited(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		inFlight  int
+		most      int
+		calls     int
+		firstSeen time.Time
+		retried   time.Time
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		most = max(most, inFlight)
+		calls++
+		n := calls
+		if n == 1 {
+			firstSeen = time.Now()
+		} else if n == 2 {
+			retried = time.Now()
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+		time.Sleep(2 * time.Millisecond)
+		// Discord answers a burst with 429 and how long to wait
+		if n == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	feed := database.Feed{ID: uuid.New(), Name: "Go Blog", Url: "https://go.dev/blog/feed.atom"}
+	target := database.Notifier{ID: uuid.New(), Kind: notify.KindDiscord, Url: srv.URL}
+	var out bytes.Buffer
+	d := &notify.Dispatcher{Backoff: time.Millisecond, Out: &out}
+	for i := range 5 {
+		row := database.UpsertPostRow{ID: uuid.New(), Title: fmt.Sprintf("Post %d", i), Url: "https://go.dev/blog/" + strconv.Itoa(i), FeedID: feed.ID}
+		d.Dispatch([]database.Notifier{target}, feed, row)
+	}
+	d.Wait()
+
+	if most != 1 || calls != 6 {
+		t.Errorf("most in flight = %d, calls = %d; want 1 and 6", most, calls)
+	}
+	if wait := retried.Sub(firstSeen); wait < time.Second {
+		t.Errorf("retried after %s, want the Retry-After of 1s", wait)
+	}
+	if out.Len() != 0 {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+}
+
+func TestDispatcher_Shutdown(t *testing.T) {
+	hit := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit <- struct{}{}
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	feed := database.Feed{ID: uuid.New(), Name: "Go Blog", Url: "https://go.dev/blog/feed.atom"}
+	target := database.Notifier{ID: uuid.New(), Kind: notify.KindSlack, Url: srv.URL}
+	var out bytes.Buffer
+	d := &notify.Dispatcher{Out: &out}
+	for i := range 3 {
+		d.Dispatch([]database.Notifier{target}, feed, database.UpsertPostRow{ID: uuid.New(), Title: fmt.Sprintf("Post %d", i), FeedID: feed.ID})
+	}
+	<-hit
+
+	// the first notification is waiting out Retry-After; shutdown cuts that
+	// short and drops the other two
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if len(hit) != 0 {
+		t.Errorf("%d more requests after the first", len(hit))
+	}
+	if !strings.Contains(out.String(), "Dropped 2 queued notifications") {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+}
+
+// TestDispatcher_MatrixRetryKeepsTxnID checks that a retried Matrix message
+// reuses its transaction ID, so the homeserver posts it only once.
+func TestDispatcher_MatrixRetryKeepsTxnID(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		n := len(paths)
+		mu.Unlock()
+		// the first attempt may have been stored; its response is lost
+		if n == 1 {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	feed := database.Feed{ID: uuid.New(), Name: "Go Blog"}
+	target := database.Notifier{
+		ID:          uuid.New(),
+		Kind:        notify.KindMatrix,
+		Url:         srv.URL,
+		RoomID:      sql.NullString{String: "!abc:example.org", Valid: true},
+		AccessToken: sql.NullString{String: "syt_secret", Valid: true},
+	}
+	var out bytes.Buffer
+	d := &notify.Dispatcher{Backoff: time.Millisecond, Out: &out}
+	d.Dispatch([]database.Notifier{target}, feed, database.UpsertPostRow{ID: uuid.New(), Title: "Post", FeedID: feed.ID})
+	d.Dispatch([]database.Notifier{target}, feed, database.UpsertPostRow{ID: uuid.New(), Title: "Another", FeedID: feed.ID})
+	d.Wait()
+
+	if len(paths) != 3 || paths[0] != paths[1] || paths[1] == paths[2] {
+		t.Errorf("want the retry to reuse the transaction ID and the next post to get its own, got %q", paths)
+	}
+	if out.Len() != 0 {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+}
@@ -0,0 +1,155 @@
+// Package opml reads and writes OPML subscription lists, the format feed
+// readers use to exchange the feeds a user follows.
+package opml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Document is an OPML 1.0/2.0 document.
+type Document struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    Head     `xml:"head"`
+	Body    Body     `xml:"body"`
+}
+
+// Head holds the document metadata.
+type Head struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+// Body holds the top-level outlines.
+type Body struct {
+	Outlines []Outline `xml:"outline"`
+}
+
+// Outline is either a subscription (XMLURL set) or a folder of outlines.
+type Outline struct {
+	Text     string    `xml:"text,attr"`
+	Title    string    `xml:"title,attr,omitempty"`
+	Type     string    `xml:"type,attr,omitempty"`
+	XMLURL   string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string    `xml:"htmlUrl,attr,omitempty"`
+	Outlines []Outline `xml:"outline"`
+}
+
+// Subscription is a single feed from an OPML document. Folder is the path of
+// the enclosing folder outlines joined by "/", or empty at the top level.
+type Subscription struct {
+	Title   string
+	XMLURL  string
+	HTMLURL string
+	Folder  string
+}
+
+// Parse reads an OPML document and returns its subscriptions in document
+// order.
+func Parse(r io.Reader) ([]Subscription, error) {
+	var doc Document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("xml unmarshal: %w", err)
+	}
+
+	var subs []Subscription
+	var walk func(outlines []Outline, folder string)
+	walk = func(outlines []Outline, folder string) {
+		for _, o := range outlines {
+			if url := strings.TrimSpace(o.XMLURL); url != "" {
+				subs = append(subs, Subscription{
+					Title:   firstNonEmpty(o.Title, o.Text, url),
+					XMLURL:  url,
+					HTMLURL: strings.TrimSpace(o.HTMLURL),
+					Folder:  folder,
+				})
+				continue
+			}
+			name := strings.ReplaceAll(firstNonEmpty(o.Text, o.Title), "/", "-")
+			walk(o.Outlines, joinFolder(folder, name))
+		}
+	}
+	walk(doc.Body.Outlines, "")
+	return subs, nil
+}
+
+// Write writes subs as an OPML 2.0 document titled title. Subscriptions are
+// nested under folder outlines following their Folder paths, in the order
+// they are given.
+func Write(w io.Writer, title, dateCreated string, subs []Subscription) error {
+	doc := Document{
+		Version: "2.0",
+		Head:    Head{Title: title, DateCreated: dateCreated},
+	}
+	for _, sub := range subs {
+		list := folderOutlines(&doc.Body.Outlines, splitFolder(sub.Folder))
+		*list = append(*list, Outline{
+			Text:    sub.Title,
+			Title:   sub.Title,
+			Type:    "rss",
+			XMLURL:  sub.XMLURL,
+			HTMLURL: sub.HTMLURL,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("xml marshal: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// folderOutlines returns the child list of the folder at path under list,
+// creating folder outlines as needed.
+func folderOutlines(list *[]Outline, path []string) *[]Outline {
+	if len(path) == 0 {
+		return list
+	}
+	for i := range *list {
+		o := &(*list)[i]
+		if o.XMLURL == "" && o.Text == path[0] {
+			return folderOutlines(&o.Outlines, path[1:])
+		}
+	}
+	*list = append(*list, Outline{Text: path[0], Title: path[0]})
+	return folderOutlines(&(*list)[len(*list)-1].Outlines, path[1:])
+}
+
+func splitFolder(folder string) []string {
+	var parts []string
+	for _, p := range strings.Split(folder, "/") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+func joinFolder(parent, name string) string {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return parent
+	case parent == "":
+		return name
+	default:
+		return parent + "/" + name
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package opml_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/markcromwell/gator/internal/opml"
+)
+
+const sampleOPML = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="1.0">
+  <head><title>My feeds</title></head>
+  <body>
+    <outline text="xkcd" type="rss" xmlUrl="https://xkcd.com/rss.xml" htmlUrl="https://xkcd.com/"/>
+    <outline text="Tech" title="Tech">
+      <outline title="Go Blog" text="The Go Blog" type="rss" xmlUrl="https://go.dev/blog/feed.atom"/>
+      <outline text="Databases">
+        <outline text="Postgres" type="rss" xmlUrl=" https://www.postgresql.org/news.rss "/>
+      </outline>
+    </outline>
+    <outline text="Empty folder"/>
+  </body>
+</opml>`
+
+func TestParse(t *testing.T) {
+	subs, err := opml.Parse(strings.NewReader(sampleOPML))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	want := []opml.Subscription{
+		{Title: "xkcd", XMLURL: "https://xkcd.com/rss.xml", HTMLURL: "https://xkcd.com/"},
+		{Title: "Go Blog", XMLURL: "https://go.dev/blog/feed.atom", Folder: "Tech"},
+		{Title: "Postgres", XMLURL: "https://www.postgresql.org/news.rss", Folder: "Tech/Databases"},
+	}
+	if !reflect.DeepEqual(subs, want) {
+		t.Fatalf("got %+v\nwant %+v", subs, want)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	if _, err := opml.Parse(strings.NewReader("<opml><body>")); err == nil {
+		t.Fatalf("expected error for truncated document")
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	subs := []opml.Subscription{
+		{Title: "xkcd", XMLURL: "https://xkcd.com/rss.xml"},
+		{Title: "Go Blog", XMLURL: "https://go.dev/blog/feed.atom", Folder: "Tech"},
+		{Title: "Postgres", XMLURL: "https://www.postgresql.org/news.rss", Folder: "Tech/Databases"},
+		{Title: "Rust Blog", XMLURL: "https://blog.rust-lang.org/feed.xml", Folder: "Tech"},
+	}
+
+	var buf bytes.Buffer
+	if err := opml.Write(&buf, "gator subscriptions", "Mon, 02 Jan 2006 15:04:05 +0000", subs); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `<opml version="2.0">`) || !strings.Contains(out, "<title>gator subscriptions</title>") {
+		t.Fatalf("unexpected document: %s", out)
+	}
+	if strings.Count(out, `text="Tech"`) != 1 {
+		t.Fatalf("expected a single Tech folder: %s", out)
+	}
+
+	back, err := opml.Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if !reflect.DeepEqual(back, subs) {
+		t.Fatalf("got %+v\nwant %+v", back, subs)
+	}
+}
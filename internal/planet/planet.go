@@ -0,0 +1,253 @@
+// Package planet generates a static "planet" site from a timeline: pages of
+// the newest posts, an Atom feed of them and an OPML blogroll of the feeds
+// they come from. The output directory can be served by any static host.
+package planet
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/markcromwell/gator/internal/opml"
+	"github.com/markcromwell/gator/internal/publish"
+)
+
+// Files written besides the pages.
+const (
+	AtomFile = "atom.xml"
+	OPMLFile = "blogroll.opml"
+)
+
+// DefaultPerPage is the number of posts on a page when Options.PerPage is 0.
+const DefaultPerPage = 20
+
+// summaryLength is the most characters of a post's description shown.
+const summaryLength = 400
+
+//go:embed templates
+var defaults embed.FS
+
+// Options controls how a site is generated.
+type Options struct {
+	PerPage int
+	// Templates is a directory whose page.html and style.css, where present,
+	// replace the built-in ones.
+	Templates string
+}
+
+// Page is the data page.html is executed with.
+type Page struct {
+	Title     string
+	Number    int
+	Total     int
+	Prev      string // URL of the newer page, or empty on the first
+	Next      string // URL of the older page, or empty on the last
+	Days      []Day
+	Feeds     []opml.Subscription
+	AtomURL   string
+	OPMLURL   string
+	Generated time.Time
+}
+
+// Day groups the posts published on one date, newest first.
+type Day struct {
+	Date    time.Time
+	Entries []Entry
+}
+
+// Entry is a post as shown on a page. Summary is plain text; feed HTML is
+// never copied into the site.
+type Entry struct {
+	Title     string
+	URL       string
+	Author    string
+	Summary   string
+	Published time.Time
+	FeedName  string
+	FeedURL   string
+}
+
+// Generate writes the site for t and feeds into dir, creating it if needed,
+// and returns the number of pages written. Pages are index.html, page2.html,
+// page3.html and so on; pages left over from a longer earlier run are
+// removed.
+func Generate(dir string, t publish.Timeline, feeds []opml.Subscription, opts Options) (int, error) {
+	perPage := opts.PerPage
+	if perPage == 0 {
+		perPage = DefaultPerPage
+	}
+	if perPage < 0 {
+		return 0, fmt.Errorf("posts per page cannot be negative")
+	}
+
+	pageSrc, err := asset(opts.Templates, "page.html")
+	if err != nil {
+		return 0, err
+	}
+	tmpl, err := template.New("page.html").Parse(string(pageSrc))
+	if err != nil {
+		return 0, fmt.Errorf("parse page template: %w", err)
+	}
+	style, err := asset(opts.Templates, "style.css")
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, fmt.Errorf("create output directory: %w", err)
+	}
+
+	total := (len(t.Entries) + perPage - 1) / perPage
+	if total == 0 {
+		total = 1
+	}
+	generated := time.Now().UTC()
+	for n := 1; n <= total; n++ {
+		start := (n - 1) * perPage
+		end := min(start+perPage, len(t.Entries))
+		page := Page{
+			Title:     t.Title,
+			Number:    n,
+			Total:     total,
+			Days:      days(t.Entries[start:end]),
+			Feeds:     feeds,
+			AtomURL:   AtomFile,
+			OPMLURL:   OPMLFile,
+			Generated: generated,
+		}
+		if n > 1 {
+			page.Prev = pageFile(n - 1)
+		}
+		if n < total {
+			page.Next = pageFile(n + 1)
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, page); err != nil {
+			return 0, fmt.Errorf("render page %d: %w", n, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, pageFile(n)), buf.Bytes(), 0o644); err != nil {
+			return 0, fmt.Errorf("write page %d: %w", n, err)
+		}
+	}
+	if err := removeStalePages(dir, total); err != nil {
+		return 0, err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "style.css"), style, 0o644); err != nil {
+		return 0, fmt.Errorf("write style.css: %w", err)
+	}
+
+	var atom bytes.Buffer
+	if err := publish.Write(&atom, publish.Atom, t); err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, AtomFile), atom.Bytes(), 0o644); err != nil {
+		return 0, fmt.Errorf("write %s: %w", AtomFile, err)
+	}
+
+	var blogroll bytes.Buffer
+	if err := opml.Write(&blogroll, t.Title, generated.Format(time.RFC1123Z), feeds); err != nil {
+		return 0, fmt.Errorf("write OPML: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, OPMLFile), blogroll.Bytes(), 0o644); err != nil {
+		return 0, fmt.Errorf("write %s: %w", OPMLFile, err)
+	}
+	return total, nil
+}
+
+// asset returns the named template file from dir, or the built-in one when
+// dir is empty or does not have it.
+func asset(dir, name string) ([]byte, error) {
+	if dir != "" {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return b, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("read template %s: %w", name, err)
+		}
+	}
+	return defaults.ReadFile("templates/" + name)
+}
+
+func pageFile(n int) string {
+	if n == 1 {
+		return "index.html"
+	}
+	return "page" + strconv.Itoa(n) + ".html"
+}
+
+var pageFileRe = regexp.MustCompile(`^page(\d+)\.html$`)
+
+func removeStalePages(dir string, total int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read output directory: %w", err)
+	}
+	for _, e := range entries {
+		m := pageFileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		if n, _ := strconv.Atoi(m[1]); n > total {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return fmt.Errorf("remove stale page: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// days groups entries, which are newest first, by their UTC publication
+// date.
+func days(entries []publish.Entry) []Day {
+	var out []Day
+	for _, e := range entries {
+		date := time.Date(e.Published.Year(), e.Published.Month(), e.Published.Day(), 0, 0, 0, 0, time.UTC)
+		if len(out) == 0 || !out[len(out)-1].Date.Equal(date) {
+			out = append(out, Day{Date: date})
+		}
+		d := &out[len(out)-1]
+		d.Entries = append(d.Entries, Entry{
+			Title:     e.Title,
+			URL:       e.URL,
+			Author:    e.Author,
+			Summary:   summary(e.Summary),
+			Published: e.Published,
+			FeedName:  e.FeedName,
+			FeedURL:   e.FeedURL,
+		})
+	}
+	return out
+}
+
+var (
+	tagRe   = regexp.MustCompile(`(?s)<(script|style)\b.*?</(script|style)>|<[^>]*>`)
+	spaceRe = regexp.MustCompile(`\s+`)
+)
+
+// summary turns a post's HTML description into a short plain-text excerpt.
+func summary(description string) string {
+	text := html.UnescapeString(tagRe.ReplaceAllString(description, " "))
+	text = strings.TrimSpace(spaceRe.ReplaceAllString(text, " "))
+	if utf8.RuneCountInString(text) <= summaryLength {
+		return text
+	}
+	cut := []rune(text)[:summaryLength]
+	if i := strings.LastIndexByte(string(cut), ' '); i > summaryLength/2 {
+		return string(cut)[:i] + "…"
+	}
+	return string(cut) + "…"
+}
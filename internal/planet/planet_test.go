@@ -0,0 +1,125 @@
+package planet_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/feed"
+	"github.com/markcromwell/gator/internal/opml"
+	"github.com/markcromwell/gator/internal/planet"
+	"github.com/markcromwell/gator/internal/publish"
+)
+
+func timeline() publish.Timeline {
+	day := time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)
+	return publish.Timeline{
+		ID:      "urn:uuid:" + uuid.NewString(),
+		Title:   "Planet Team",
+		Author:  "Planet Team",
+		Updated: day,
+		Entries: []publish.Entry{
+			{ID: uuid.New(), Title: "Newest", URL: "https://a.example/1", Summary: `<p>Hello &amp; <b>welcome</b></p><script>alert(1)</script>`, Published: day, Updated: day, FeedName: "A", FeedURL: "https://a.example/feed"},
+			{ID: uuid.New(), Title: "Same day", URL: "https://b.example/1", Published: day.Add(-time.Hour), Updated: day, FeedName: "B", FeedURL: "https://b.example/feed"},
+			{ID: uuid.New(), Title: "Yesterday", URL: "javascript:alert(1)", Published: day.Add(-24 * time.Hour), Updated: day, FeedName: "A", FeedURL: "https://a.example/feed"},
+		},
+	}
+}
+
+var subs = []opml.Subscription{
+	{Title: "A", XMLURL: "https://a.example/feed", Folder: "Team"},
+	{Title: "B", XMLURL: "https://b.example/feed"},
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(b)
+}
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	// left over from an earlier, longer run
+	if err := os.WriteFile(filepath.Join(dir, "page5.html"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := planet.Generate(dir, timeline(), subs, planet.Options{PerPage: 2})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("pages = %d, want 2", n)
+	}
+
+	index := readFile(t, filepath.Join(dir, "index.html"))
+	for _, want := range []string{
+		"<title>Planet Team</title>",
+		"Thursday, 2 May 2024",
+		`<a href="https://a.example/1">Newest</a>`,
+		"Hello &amp; welcome",
+		`<a href="page2.html">Older →</a>`,
+		`<a href="https://b.example/feed">B</a>`,
+	} {
+		if !strings.Contains(index, want) {
+			t.Errorf("index.html: expected %q in:\n%s", want, index)
+		}
+	}
+	if strings.Contains(index, "<script>") || strings.Contains(index, "<b>") {
+		t.Errorf("index.html: feed HTML must not be copied into the page:\n%s", index)
+	}
+
+	page2 := readFile(t, filepath.Join(dir, "page2.html"))
+	if !strings.Contains(page2, "Wednesday, 1 May 2024") || !strings.Contains(page2, `<a href="index.html">← Newer</a>`) ||
+		strings.Contains(page2, "javascript:") {
+		t.Errorf("unexpected page2.html:\n%s", page2)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "page5.html")); !os.IsNotExist(err) {
+		t.Errorf("expected stale page5.html to be removed, got %v", err)
+	}
+
+	parsed, err := feed.Parse([]byte(readFile(t, filepath.Join(dir, planet.AtomFile))))
+	if err != nil || len(parsed.Channel.Item) != 3 {
+		t.Errorf("atom.xml: %v, %+v", err, parsed)
+	}
+	got, err := opml.Parse(strings.NewReader(readFile(t, filepath.Join(dir, planet.OPMLFile))))
+	if err != nil || len(got) != 2 || got[0].Folder != "Team" {
+		t.Errorf("blogroll.opml: %v, %+v", err, got)
+	}
+	if css := readFile(t, filepath.Join(dir, "style.css")); !strings.Contains(css, "body") {
+		t.Errorf("unexpected style.css: %s", css)
+	}
+}
+
+func TestGenerate_TemplateOverride(t *testing.T) {
+	tmplDir, dir := t.TempDir(), t.TempDir()
+	page := `<h1>{{.Title}}</h1>{{range .Days}}{{range .Entries}}<p>{{.Title}}</p>{{end}}{{end}}`
+	if err := os.WriteFile(filepath.Join(tmplDir, "page.html"), []byte(page), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := planet.Generate(dir, timeline(), subs, planet.Options{Templates: tmplDir}); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	want := "<h1>Planet Team</h1><p>Newest</p><p>Same day</p><p>Yesterday</p>"
+	if got := readFile(t, filepath.Join(dir, "index.html")); got != want {
+		t.Errorf("index.html = %q, want %q", got, want)
+	}
+	// style.css is not overridden, so the built-in one is used
+	if css := readFile(t, filepath.Join(dir, "style.css")); !strings.Contains(css, "body") {
+		t.Errorf("expected the built-in style.css, got %s", css)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmplDir, "page.html"), []byte("{{.Missing"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := planet.Generate(dir, timeline(), subs, planet.Options{Templates: tmplDir}); err == nil {
+		t.Errorf("expected error for a broken template")
+	}
+}
@@ -0,0 +1,390 @@
+// Package publish renders a timeline, the posts of the feeds a user follows
+// or of every feed, as an Atom 1.0 or RSS 2.0 feed so it can be
+// re-syndicated.
+package publish
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+)
+
+// Formats a timeline can be written in.
+const (
+	Atom = "atom"
+	RSS  = "rss"
+)
+
+// Post filters for Options.Only.
+const (
+	OnlyHighlighted = "highlighted"
+	OnlyStarred     = "starred"
+	OnlyUnread      = "unread"
+)
+
+// DefaultLimit is the number of posts published when Options.Limit is 0.
+const DefaultLimit = 50
+
+// Options selects which posts a timeline holds.
+type Options struct {
+	// Folder keeps posts of feeds followed in this folder or its subfolders.
+	Folder string
+	// Feed keeps posts of one feed, by name or URL.
+	Feed string
+	// Only keeps highlighted, starred or unread posts.
+	Only  string
+	Limit int
+	// SelfURL is where the published feed can be fetched, if anywhere.
+	SelfURL string
+}
+
+// Validate reports whether the options are usable.
+func (o Options) Validate() error {
+	switch o.Only {
+	case "", OnlyHighlighted, OnlyStarred, OnlyUnread:
+	default:
+		return fmt.Errorf("unknown filter %q (want %s, %s or %s)", o.Only, OnlyHighlighted, OnlyStarred, OnlyUnread)
+	}
+	if o.Limit < 0 {
+		return fmt.Errorf("limit cannot be negative")
+	}
+	return nil
+}
+
+// Entry is one post in a timeline.
+type Entry struct {
+	ID         uuid.UUID
+	Title      string
+	URL        string
+	Summary    string
+	Author     string
+	Categories []string
+	Published  time.Time
+	Updated    time.Time
+	FeedName   string
+	FeedURL    string
+}
+
+// Timeline is a feed of posts, newest first. Updated is the latest Updated
+// of its entries, or zero when it has none.
+type Timeline struct {
+	ID      string
+	Title   string
+	Author  string
+	SelfURL string
+	Updated time.Time
+	Entries []Entry
+}
+
+// Build loads the timeline opts selects for user. Its ID depends only on
+// the user and the selection, so it stays the same between builds.
+func Build(ctx context.Context, db *database.Queries, user database.User, opts Options) (Timeline, error) {
+	if err := opts.Validate(); err != nil {
+		return Timeline{}, err
+	}
+	limit := opts.Limit
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+	rows, err := db.GetTimelineForUser(ctx, database.GetTimelineForUserParams{
+		UserID:          user.ID,
+		Folder:          sql.NullString{String: opts.Folder, Valid: opts.Folder != ""},
+		Feed:            sql.NullString{String: opts.Feed, Valid: opts.Feed != ""},
+		HighlightedOnly: opts.Only == OnlyHighlighted,
+		StarredOnly:     opts.Only == OnlyStarred,
+		UnreadOnly:      opts.Only == OnlyUnread,
+		Limit:           int32(limit),
+	})
+	if err != nil {
+		return Timeline{}, fmt.Errorf("get timeline: %w", err)
+	}
+
+	var variant []string
+	for _, v := range []string{opts.Folder, opts.Feed, opts.Only} {
+		if v != "" {
+			variant = append(variant, v)
+		}
+	}
+	title := "gator: " + user.Name
+	if len(variant) > 0 {
+		title += " (" + strings.Join(variant, ", ") + ")"
+	}
+	entries := make([]Entry, 0, len(rows))
+	for _, r := range rows {
+		entries = append(entries, newEntry(r.ID, r.Title, r.Url, r.Description, r.Author, r.Categories, r.PublishedAt, r.UpdatedAt, r.FeedName, r.FeedUrl))
+	}
+	id := uuid.NewSHA1(user.ID, []byte(strings.Join([]string{opts.Folder, opts.Feed, opts.Only}, "\x00")))
+	return newTimeline(id, title, user.Name, opts.SelfURL, entries), nil
+}
+
+// BuildAll loads the newest posts of every feed, for a site shared by all
+// users. Only the Limit and SelfURL of opts apply.
+func BuildAll(ctx context.Context, db *database.Queries, title string, opts Options) (Timeline, error) {
+	if err := opts.Validate(); err != nil {
+		return Timeline{}, err
+	}
+	limit := opts.Limit
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+	rows, err := db.GetRecentPosts(ctx, int32(limit))
+	if err != nil {
+		return Timeline{}, fmt.Errorf("get recent posts: %w", err)
+	}
+	entries := make([]Entry, 0, len(rows))
+	for _, r := range rows {
+		entries = append(entries, newEntry(r.ID, r.Title, r.Url, r.Description, r.Author, r.Categories, r.PublishedAt, r.UpdatedAt, r.FeedName, r.FeedUrl))
+	}
+	id := uuid.NewSHA1(uuid.NameSpaceURL, []byte("gator:all:"+title))
+	return newTimeline(id, title, title, opts.SelfURL, entries), nil
+}
+
+func newEntry(id uuid.UUID, title, url string, description, author sql.NullString, categories []string, published, updated time.Time, feedName, feedURL string) Entry {
+	e := Entry{
+		ID:         id,
+		Title:      title,
+		URL:        url,
+		Summary:    description.String,
+		Author:     author.String,
+		Categories: categories,
+		Published:  published.UTC(),
+		Updated:    updated.UTC(),
+		FeedName:   feedName,
+		FeedURL:    feedURL,
+	}
+	// a post is never updated before it is published
+	if e.Updated.Before(e.Published) {
+		e.Updated = e.Published
+	}
+	return e
+}
+
+func newTimeline(id uuid.UUID, title, author, selfURL string, entries []Entry) Timeline {
+	t := Timeline{
+		ID:      "urn:uuid:" + id.String(),
+		Title:   title,
+		Author:  author,
+		SelfURL: selfURL,
+		Entries: entries,
+	}
+	for _, e := range entries {
+		if e.Updated.After(t.Updated) {
+			t.Updated = e.Updated
+		}
+	}
+	return t
+}
+
+// ContentType returns the media type of format.
+func ContentType(format string) string {
+	if format == RSS {
+		return "application/rss+xml; charset=utf-8"
+	}
+	return "application/atom+xml; charset=utf-8"
+}
+
+// Write writes t to w as format, Atom or RSS. RSS needs t.SelfURL for the
+// channel's required link.
+func Write(w io.Writer, format string, t Timeline) error {
+	var doc any
+	switch format {
+	case Atom:
+		doc = atomFeed(t)
+	case RSS:
+		if t.SelfURL == "" {
+			return fmt.Errorf("rss needs the URL the feed is published at")
+		}
+		doc = rssFeed(t)
+	default:
+		return fmt.Errorf("unknown format %q (want %s or %s)", format, Atom, RSS)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("xml marshal: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type atomDoc struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomSource struct {
+	ID    string     `xml:"id"`
+	Title string     `xml:"title"`
+	Links []atomLink `xml:"link"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Author     *atomPerson    `xml:"author"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary"`
+	Source     atomSource     `xml:"source"`
+}
+
+func atomFeed(t Timeline) atomDoc {
+	doc := atomDoc{
+		ID:      t.ID,
+		Title:   t.Title,
+		Updated: atomTime(t.Updated),
+		Author:  atomPerson{Name: t.Author},
+		Entries: []atomEntry{},
+	}
+	if t.SelfURL != "" {
+		doc.Links = append(doc.Links, atomLink{Href: t.SelfURL, Rel: "self", Type: "application/atom+xml"})
+	}
+	for _, e := range t.Entries {
+		entry := atomEntry{
+			ID:        "urn:uuid:" + e.ID.String(),
+			Title:     e.Title,
+			Updated:   atomTime(e.Updated),
+			Published: atomTime(e.Published),
+			Links:     []atomLink{{Href: e.URL, Rel: "alternate"}},
+			Source: atomSource{
+				ID:    e.FeedURL,
+				Title: e.FeedName,
+				Links: []atomLink{{Href: e.FeedURL, Rel: "self"}},
+			},
+		}
+		if e.Author != "" {
+			entry.Author = &atomPerson{Name: e.Author}
+		}
+		for _, c := range e.Categories {
+			entry.Categories = append(entry.Categories, atomCategory{Term: c})
+		}
+		if e.Summary != "" {
+			entry.Summary = &atomText{Type: "html", Body: e.Summary}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return doc
+}
+
+type rssDoc struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	AtomLink      *rssLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssSource struct {
+	URL  string `xml:"url,attr"`
+	Name string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description,omitempty"`
+	Creator     string    `xml:"dc:creator,omitempty"`
+	Categories  []string  `xml:"category"`
+	GUID        rssGUID   `xml:"guid"`
+	PubDate     string    `xml:"pubDate"`
+	Source      rssSource `xml:"source"`
+}
+
+func rssFeed(t Timeline) rssDoc {
+	doc := rssDoc{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:       t.Title,
+			Link:        t.SelfURL,
+			Description: "Posts from the feeds " + t.Author + " follows",
+			Items:       []rssItem{},
+		},
+	}
+	if !t.Updated.IsZero() {
+		doc.Channel.LastBuildDate = t.Updated.Format(time.RFC1123Z)
+	}
+	if t.SelfURL != "" {
+		doc.Channel.AtomLink = &rssLink{Href: t.SelfURL, Rel: "self", Type: "application/rss+xml"}
+	}
+	for _, e := range t.Entries {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       e.Title,
+			Link:        e.URL,
+			Description: e.Summary,
+			Creator:     e.Author,
+			Categories:  e.Categories,
+			GUID:        rssGUID{IsPermaLink: "false", Value: "urn:uuid:" + e.ID.String()},
+			PubDate:     e.Published.Format(time.RFC1123Z),
+			Source:      rssSource{URL: e.FeedURL, Name: e.FeedName},
+		})
+	}
+	return doc
+}
+
+// atomTime formats t as RFC 3339; a timeline that was never updated reports
+// the Unix epoch, since Atom requires a date.
+func atomTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
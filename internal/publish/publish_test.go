@@ -0,0 +1,111 @@
+package publish_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/feed"
+	"github.com/markcromwell/gator/internal/publish"
+)
+
+var timelineColumns = []string{"id", "title", "url", "description", "author", "categories", "published_at", "updated_at", "feed_name", "feed_url"}
+
+func buildTimeline(t *testing.T, user database.User, opts publish.Options) (publish.Timeline, uuid.UUID) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	newest := time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)
+	postID := uuid.New()
+	mock.ExpectQuery(`(?i)FROM posts p\s+JOIN feed_follows`).
+		WithArgs(user.ID, sql.NullString{String: "Tech", Valid: true}, sql.NullString{}, false, true, false, int32(50)).
+		WillReturnRows(sqlmock.NewRows(timelineColumns).
+			AddRow(postID, "Go 1.23 & iterators", "https://go.dev/blog/go1.23", "<p>Range over func</p>", "gopher", "{go,release}", newest, newest.Add(-time.Hour), "Go Blog", "https://go.dev/blog/feed.atom").
+			AddRow(uuid.New(), "Older", "https://example.com/older", nil, nil, "{}", newest.Add(-24*time.Hour), newest.Add(-2*time.Hour), "Example", "https://example.com/feed"))
+
+	tl, err := publish.Build(context.Background(), database.New(db), user, opts)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+	return tl, postID
+}
+
+func TestBuild(t *testing.T) {
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	opts := publish.Options{Folder: "Tech", Only: publish.OnlyStarred}
+	tl, _ := buildTimeline(t, user, opts)
+
+	if tl.Title != "gator: bob (Tech, starred)" {
+		t.Errorf("Title = %q", tl.Title)
+	}
+	if len(tl.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(tl.Entries))
+	}
+	// updated_at before published_at is clamped to published_at
+	if want := time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC); !tl.Updated.Equal(want) || !tl.Entries[0].Updated.Equal(want) {
+		t.Errorf("Updated = %v, entry updated = %v, want %v", tl.Updated, tl.Entries[0].Updated, want)
+	}
+
+	again, _ := buildTimeline(t, user, opts)
+	if tl.ID != again.ID {
+		t.Errorf("timeline ID changed between builds")
+	}
+	if _, err := publish.Build(context.Background(), nil, database.User{}, publish.Options{Only: "spam"}); err == nil {
+		t.Errorf("expected error for unknown filter")
+	}
+}
+
+// TestWrite reads each format back with gator's own feed parser.
+func TestWrite(t *testing.T) {
+	tl, postID := buildTimeline(t, database.User{ID: uuid.New(), Name: "bob"}, publish.Options{Folder: "Tech", Only: publish.OnlyStarred, SelfURL: "https://example.org/bob.xml"})
+
+	for _, format := range []string{publish.Atom, publish.RSS} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := publish.Write(&buf, format, tl); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if !strings.Contains(buf.String(), "https://example.org/bob.xml") {
+				t.Errorf("expected self link in:\n%s", buf.String())
+			}
+			parsed, err := feed.Parse(buf.Bytes())
+			if err != nil {
+				t.Fatalf("Parse: %v\n%s", err, buf.String())
+			}
+			if parsed.Channel.Title != "gator: bob (Tech, starred)" || len(parsed.Channel.Item) != 2 {
+				t.Fatalf("unexpected feed %+v", parsed.Channel)
+			}
+			item := parsed.Channel.Item[0]
+			if item.Title != "Go 1.23 & iterators" || item.Link != "https://go.dev/blog/go1.23" ||
+				item.GUID != "urn:uuid:"+postID.String() || item.Author != "gopher" ||
+				len(item.Categories) != 2 || !strings.Contains(item.Description, "Range over func") {
+				t.Errorf("unexpected item %+v", item)
+			}
+			published, err := feed.ParseFeedDate(item.PubDate)
+			if err != nil || !published.Equal(time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)) {
+				t.Errorf("PubDate = %q (%v)", item.PubDate, err)
+			}
+		})
+	}
+
+	if err := publish.Write(&bytes.Buffer{}, "json", tl); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+	tl.SelfURL = ""
+	if err := publish.Write(&bytes.Buffer{}, publish.RSS, tl); err == nil {
+		t.Errorf("expected error for RSS without a channel link")
+	}
+}
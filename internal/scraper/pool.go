@@ -0,0 +1,257 @@
+package scraper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+)
+
+// Pool scrapes due feeds on a fixed number of concurrent workers. Requests
+// to the same host are spaced at least HostDelay apart; different hosts are
+// fetched in parallel.
+//
+// Feeds are claimed in the database before they are fetched, so several
+// pools (in one process or many) can share a database and each feed is
+// fetched by exactly one of them per cycle.
+type Pool struct {
+	Scraper   *Scraper
+	Workers   int
+	HostDelay time.Duration
+	// BatchSize is how many due feeds are claimed per query; at least
+	// twice Workers.
+	BatchSize int
+	// Lease is how long a claim lasts before another scraper may take the
+	// feed over. Defaults to DefaultLease.
+	Lease time.Duration
+	// ID identifies this pool's claims. A unique one is generated when
+	// empty.
+	ID string
+	// PurgeEvery is how often Run deletes posts past their retention (see
+	// Scraper.Purge); 0 disables the automatic purge.
+	PurgeEvery time.Duration
+}
+
+// DefaultLease is the claim lease used when Pool.Lease is zero.
+const DefaultLease = 10 * time.Minute
+
+// ErrFeedBusy is returned by ScrapeNow for a feed it cannot claim.
+var ErrFeedBusy = errors.New("feed is disabled or being scraped")
+
+// Run scrapes all due feeds immediately and then again every interval,
+// until ctx is cancelled. When PurgeEvery is set, old posts are purged after
+// the first scrape and then whenever PurgeEvery has passed. Cancellation is
+// a clean shutdown and returns nil.
+func (p *Pool) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastPurge time.Time
+	for {
+		fmt.Fprintln(p.Scraper.out(), "Scraping feeds...")
+		if err := p.RunOnce(ctx); err != nil {
+			fmt.Fprintln(p.Scraper.out(), "Error selecting feeds to fetch:", err)
+		}
+
+		if p.PurgeEvery > 0 && ctx.Err() == nil && time.Since(lastPurge) >= p.PurgeEvery {
+			lastPurge = time.Now()
+			if n, err := p.Scraper.Purge(ctx); err != nil {
+				fmt.Fprintln(p.Scraper.out(), "Error purging posts:", err)
+			} else if n > 0 {
+				fmt.Fprintf(p.Scraper.out(), "Purged %d posts\n", n)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce scrapes every feed that is currently due and returns when none are
+// left or ctx is cancelled. In-flight fetches are cancelled with ctx.
+func (p *Pool) RunOnce(ctx context.Context) error {
+	if p.ID == "" {
+		p.ID = NewClaimID()
+	}
+	workers := max(p.Workers, 1)
+	batch := max(p.BatchSize, 2*workers)
+	throttle := newHostThrottle(p.HostDelay)
+
+	var (
+		mu      sync.Mutex
+		total   Stats
+		fetched int
+	)
+
+	jobs := make(chan database.Feed)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				if err := throttle.wait(ctx, hostOf(f.Url)); err != nil {
+					return
+				}
+				stats, err := p.Scraper.ScrapeFeed(ctx, f)
+				if err != nil && ctx.Err() == nil {
+					fmt.Fprintln(p.Scraper.out(), "Error fetching feed:", err)
+				}
+				mu.Lock()
+				fetched++
+				total.add(stats)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	err := p.dispatch(ctx, jobs, batch)
+	close(jobs)
+	wg.Wait()
+
+	// Hand back claims on feeds that were never fetched (shutdown) so other
+	// scrapers need not wait for the lease to expire. ctx may be cancelled
+	// already, so use a fresh one.
+	releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if relErr := p.Scraper.DB.ReleaseFeedClaims(releaseCtx, nullString(p.ID)); relErr != nil {
+		fmt.Fprintln(p.Scraper.out(), "Error releasing feed claims:", relErr)
+	}
+	if fetched > 0 {
+		fmt.Fprintf(p.Scraper.out(), "Scraped %d feeds: %s\n", fetched, total)
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// dispatch claims due feeds in batches and feeds them to jobs until no
+// unclaimed due feeds are left.
+func (p *Pool) dispatch(ctx context.Context, jobs chan<- database.Feed, batch int) error {
+	for {
+		feeds, err := p.Scraper.DB.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+			LeaseSeconds: int32(p.lease() / time.Second),
+			ClaimedBy:    nullString(p.ID),
+			BatchSize:    int32(batch),
+		})
+		if err != nil {
+			return err
+		}
+		if len(feeds) == 0 {
+			return nil
+		}
+
+		for _, f := range feeds {
+			select {
+			case jobs <- f:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// ScrapeNow claims f and scrapes it at once, due or not, as one of the
+// pool's workers would. It returns ErrFeedBusy when f is disabled or another
+// scraper holds it, and a *FetchError when the fetch itself failed.
+func (p *Pool) ScrapeNow(ctx context.Context, f database.Feed) (Stats, error) {
+	claimedBy := nullString(NewClaimID())
+	claimed, err := p.Scraper.DB.ClaimFeed(ctx, database.ClaimFeedParams{
+		LeaseSeconds: int32(p.lease() / time.Second),
+		ClaimedBy:    claimedBy,
+		ID:           f.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Stats{}, ErrFeedBusy
+	}
+	if err != nil {
+		return Stats{}, fmt.Errorf("claim feed: %w", err)
+	}
+	defer func() {
+		// ScrapeFeed releases the claim unless ctx was cancelled first.
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := p.Scraper.DB.ReleaseFeedClaims(releaseCtx, claimedBy); err != nil {
+			fmt.Fprintln(p.Scraper.out(), "Error releasing feed claim:", err)
+		}
+	}()
+	return p.Scraper.ScrapeFeed(ctx, claimed)
+}
+
+func (p *Pool) lease() time.Duration {
+	if p.Lease <= 0 {
+		return DefaultLease
+	}
+	return p.Lease
+}
+
+// NewClaimID returns a claim identifier unique to one scraper: host name,
+// pid and a random suffix.
+func NewClaimID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), uuid.NewString()[:8])
+}
+
+// hostOf returns the host[:port] that politeness delays are keyed on.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Host
+}
+
+// hostThrottle hands out fetch slots per host, at least delay apart.
+type hostThrottle struct {
+	delay time.Duration
+
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+func newHostThrottle(delay time.Duration) *hostThrottle {
+	return &hostThrottle{delay: delay, next: make(map[string]time.Time)}
+}
+
+// wait blocks until host may be fetched again or ctx is cancelled.
+func (h *hostThrottle) wait(ctx context.Context, host string) error {
+	if h.delay <= 0 {
+		return ctx.Err()
+	}
+
+	h.mu.Lock()
+	now := time.Now()
+	slot := h.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	h.next[host] = slot.Add(h.delay)
+	h.mu.Unlock()
+
+	d := time.Until(slot)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,168 @@
+package scraper_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/scraper"
+)
+
+var feedColumns = []string{"id", "created_at", "last_fetched_at", "updated_at", "name", "url", "user_id", "etag", "last_modified", "claimed_until", "claimed_by", "fetch_interval_seconds", "next_fetch_at", "consecutive_failures", "last_error", "last_status", "last_success_at", "disabled_at", "retention_days", "retention_max_posts", "seq"}
+
+const emptyRSS = `<rss version="2.0"><channel><title>empty</title></channel></rss>`
+
+func TestPoolRunOnce_HostDelay(t *testing.T) {
+	const delay = 150 * time.Millisecond
+
+	var mu sync.Mutex
+	var hits []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits = append(hits, time.Now())
+		mu.Unlock()
+		fmt.Fprintln(w, emptyRSS)
+	}))
+	defer srv.Close()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+
+	now := time.Now()
+	rows := sqlmock.NewRows(feedColumns)
+	for i := range 2 {
+		rows.AddRow(uuid.New(), now, nil, now, fmt.Sprintf("f%d", i), fmt.Sprintf("%s/feed%d", srv.URL, i), uuid.New(), nil, nil, now.Add(time.Minute), "test", 600, nil, 0, nil, nil, nil, nil, nil, nil, int64(i+1))
+	}
+	mock.ExpectQuery(`UPDATE feeds\s+SET claimed_until = NOW`).WillReturnRows(rows)
+	for range 2 {
+		mock.ExpectExec(`UPDATE feeds\s+SET etag`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE feeds\s+SET last_fetched_at`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE feeds\s+SET consecutive_failures = 0`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE feeds\s+SET fetch_interval_seconds`).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	// both feeds are fetched, so the next claim is empty
+	mock.ExpectQuery(`UPDATE feeds\s+SET claimed_until = NOW`).WillReturnRows(sqlmock.NewRows(feedColumns))
+	mock.ExpectExec(`WHERE claimed_by = \$1`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	p := &scraper.Pool{
+		Scraper:   &scraper.Scraper{DB: database.New(db), Out: io.Discard},
+		Workers:   2,
+		HostDelay: delay,
+	}
+	if err := p.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	if len(hits) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(hits))
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Before(hits[j]) })
+	if gap := hits[1].Sub(hits[0]); gap < delay-10*time.Millisecond {
+		t.Errorf("expected requests to one host at least %s apart, got %s", delay, gap)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPoolRun_StopsOnCancel(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectQuery(`UPDATE feeds\s+SET claimed_until = NOW`).WillReturnRows(sqlmock.NewRows(feedColumns))
+	mock.ExpectExec(`WHERE claimed_by = \$1`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &scraper.Pool{Scraper: &scraper.Scraper{DB: database.New(db), Out: io.Discard}, Workers: 3}
+
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx, time.Hour) }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected clean shutdown, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Run did not return after cancellation")
+	}
+}
+
+func TestPoolRun_PurgesAfterScraping(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectQuery(`UPDATE feeds\s+SET claimed_until = NOW`).WillReturnRows(sqlmock.NewRows(feedColumns))
+	mock.ExpectExec(`WHERE claimed_by = \$1`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`DELETE FROM posts`).
+		WithArgs(int32(0), int32(500), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"feed_name", "deleted"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &scraper.Pool{
+		Scraper:    &scraper.Scraper{DB: database.New(db), Retention: scraper.Retention{MaxPosts: 500}, Out: io.Discard},
+		Workers:    1,
+		PurgeEvery: time.Hour,
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx, time.Hour) }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPoolRunOnce_ClaimsWithPoolID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	id := sql.NullString{String: "scraper-a", Valid: true}
+	mock.ExpectQuery(`UPDATE feeds\s+SET claimed_until = NOW`).
+		WithArgs(int32(90), id, int32(6)).
+		WillReturnRows(sqlmock.NewRows(feedColumns))
+	mock.ExpectExec(`WHERE claimed_by = \$1`).
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	p := &scraper.Pool{
+		Scraper: &scraper.Scraper{DB: database.New(db), Out: io.Discard},
+		Workers: 3,
+		Lease:   90 * time.Second,
+		ID:      "scraper-a",
+	}
+	if err := p.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/markcromwell/gator/internal/database"
+)
+
+// Retention is the default post retention policy. Feeds can override either
+// limit (feeds.retention_days, feeds.retention_max_posts).
+type Retention struct {
+	// Days deletes posts published more than this many days ago; 0 keeps
+	// posts regardless of age.
+	Days int
+	// MaxPosts keeps only this many of each feed's newest posts; 0 keeps any
+	// number.
+	MaxPosts int
+}
+
+// Purge deletes the posts that fall outside the retention policy, except
+// starred ones, and returns how many were deleted. Each feed that lost posts
+// is reported on Out.
+func (s *Scraper) Purge(ctx context.Context) (int64, error) {
+	rows, err := s.DB.PurgePosts(ctx, database.PurgePostsParams{
+		DefaultDays:     int32(s.Retention.Days),
+		DefaultMaxPosts: int32(s.Retention.MaxPosts),
+		Now:             time.Now().UTC(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("purge posts: %w", err)
+	}
+	var total int64
+	for _, row := range rows {
+		fmt.Fprintf(s.out(), "Purged %d posts from %s\n", row.Deleted, row.FeedName)
+		total += row.Deleted
+	}
+	return total, nil
+}
@@ -0,0 +1,119 @@
+package scraper_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/scraper"
+	"github.com/markcromwell/gator/internal/webhook"
+)
+
+func TestPurge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`(?s)DELETE FROM posts.*INSERT INTO purged_posts`).
+		WithArgs(int32(90), int32(0), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"feed_name", "deleted"}).
+			AddRow("busy", int64(120)).
+			AddRow("quiet", int64(3)))
+
+	var out bytes.Buffer
+	s := &scraper.Scraper{DB: database.New(db), Retention: scraper.Retention{Days: 90}, Out: &out}
+	n, err := s.Purge(context.Background())
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if n != 123 {
+		t.Errorf("expected 123 posts purged, got %d", n)
+	}
+	if !strings.Contains(out.String(), "Purged 120 posts from busy") || !strings.Contains(out.String(), "Purged 3 posts from quiet") {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPurgeThenRescrape(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `<rss version="2.0"><channel><title>Example</title>
+<item><guid>old-1</guid><title>Old</title><link>https://example.com/old</link></item>
+</channel></rss>`)
+	}))
+	defer srv.Close()
+	var hits atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer target.Close()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	fid := uuid.New()
+	now := time.Now()
+	f := database.Feed{ID: fid, Name: "example", Url: srv.URL, FetchIntervalSeconds: 600}
+
+	// the purge records what it deleted...
+	mock.ExpectQuery(`(?s)DELETE FROM posts.*INSERT INTO purged_posts`).
+		WithArgs(int32(0), int32(1), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"feed_name", "deleted"}).AddRow("example", int64(1)))
+	// ...so the item still in the feed is skipped rather than stored anew
+	mock.ExpectQuery(`FROM filter_rules r`).
+		WithArgs(fid).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "user_id", "feed_id", "field", "pattern", "is_regex", "action"}))
+	mock.ExpectQuery(`FROM webhooks w`).
+		WithArgs(fid).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "user_id", "url", "secret", "feed_id", "keyword"}).
+			AddRow(uuid.New(), now, uuid.New(), target.URL, nil, nil, nil))
+	mock.ExpectQuery(`(?s)INSERT INTO posts.*NOT EXISTS.*FROM purged_posts`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "Old", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), fid, "old-1", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`UPDATE feeds\s+SET etag`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE feeds\s+SET last_fetched_at`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE feeds\s+SET consecutive_failures = 0`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE feeds\s+SET fetch_interval_seconds`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s := &scraper.Scraper{
+		DB:        database.New(db),
+		Retention: scraper.Retention{MaxPosts: 1},
+		Webhooks:  &webhook.Dispatcher{DB: database.New(db), Out: &bytes.Buffer{}},
+		Out:       &bytes.Buffer{},
+	}
+	if _, err := s.Purge(context.Background()); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	stats, err := s.ScrapeFeed(context.Background(), f)
+	if err != nil {
+		t.Fatalf("ScrapeFeed: %v", err)
+	}
+	s.Wait()
+
+	if stats != (scraper.Stats{Unchanged: 1}) {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if hits.Load() != 0 {
+		t.Errorf("webhook fired %d times for a purged post", hits.Load())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package scraper
+
+import (
+	"time"
+
+	"github.com/markcromwell/gator/internal/feed"
+)
+
+// Default bounds for the adaptive polling interval.
+const (
+	DefaultMinInterval = 5 * time.Minute
+	DefaultMaxInterval = 24 * time.Hour
+)
+
+// Schedule bounds the adaptive per-feed polling interval. Zero fields take
+// the defaults.
+type Schedule struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+func (sc Schedule) bounds() (time.Duration, time.Duration) {
+	lo, hi := sc.Min, sc.Max
+	if lo <= 0 {
+		lo = DefaultMinInterval
+	}
+	if hi <= 0 {
+		hi = DefaultMaxInterval
+	}
+	if hi < lo {
+		hi = lo
+	}
+	return lo, hi
+}
+
+// NextInterval adapts a feed's polling interval after a successful fetch:
+// it is halved when the fetch found new posts and grows by half when it
+// found none, so busy feeds are polled often and quiet ones rarely. The
+// result is never shorter than the publisher's requested minimum and is
+// clamped to the schedule's bounds.
+func (sc Schedule) NextInterval(current time.Duration, newPosts int, hints feed.PollHints) time.Duration {
+	lo, hi := sc.bounds()
+	if current <= 0 {
+		current = lo
+	}
+
+	next := current + current/2
+	if newPosts > 0 {
+		next = current / 2
+	}
+
+	next = max(next, hints.MinInterval, lo)
+	return min(next, hi)
+}
+
+// Backoff returns how long to wait before retrying a feed that has failed
+// failures times in a row: its polling interval, doubled for every failure
+// after the first, capped at the schedule's maximum.
+func (sc Schedule) Backoff(current time.Duration, failures int) time.Duration {
+	lo, hi := sc.bounds()
+	d := max(current, lo)
+	for i := 1; i < failures && d < hi; i++ {
+		d *= 2
+	}
+	return min(d, hi)
+}
+
+// NextFetch returns when a feed polled at interval is next due, moved past
+// any hours or days the publisher asked us to skip.
+func NextFetch(now time.Time, interval time.Duration, hints feed.PollHints) time.Time {
+	t := now.Add(interval)
+	// A week of hours covers every combination of skipHours and skipDays;
+	// if everything is skipped, give up and use the plain interval.
+	for range 24 * 7 {
+		if !hints.Skips(t) {
+			return t
+		}
+		t = t.Truncate(time.Hour).Add(time.Hour)
+	}
+	return now.Add(interval)
+}
@@ -0,0 +1,73 @@
+package scraper_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/markcromwell/gator/internal/feed"
+	"github.com/markcromwell/gator/internal/scraper"
+)
+
+func TestScheduleNextInterval(t *testing.T) {
+	sc := scraper.Schedule{Min: 10 * time.Minute, Max: 2 * time.Hour}
+
+	tests := []struct {
+		name     string
+		current  time.Duration
+		newPosts int
+		hints    feed.PollHints
+		want     time.Duration
+	}{
+		{"new posts halve", time.Hour, 3, feed.PollHints{}, 30 * time.Minute},
+		{"quiet feeds back off", time.Hour, 0, feed.PollHints{}, 90 * time.Minute},
+		{"bounded below", 15 * time.Minute, 1, feed.PollHints{}, 10 * time.Minute},
+		{"bounded above", 100 * time.Minute, 0, feed.PollHints{}, 2 * time.Hour},
+		{"publisher ttl wins over halving", time.Hour, 1, feed.PollHints{MinInterval: 45 * time.Minute}, 45 * time.Minute},
+		{"unset interval starts at min", 0, 1, feed.PollHints{}, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := sc.NextInterval(tt.current, tt.newPosts, tt.hints); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNextFetchSkipsHoursAndDays(t *testing.T) {
+	// Friday 2024-03-01 21:30 UTC
+	now := time.Date(2024, 3, 1, 21, 30, 0, 0, time.UTC)
+	hints := feed.PollHints{
+		SkipHours: map[int]bool{22: true, 23: true},
+		SkipDays:  map[time.Weekday]bool{time.Saturday: true},
+	}
+
+	got := scraper.NextFetch(now, time.Hour, hints)
+	want := time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC) // Sunday midnight
+	if !got.Equal(want) {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	if got := scraper.NextFetch(now, 10*time.Minute, hints); !got.Equal(now.Add(10 * time.Minute)) {
+		t.Fatalf("expected unskipped time to be kept, got %s", got)
+	}
+}
+
+func TestScheduleBackoff(t *testing.T) {
+	sc := scraper.Schedule{Min: 10 * time.Minute, Max: 2 * time.Hour}
+
+	tests := []struct {
+		current  time.Duration
+		failures int
+		want     time.Duration
+	}{
+		{30 * time.Minute, 1, 30 * time.Minute},
+		{30 * time.Minute, 2, time.Hour},
+		{30 * time.Minute, 3, 2 * time.Hour},
+		{30 * time.Minute, 50, 2 * time.Hour},
+		{time.Minute, 1, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := sc.Backoff(tt.current, tt.failures); got != tt.want {
+			t.Errorf("Backoff(%s, %d) = %s, want %s", tt.current, tt.failures, got, tt.want)
+		}
+	}
+}
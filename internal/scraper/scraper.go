@@ -0,0 +1,418 @@
+// Package scraper fetches feeds and stores their items as posts.
+package scraper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/feed"
+	"github.com/markcromwell/gator/internal/filter"
+	"github.com/markcromwell/gator/internal/notify"
+	"github.com/markcromwell/gator/internal/webhook"
+)
+
+// Scraper fetches feeds and upserts their items into the posts table.
+type Scraper struct {
+	DB *database.Queries
+	// Schedule bounds the adaptive polling interval of each feed.
+	Schedule Schedule
+	// DisableAfter is how many consecutive failures disable a feed;
+	// DefaultDisableAfter when zero.
+	DisableAfter int
+	// Retention is the default policy Purge applies.
+	Retention Retention
+	// Webhooks, when set, delivers each newly stored post to the webhooks
+	// of the users following its feed.
+	Webhooks *webhook.Dispatcher
+	// Notifiers, when set, announces each newly stored post through the
+	// chat notifiers of the users following its feed.
+	Notifiers *notify.Dispatcher
+	// Out receives progress messages; os.Stdout when nil.
+	Out io.Writer
+}
+
+// DefaultDisableAfter is the number of consecutive failed fetches after
+// which a feed is disabled when Scraper.DisableAfter is zero.
+const DefaultDisableAfter = 10
+
+// FetchError is the error ScrapeFeed returns when the feed could not be
+// fetched or parsed.
+type FetchError struct {
+	URL string
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("fetch %s: %v", e.URL, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Stats counts what happened to a feed's items during one fetch.
+type Stats struct {
+	New       int
+	Updated   int
+	Unchanged int
+	Failed    int
+}
+
+func (st Stats) String() string {
+	return fmt.Sprintf("%d new, %d updated, %d unchanged, %d failed", st.New, st.Updated, st.Unchanged, st.Failed)
+}
+
+func (st *Stats) add(o Stats) {
+	st.New += o.New
+	st.Updated += o.Updated
+	st.Unchanged += o.Unchanged
+	st.Failed += o.Failed
+}
+
+func (s *Scraper) out() io.Writer {
+	if s.Out == nil {
+		return os.Stdout
+	}
+	return s.Out
+}
+
+// ScrapeFeed fetches f, stores its items, marks it fetched and schedules
+// its next fetch. The feed is marked fetched even when the fetch fails; the
+// failure is recorded (see RecordFailure) and the fetch error is returned.
+func (s *Scraper) ScrapeFeed(ctx context.Context, f database.Feed) (Stats, error) {
+	stats, res, err := s.fetchAndStore(ctx, f)
+	if markErr := s.DB.MarkFeedFetched(ctx, f.ID); markErr != nil {
+		fmt.Fprintln(s.out(), "Error marking feed fetched:", markErr)
+	}
+	if err != nil {
+		// A fetch cut short by shutdown says nothing about the feed.
+		if ctx.Err() == nil {
+			s.RecordFailure(ctx, f, err)
+		}
+		return stats, err
+	}
+	s.RecordSuccess(ctx, f, res.StatusCode)
+
+	var hints feed.PollHints
+	if res.Feed != nil {
+		hints = res.Feed.PollHints()
+	}
+	current := time.Duration(f.FetchIntervalSeconds) * time.Second
+	interval := s.Schedule.NextInterval(current, stats.New, hints)
+	next := NextFetch(time.Now().UTC(), interval, hints)
+	if schedErr := s.DB.ScheduleFeed(ctx, database.ScheduleFeedParams{
+		ID:                   f.ID,
+		FetchIntervalSeconds: int32(interval / time.Second),
+		NextFetchAt:          sql.NullTime{Time: next, Valid: true},
+	}); schedErr != nil {
+		fmt.Fprintln(s.out(), "Error scheduling feed:", schedErr)
+	}
+	return stats, nil
+}
+
+// RecordSuccess resets the failure count of f after a fetch that returned
+// status.
+func (s *Scraper) RecordSuccess(ctx context.Context, f database.Feed, status int) {
+	if err := s.DB.RecordFeedSuccess(ctx, database.RecordFeedSuccessParams{
+		ID:         f.ID,
+		LastStatus: sql.NullInt32{Int32: int32(status), Valid: status != 0},
+	}); err != nil {
+		fmt.Fprintln(s.out(), "Error recording feed success:", err)
+	}
+}
+
+// RecordFailure records that fetching f failed with fetchErr. The feed is
+// retried after an exponential backoff (see Schedule.Backoff) and disabled
+// once it has failed DisableAfter times in a row.
+func (s *Scraper) RecordFailure(ctx context.Context, f database.Feed, fetchErr error) {
+	failures := int(f.ConsecutiveFailures) + 1
+	current := time.Duration(f.FetchIntervalSeconds) * time.Second
+	next := time.Now().UTC().Add(s.Schedule.Backoff(current, failures))
+
+	disableAfter := s.DisableAfter
+	if disableAfter <= 0 {
+		disableAfter = DefaultDisableAfter
+	}
+
+	row, err := s.DB.RecordFeedFailure(ctx, database.RecordFeedFailureParams{
+		LastError:    nullString(fetchErr.Error()),
+		LastStatus:   httpStatus(fetchErr),
+		NextFetchAt:  sql.NullTime{Time: next, Valid: true},
+		DisableAfter: int32(disableAfter),
+		ID:           f.ID,
+	})
+	if err != nil {
+		fmt.Fprintln(s.out(), "Error recording feed failure:", err)
+		return
+	}
+	if row.DisabledAt.Valid {
+		fmt.Fprintf(s.out(), "Feed %s disabled after %d consecutive failures\n", f.Name, row.ConsecutiveFailures)
+	}
+}
+
+func (s *Scraper) fetchAndStore(ctx context.Context, f database.Feed) (Stats, *feed.FetchResult, error) {
+	var stats Stats
+
+	fmt.Fprintln(s.out(), "Fetching feed:", f.Url)
+	res, err := feed.FetchFeedConditional(ctx, f.Url, feed.Validators{
+		ETag:         f.Etag.String,
+		LastModified: f.LastModified.String,
+	})
+	if err != nil {
+		return stats, nil, &FetchError{URL: f.Url, Err: err}
+	}
+	if res.NotModified {
+		fmt.Fprintln(s.out(), "Feed not modified; no new items")
+		return stats, res, nil
+	}
+
+	var (
+		rules     map[uuid.UUID][]filter.Rule
+		hooks     []database.Webhook
+		notifiers []database.Notifier
+	)
+	if len(res.Feed.Channel.Item) > 0 {
+		rules = s.loadRules(ctx, f)
+		hooks = s.loadWebhooks(ctx, f)
+		notifiers = s.loadNotifiers(ctx, f)
+	}
+
+	for _, item := range res.Feed.Channel.Item {
+		row, err := s.storeItem(ctx, f, item)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			stats.Unchanged++
+		case err != nil:
+			stats.Failed++
+			fmt.Fprintln(s.out(), "Error storing post:", err)
+		case row.Inserted:
+			stats.New++
+			fmt.Fprintf(s.out(), "- %s\n  %s\n", row.Title, row.Url)
+			muted := s.applyRules(ctx, rules, row)
+			s.announce(hooks, notifiers, muted, f, row)
+		default:
+			stats.Updated++
+			fmt.Fprintf(s.out(), "~ %s\n  %s\n", row.Title, row.Url)
+		}
+	}
+
+	// The validators make the next fetch conditional, so they are only kept
+	// once every item is stored; otherwise a 304 would hide the items that
+	// failed until the feed changes again.
+	if stats.Failed == 0 {
+		if err := s.DB.UpdateFeedValidators(ctx, database.UpdateFeedValidatorsParams{
+			ID:           f.ID,
+			Etag:         nullString(res.Validators.ETag),
+			LastModified: nullString(res.Validators.LastModified),
+		}); err != nil {
+			fmt.Fprintln(s.out(), "Error storing feed validators:", err)
+		}
+	}
+
+	fmt.Fprintf(s.out(), "Feed %s: %s\n", f.Name, stats)
+	return stats, res, nil
+}
+
+// storeItem upserts a single feed item. sql.ErrNoRows means the stored post
+// was already up to date, or was purged by retention and is not stored again.
+func (s *Scraper) storeItem(ctx context.Context, f database.Feed, item feed.RSSItem) (database.UpsertPostRow, error) {
+	postDate, err := feed.ParseFeedDate(item.PubDate)
+	if err != nil {
+		fmt.Fprintln(s.out(), "Error parsing post date:", err, "- using current time")
+		postDate = time.Now().UTC()
+	}
+
+	// Prefer the summary; fall back to the full content (Atom entries and
+	// content:encoded items often only carry one).
+	description := item.Description
+	if description == "" {
+		description = item.Content
+	}
+
+	// categories is NOT NULL; an empty array rather than a nil one.
+	categories := item.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+
+	now := time.Now().UTC()
+	return s.DB.UpsertPost(ctx, database.UpsertPostParams{
+		ID:          uuid.New(),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Title:       item.Title,
+		Url:         item.Link,
+		Description: nullString(description),
+		PublishedAt: postDate,
+		FeedID:      f.ID,
+		Guid:        itemGUID(item),
+		Author:      nullString(item.Author),
+		Categories:  categories,
+	})
+}
+
+// loadRules returns the filter rules of the users following f, by user.
+// Rules that fail to load or compile are reported and skipped.
+func (s *Scraper) loadRules(ctx context.Context, f database.Feed) map[uuid.UUID][]filter.Rule {
+	rows, err := s.DB.GetFilterRulesForFeed(ctx, f.ID)
+	if err != nil {
+		fmt.Fprintln(s.out(), "Error loading filter rules:", err)
+		return nil
+	}
+	rules := make(map[uuid.UUID][]filter.Rule)
+	for _, row := range rows {
+		r, err := filter.FromDB(row)
+		if err != nil {
+			fmt.Fprintln(s.out(), "Skipping filter rule:", err)
+			continue
+		}
+		rules[row.UserID] = append(rules[row.UserID], r)
+	}
+	return rules
+}
+
+// loadWebhooks returns the webhooks that fire for new posts of f, or none
+// when s has no Dispatcher.
+func (s *Scraper) loadWebhooks(ctx context.Context, f database.Feed) []database.Webhook {
+	if s.Webhooks == nil {
+		return nil
+	}
+	hooks, err := s.DB.GetWebhooksForFeed(ctx, f.ID)
+	if err != nil {
+		fmt.Fprintln(s.out(), "Error loading webhooks:", err)
+		return nil
+	}
+	return hooks
+}
+
+// loadNotifiers returns the chat notifiers that fire for new posts of f, or
+// none when s has no notify.Dispatcher.
+func (s *Scraper) loadNotifiers(ctx context.Context, f database.Feed) []database.Notifier {
+	if s.Notifiers == nil {
+		return nil
+	}
+	notifiers, err := s.DB.GetNotifiersForFeed(ctx, f.ID)
+	if err != nil {
+		fmt.Fprintln(s.out(), "Error loading notifiers:", err)
+		return nil
+	}
+	return notifiers
+}
+
+// applyRules records, for each user with rules, what they decide for a
+// newly stored post, and returns the users who muted it.
+func (s *Scraper) applyRules(ctx context.Context, rules map[uuid.UUID][]filter.Rule, row database.UpsertPostRow) map[uuid.UUID]bool {
+	muted := make(map[uuid.UUID]bool)
+	post := filter.Post{
+		FeedID:      row.FeedID,
+		Title:       row.Title,
+		Description: row.Description.String,
+		Author:      row.Author.String,
+		Categories:  row.Categories,
+	}
+	for userID, userRules := range rules {
+		res := filter.Evaluate(userRules, post)
+		if !res.Any() {
+			continue
+		}
+		if res.Mute {
+			muted[userID] = true
+		}
+		if err := s.DB.ApplyPostFilter(ctx, database.ApplyPostFilterParams{
+			UserID:      userID,
+			PostID:      row.ID,
+			Muted:       res.Mute,
+			Highlighted: res.Highlight,
+			Read:        res.Read,
+			Starred:     res.Star,
+		}); err != nil {
+			fmt.Fprintln(s.out(), "Error applying filter rules:", err)
+		}
+	}
+	return muted
+}
+
+// announce hands a newly stored post to the webhooks and notifiers of the
+// users who did not mute it.
+func (s *Scraper) announce(hooks []database.Webhook, notifiers []database.Notifier, muted map[uuid.UUID]bool, f database.Feed, row database.UpsertPostRow) {
+	var targetHooks []database.Webhook
+	for _, w := range hooks {
+		if !muted[w.UserID] {
+			targetHooks = append(targetHooks, w)
+		}
+	}
+	if len(targetHooks) > 0 {
+		s.Webhooks.Dispatch(targetHooks, f, row)
+	}
+
+	var targetNotifiers []database.Notifier
+	for _, n := range notifiers {
+		if !muted[n.UserID] {
+			targetNotifiers = append(targetNotifiers, n)
+		}
+	}
+	if len(targetNotifiers) > 0 {
+		s.Notifiers.Dispatch(targetNotifiers, f, row)
+	}
+}
+
+// Wait blocks until the webhook deliveries and notifications of posts
+// stored so far have finished.
+func (s *Scraper) Wait() {
+	if s.Webhooks != nil {
+		s.Webhooks.Wait()
+	}
+	if s.Notifiers != nil {
+		s.Notifiers.Wait()
+	}
+}
+
+// Shutdown drops the webhook deliveries and notifications that have not
+// started, stops retrying the others and waits until ctx is done for the
+// requests in flight.
+func (s *Scraper) Shutdown(ctx context.Context) error {
+	var errs []error
+	if s.Webhooks != nil {
+		errs = append(errs, s.Webhooks.Shutdown(ctx))
+	}
+	if s.Notifiers != nil {
+		errs = append(errs, s.Notifiers.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// itemGUID returns the identifier used to recognise item on later fetches:
+// its GUID, else its link, else its title.
+func itemGUID(item feed.RSSItem) string {
+	switch {
+	case item.GUID != "":
+		return item.GUID
+	case item.Link != "":
+		return item.Link
+	default:
+		return item.Title
+	}
+}
+
+// httpStatus returns the HTTP status carried by a fetch error, if any.
+func httpStatus(err error) sql.NullInt32 {
+	var httpErr *feed.HTTPError
+	if errors.As(err, &httpErr) {
+		return sql.NullInt32{Int32: int32(httpErr.StatusCode), Valid: true}
+	}
+	return sql.NullInt32{}
+}
+
+func nullString(s string) sql.NullString {
+	if s == "" {
+		return sql.NullString{Valid: false}
+	}
+	return sql.NullString{String: s, Valid: true}
+}
@@ -0,0 +1,319 @@
+package scraper_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/notify"
+	"github.com/markcromwell/gator/internal/scraper"
+	"github.com/markcromwell/gator/internal/webhook"
+)
+
+const sampleRSS = `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0">
+<channel>
+  <title>Example</title>
+  <item>
+    <guid>post-1</guid>
+    <title>First</title>
+    <link>https://example.com/1</link>
+    <pubDate>Mon, 06 Sep 2021 12:00:00 GMT</pubDate>
+    <author>ads@example.com</author>
+    <category>Sponsored</category>
+  </item>
+  <item>
+    <title>Second</title>
+    <link>https://example.com/2</link>
+  </item>
+  <item>
+    <title>Third</title>
+    <link>https://example.com/3</link>
+  </item>
+</channel>
+</rss>`
+
+var postColumns = []string{"id", "created_at", "updated_at", "title", "url", "description", "published_at", "feed_id", "guid", "search_vector", "author", "categories", "seq", "inserted"}
+
+func TestScrapeFeed_CountsNewUpdatedUnchanged(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		fmt.Fprintln(w, sampleRSS)
+	}))
+	defer srv.Close()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	fid := uuid.New()
+	now := time.Now()
+	f := database.Feed{ID: fid, Name: "example", Url: srv.URL, FetchIntervalSeconds: 600}
+
+	// a follower mutes sponsored posts
+	userID, firstID := uuid.New(), uuid.New()
+	mock.ExpectQuery(`FROM filter_rules r`).
+		WithArgs(fid).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "user_id", "feed_id", "field", "pattern", "is_regex", "action"}).
+			AddRow(uuid.New(), now, userID, nil, "category", "sponsored", false, "mute"))
+	// guid is used when present, otherwise the link
+	mock.ExpectQuery(`INSERT INTO posts`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "First", "https://example.com/1", sqlmock.AnyArg(), sqlmock.AnyArg(), fid, "post-1",
+			sql.NullString{String: "ads@example.com", Valid: true}, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(postColumns).AddRow(firstID, now, now, "First", "https://example.com/1", nil, now, fid, "post-1", nil, "ads@example.com", "{Sponsored}", int64(5), true))
+	mock.ExpectExec(`INSERT INTO user_post_state`).
+		WithArgs(userID, firstID, true, false, false, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO posts`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "Second", "https://example.com/2", sqlmock.AnyArg(), sqlmock.AnyArg(), fid, "https://example.com/2",
+			sql.NullString{}, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(postColumns).AddRow(uuid.New(), now, now, "Second", "https://example.com/2", nil, now, fid, "https://example.com/2", nil, nil, "{}", int64(6), false))
+	mock.ExpectQuery(`INSERT INTO posts`).
+		WillReturnError(sql.ErrNoRows)
+	// validators are saved once every item is stored
+	mock.ExpectExec(`UPDATE feeds\s+SET etag`).
+		WithArgs(fid, sql.NullString{String: `"abc"`, Valid: true}, sql.NullString{}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE feeds\s+SET last_fetched_at`).
+		WithArgs(fid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE feeds\s+SET consecutive_failures = 0`).
+		WithArgs(fid, sql.NullInt32{Int32: http.StatusOK, Valid: true}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// a new post halves the interval, bounded below by the default minimum
+	mock.ExpectExec(`UPDATE feeds\s+SET fetch_interval_seconds`).
+		WithArgs(fid, int32(scraper.DefaultMinInterval/time.Second), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var out bytes.Buffer
+	s := &scraper.Scraper{DB: database.New(db), Out: &out}
+	stats, err := s.ScrapeFeed(context.Background(), f)
+	if err != nil {
+		t.Fatalf("ScrapeFeed: %v", err)
+	}
+
+	if stats != (scraper.Stats{New: 1, Updated: 1, Unchanged: 1}) {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if !strings.Contains(out.String(), "1 new, 1 updated, 1 unchanged") {
+		t.Errorf("expected summary in output, got: %s", out.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestScrapeFeed_KeepsValidatorsUnsetAfterStoreFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		fmt.Fprintln(w, sampleRSS)
+	}))
+	defer srv.Close()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	fid := uuid.New()
+	now := time.Now()
+	f := database.Feed{ID: fid, Name: "example", Url: srv.URL, FetchIntervalSeconds: 600}
+
+	mock.ExpectQuery(`FROM filter_rules r`).
+		WithArgs(fid).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "user_id", "feed_id", "field", "pattern", "is_regex", "action"}))
+	mock.ExpectQuery(`INSERT INTO posts`).
+		WillReturnRows(sqlmock.NewRows(postColumns).AddRow(uuid.New(), now, now, "First", "https://example.com/1", nil, now, fid, "post-1", nil, nil, "{}", int64(5), true))
+	mock.ExpectQuery(`INSERT INTO posts`).
+		WillReturnError(fmt.Errorf("connection reset"))
+	mock.ExpectQuery(`INSERT INTO posts`).
+		WillReturnError(sql.ErrNoRows)
+	// no UPDATE feeds SET etag: the next fetch must not be answered with a 304
+	mock.ExpectExec(`UPDATE feeds\s+SET last_fetched_at`).
+		WithArgs(fid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE feeds\s+SET consecutive_failures = 0`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE feeds\s+SET fetch_interval_seconds`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s := &scraper.Scraper{DB: database.New(db), Out: &bytes.Buffer{}}
+	stats, err := s.ScrapeFeed(context.Background(), f)
+	if err != nil {
+		t.Fatalf("ScrapeFeed: %v", err)
+	}
+	if stats != (scraper.Stats{New: 1, Unchanged: 1, Failed: 1}) {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestScrapeFeed_NotModified(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != `"abc"` {
+			t.Errorf("expected If-None-Match header, got %q", r.Header.Get("If-None-Match"))
+		}
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer srv.Close()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	fid := uuid.New()
+	f := database.Feed{ID: fid, Url: srv.URL, Etag: sql.NullString{String: `"abc"`, Valid: true}, FetchIntervalSeconds: 600}
+
+	// a 304 still marks the feed fetched, and stores no posts
+	mock.ExpectExec(`UPDATE feeds\s+SET last_fetched_at`).
+		WithArgs(fid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE feeds\s+SET consecutive_failures = 0`).
+		WithArgs(fid, sql.NullInt32{Int32: http.StatusNotModified, Valid: true}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// nothing new, so the interval backs off from 10 to 15 minutes
+	mock.ExpectExec(`UPDATE feeds\s+SET fetch_interval_seconds`).
+		WithArgs(fid, int32(900), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s := &scraper.Scraper{DB: database.New(db), Out: &bytes.Buffer{}}
+	stats, err := s.ScrapeFeed(context.Background(), f)
+	if err != nil {
+		t.Fatalf("ScrapeFeed: %v", err)
+	}
+	if stats != (scraper.Stats{}) {
+		t.Fatalf("expected empty stats, got %+v", stats)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestScrapeFeed_RecordsFailureAndDisables(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	fid := uuid.New()
+	f := database.Feed{ID: fid, Name: "gone", Url: srv.URL, FetchIntervalSeconds: 600, ConsecutiveFailures: 2}
+
+	mock.ExpectExec(`UPDATE feeds\s+SET last_fetched_at`).
+		WithArgs(fid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// third failure in a row with DisableAfter 3: the feed is disabled
+	mock.ExpectQuery(`UPDATE feeds\s+SET consecutive_failures = consecutive_failures \+ 1`).
+		WithArgs(sqlmock.AnyArg(), sql.NullInt32{Int32: http.StatusNotFound, Valid: true}, sqlmock.AnyArg(), int32(3), fid).
+		WillReturnRows(sqlmock.NewRows([]string{"consecutive_failures", "disabled_at"}).AddRow(3, time.Now()))
+
+	var out bytes.Buffer
+	s := &scraper.Scraper{DB: database.New(db), Out: &out, DisableAfter: 3}
+	if _, err := s.ScrapeFeed(context.Background(), f); err == nil {
+		t.Fatalf("expected fetch error")
+	}
+	if !strings.Contains(out.String(), "Feed gone disabled after 3 consecutive failures") {
+		t.Errorf("expected disable notice, got: %s", out.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestScrapeFeed_WebhooksAndNotifiers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, sampleRSS)
+	}))
+	defer srv.Close()
+	var hits atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer target.Close()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+	// deliveries are logged from their own goroutines
+	mock.MatchExpectationsInOrder(false)
+
+	fid, postID := uuid.New(), uuid.New()
+	alice, bob := uuid.New(), uuid.New()
+	now := time.Now()
+	f := database.Feed{ID: fid, Name: "example", Url: srv.URL, FetchIntervalSeconds: 600}
+	aliceHook, bobHook := uuid.New(), uuid.New()
+
+	mock.ExpectExec(`UPDATE feeds\s+SET etag`).WillReturnResult(sqlmock.NewResult(0, 1))
+	// bob mutes sponsored posts, so only alice's webhook and notifier fire
+	mock.ExpectQuery(`FROM filter_rules r`).
+		WithArgs(fid).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "user_id", "feed_id", "field", "pattern", "is_regex", "action"}).
+			AddRow(uuid.New(), now, bob, nil, "category", "sponsored", false, "mute"))
+	mock.ExpectQuery(`FROM webhooks w`).
+		WithArgs(fid).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "user_id", "url", "secret", "feed_id", "keyword"}).
+			AddRow(aliceHook, now, alice, target.URL, nil, nil, nil).
+			AddRow(bobHook, now, bob, target.URL, nil, nil, nil))
+	mock.ExpectQuery(`FROM notifiers n`).
+		WithArgs(fid).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "user_id", "kind", "url", "room_id", "access_token", "feed_id"}).
+			AddRow(uuid.New(), now, alice, "slack", target.URL, nil, nil, nil).
+			AddRow(uuid.New(), now, bob, "discord", target.URL, nil, nil, nil))
+	mock.ExpectQuery(`INSERT INTO posts`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "First", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), fid, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(postColumns).AddRow(postID, now, now, "First", "https://example.com/1", nil, now, fid, "post-1", nil, "ads@example.com", "{Sponsored}", int64(5), true))
+	mock.ExpectExec(`INSERT INTO user_post_state`).
+		WithArgs(bob, postID, true, false, false, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	for range 2 {
+		mock.ExpectQuery(`INSERT INTO posts`).WillReturnError(sql.ErrNoRows)
+	}
+	mock.ExpectExec(`INSERT INTO webhook_deliveries`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), aliceHook, postID, int32(1), sqlmock.AnyArg(), sqlmock.AnyArg(), true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE feeds\s+SET last_fetched_at`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE feeds\s+SET consecutive_failures = 0`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE feeds\s+SET fetch_interval_seconds`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s := &scraper.Scraper{
+		DB:        database.New(db),
+		Webhooks:  &webhook.Dispatcher{DB: database.New(db), Out: &bytes.Buffer{}},
+		Notifiers: &notify.Dispatcher{Out: &bytes.Buffer{}},
+		Out:       &bytes.Buffer{},
+	}
+	if _, err := s.ScrapeFeed(context.Background(), f); err != nil {
+		t.Fatalf("ScrapeFeed: %v", err)
+	}
+	s.Wait()
+
+	if hits.Load() != 2 {
+		t.Errorf("requests = %d, want 2", hits.Load())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
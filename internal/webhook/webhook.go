@@ -0,0 +1,231 @@
+// Package webhook POSTs newly scraped posts as JSON to the webhooks users
+// register, signing each request with the webhook's secret and logging
+// every delivery.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/delivery"
+)
+
+// EventPostCreated is the only event sent so far: a post was stored for the
+// first time.
+const EventPostCreated = "post.created"
+
+// Request headers. SignatureHeader is only set for webhooks with a secret;
+// it holds "sha256=" and the hex HMAC-SHA256 of the body keyed with it.
+const (
+	EventHeader     = "X-Gator-Event"
+	DeliveryHeader  = "X-Gator-Delivery"
+	SignatureHeader = "X-Gator-Signature"
+)
+
+// Delivery defaults, used when the Dispatcher fields are zero.
+const (
+	DefaultAttempts = delivery.DefaultAttempts
+	DefaultBackoff  = delivery.DefaultBackoff
+	DefaultTimeout  = 10 * time.Second
+)
+
+// Payload is the JSON body of a webhook request.
+type Payload struct {
+	Event    string    `json:"event"`
+	Delivery uuid.UUID `json:"delivery"`
+	Webhook  uuid.UUID `json:"webhook_id"`
+	Feed     Feed      `json:"feed"`
+	Post     Post      `json:"post"`
+}
+
+// Feed is the feed a post came from.
+type Feed struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	URL  string    `json:"url"`
+}
+
+// Post is the post a payload announces.
+type Post struct {
+	ID          uuid.UUID `json:"id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Description string    `json:"description,omitempty"`
+	Author      string    `json:"author,omitempty"`
+	Categories  []string  `json:"categories"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// Sign returns the SignatureHeader value for body under secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Matches reports whether w fires for p, a post of the feed feedID: w must
+// be unscoped or scoped to that feed, and its keyword, if any, must appear
+// case-insensitively in the title, description, author or a category.
+func Matches(w database.Webhook, feedID uuid.UUID, p Post) bool {
+	if w.FeedID.Valid && w.FeedID.UUID != feedID {
+		return false
+	}
+	if !w.Keyword.Valid || w.Keyword.String == "" {
+		return true
+	}
+	keyword := strings.ToLower(w.Keyword.String)
+	for _, value := range append([]string{p.Title, p.Description, p.Author}, p.Categories...) {
+		if strings.Contains(strings.ToLower(value), keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatcher delivers payloads in the background on a delivery.Queue keyed
+// by webhook. A delivery is retried on network errors, 429 and 5xx
+// responses, waiting Backoff before the second attempt and twice as long
+// before each one after, or as long as a Retry-After header asks; other
+// responses are final. Each delivery is recorded in webhook_deliveries once
+// it succeeded, ran out of attempts or was cut short by Shutdown.
+type Dispatcher struct {
+	DB *database.Queries
+	// Client sends the requests; one with DefaultTimeout when nil.
+	Client   *http.Client
+	Attempts int
+	Backoff  time.Duration
+	// Out receives delivery errors; os.Stdout when nil.
+	Out io.Writer
+
+	queue delivery.Queue
+}
+
+// Dispatch queues post, newly stored in f, for each of hooks it matches.
+func (d *Dispatcher) Dispatch(hooks []database.Webhook, f database.Feed, row database.UpsertPostRow) {
+	post := Post{
+		ID:          row.ID,
+		Title:       row.Title,
+		URL:         row.Url,
+		Description: row.Description.String,
+		Author:      row.Author.String,
+		Categories:  row.Categories,
+		PublishedAt: row.PublishedAt,
+	}
+	if post.Categories == nil {
+		post.Categories = []string{}
+	}
+	for _, w := range hooks {
+		if !Matches(w, f.ID, post) {
+			continue
+		}
+		p := Payload{
+			Event:    EventPostCreated,
+			Delivery: uuid.New(),
+			Webhook:  w.ID,
+			Feed:     Feed{ID: f.ID, Name: f.Name, URL: f.Url},
+			Post:     post,
+		}
+		d.queue.Add(w.ID.String(), func(ctx context.Context) {
+			d.deliver(ctx, w, p)
+		})
+	}
+}
+
+// Wait blocks until every dispatched delivery has finished.
+func (d *Dispatcher) Wait() {
+	d.queue.Wait()
+}
+
+// Shutdown stops retrying, drops the deliveries that have not started and
+// waits until ctx is done for the requests in flight.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	dropped, err := d.queue.Shutdown(ctx)
+	if dropped > 0 {
+		fmt.Fprintf(d.out(), "Dropped %d queued webhook deliveries\n", dropped)
+	}
+	return err
+}
+
+func (d *Dispatcher) out() io.Writer {
+	if d.Out == nil {
+		return os.Stdout
+	}
+	return d.Out
+}
+
+// deliver sends p to w, retrying as described on Dispatcher, and logs the
+// outcome.
+func (d *Dispatcher) deliver(ctx context.Context, w database.Webhook, p Payload) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		fmt.Fprintln(d.out(), "Error encoding webhook payload:", err)
+		return
+	}
+
+	var status int
+	policy := delivery.Policy{Attempts: d.Attempts, Backoff: d.Backoff}
+	n, err := policy.Do(ctx, func(ctx context.Context) error {
+		var sendErr error
+		status, sendErr = d.send(ctx, w, p, body)
+		return sendErr
+	})
+
+	log := database.CreateWebhookDeliveryParams{
+		ID:         p.Delivery,
+		CreatedAt:  time.Now().UTC(),
+		WebhookID:  w.ID,
+		PostID:     p.Post.ID,
+		Attempts:   int32(n),
+		StatusCode: sql.NullInt32{Int32: int32(status), Valid: status != 0},
+		Succeeded:  err == nil,
+	}
+	if err != nil {
+		log.Error = sql.NullString{String: err.Error(), Valid: true}
+		fmt.Fprintf(d.out(), "Webhook %s failed after %d attempts: %v\n", w.Url, n, err)
+	}
+	// ctx is cancelled on shutdown; the outcome is still worth keeping
+	if err := d.DB.CreateWebhookDelivery(context.WithoutCancel(ctx), log); err != nil {
+		fmt.Fprintln(d.out(), "Error recording webhook delivery:", err)
+	}
+}
+
+// send makes one attempt. It returns the response status, if there was a
+// response; failures worth retrying are *delivery.RetryError.
+func (d *Dispatcher) send(ctx context.Context, w database.Webhook, p Payload, body []byte) (int, error) {
+	client := d.Client
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gator-webhook")
+	req.Header.Set(EventHeader, p.Event)
+	req.Header.Set(DeliveryHeader, p.Delivery.String())
+	if w.Secret.Valid && w.Secret.String != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret.String, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, &delivery.RetryError{Err: err}
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	return resp.StatusCode, delivery.Check(resp)
+}
@@ -0,0 +1,193 @@
+package webhook_test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/webhook"
+)
+
+func newDispatcher(t *testing.T) (*webhook.Dispatcher, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &webhook.Dispatcher{DB: database.New(db), Backoff: time.Millisecond, Out: &bytes.Buffer{}}, mock
+}
+
+func post(feedID uuid.UUID) database.UpsertPostRow {
+	return database.UpsertPostRow{
+		ID:          uuid.New(),
+		Title:       "Go 1.23 is released",
+		Url:         "https://go.dev/blog/go1.23",
+		Description: sql.NullString{String: "Range over func", Valid: true},
+		PublishedAt: time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC),
+		FeedID:      feedID,
+		Categories:  []string{"release"},
+		Inserted:    true,
+	}
+}
+
+func TestSign(t *testing.T) {
+	// RFC 4231, test case 2
+	want := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got := webhook.Sign("Jefe", []byte("what do ya want for nothing?")); got != want {
+		t.Errorf("Sign = %q, want %q", got, want)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	feedID := uuid.New()
+	p := webhook.Post{Title: "Go 1.23", Description: "Iterators", Categories: []string{"Release"}}
+	for _, tc := range []struct {
+		name string
+		w    database.Webhook
+		want bool
+	}{
+		{"unscoped", database.Webhook{}, true},
+		{"this feed", database.Webhook{FeedID: uuid.NullUUID{UUID: feedID, Valid: true}}, true},
+		{"other feed", database.Webhook{FeedID: uuid.NullUUID{UUID: uuid.New(), Valid: true}}, false},
+		{"keyword in category", database.Webhook{Keyword: sql.NullString{String: "release", Valid: true}}, true},
+		{"keyword missing", database.Webhook{Keyword: sql.NullString{String: "rust", Valid: true}}, false},
+	} {
+		if got := webhook.Matches(tc.w, feedID, p); got != tc.want {
+			t.Errorf("%s: Matches = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDispatch_SignsAndRetries(t *testing.T) {
+	var calls atomic.Int32
+	var got webhook.Payload
+	var signature, event string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		signature, event = r.Header.Get(webhook.SignatureHeader), r.Header.Get(webhook.EventHeader)
+		json.Unmarshal(body, &got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	d, mock := newDispatcher(t)
+	f := database.Feed{ID: uuid.New(), Name: "Go Blog", Url: "https://go.dev/blog/feed.atom"}
+	hook := database.Webhook{ID: uuid.New(), Url: srv.URL, Secret: sql.NullString{String: "s3cret", Valid: true}}
+	row := post(f.ID)
+	mock.ExpectExec(`(?i)INSERT INTO webhook_deliveries`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), hook.ID, row.ID, int32(2), sql.NullInt32{Int32: 204, Valid: true}, sql.NullString{}, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	d.Dispatch([]database.Webhook{hook}, f, row)
+	d.Wait()
+
+	if calls.Load() != 2 {
+		t.Fatalf("calls = %d, want 2", calls.Load())
+	}
+	if signature != webhook.Sign("s3cret", body) || event != webhook.EventPostCreated {
+		t.Errorf("signature = %q, event = %q", signature, event)
+	}
+	if got.Webhook != hook.ID || got.Post.ID != row.ID || got.Post.Title != row.Title ||
+		got.Feed.Name != "Go Blog" || got.Post.Description != "Range over func" {
+		t.Errorf("unexpected payload %+v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDispatch_FailuresAndFilters(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get(webhook.SignatureHeader) != "" {
+			t.Errorf("unexpected signature without a secret")
+		}
+		http.Error(w, "gone", http.StatusGone)
+	}))
+	defer srv.Close()
+
+	d, mock := newDispatcher(t)
+	f := database.Feed{ID: uuid.New()}
+	row := post(f.ID)
+	gone := database.Webhook{ID: uuid.New(), Url: srv.URL}
+	skipped := database.Webhook{ID: uuid.New(), Url: srv.URL, Keyword: sql.NullString{String: "rust", Valid: true}}
+	// a 4xx is final: one attempt, logged as failed
+	mock.ExpectExec(`(?i)INSERT INTO webhook_deliveries`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), gone.ID, row.ID, int32(1), sql.NullInt32{Int32: 410, Valid: true},
+			sql.NullString{String: "HTTP 410 Gone", Valid: true}, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	d.Dispatch([]database.Webhook{gone, skipped}, f, row)
+	d.Wait()
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1", calls.Load())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+
+	// an unreachable target is retried until it runs out of attempts
+	srv.Close()
+	mock.ExpectExec(`(?i)INSERT INTO webhook_deliveries`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), gone.ID, row.ID, int32(webhook.DefaultAttempts), sql.NullInt32{}, sqlmock.AnyArg(), false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	d.Dispatch([]database.Webhook{gone}, f, row)
+	d.Wait()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDispatch_OneAtATimePerWebhook(t *testing.T) {
+	var inFlight, most, calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		if n > most.Load() {
+			most.Store(n)
+		}
+		time.Sleep(5 * time.Millisecond)
+		// rate limited once; the queue waits instead of piling on
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	d, mock := newDispatcher(t)
+	f := database.Feed{ID: uuid.New()}
+	hook := database.Webhook{ID: uuid.New(), Url: srv.URL}
+	for range 5 {
+		mock.ExpectExec(`(?i)INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	for range 5 {
+		d.Dispatch([]database.Webhook{hook}, f, post(f.ID))
+	}
+	d.Wait()
+
+	if most.Load() != 1 || calls.Load() != 6 {
+		t.Errorf("most in flight = %d, calls = %d; want 1 and 6", most.Load(), calls.Load())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -1,27 +1,64 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
 	"net/url"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
+	"github.com/markcromwell/gator/internal/api"
 	"github.com/markcromwell/gator/internal/config"
 	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/digest"
 	"github.com/markcromwell/gator/internal/feed"
+	"github.com/markcromwell/gator/internal/fever"
+	"github.com/markcromwell/gator/internal/filter"
+	"github.com/markcromwell/gator/internal/migrate"
+	"github.com/markcromwell/gator/internal/notify"
+	"github.com/markcromwell/gator/internal/opml"
+	"github.com/markcromwell/gator/internal/planet"
+	"github.com/markcromwell/gator/internal/publish"
+	"github.com/markcromwell/gator/internal/scraper"
+	"github.com/markcromwell/gator/internal/webhook"
+	"github.com/markcromwell/gator/sql/schema"
+)
+
+const (
+	// defaultScrapeWorkers is the scrapeFeeds concurrency when neither the
+	// command line nor the config sets one.
+	defaultScrapeWorkers = 4
+	// defaultHostDelay is the minimum gap between requests to one host.
+	defaultHostDelay = 1 * time.Second
+	// defaultServeAddr is where serve listens when no address is given.
+	defaultServeAddr = ":8080"
+	// shutdownTimeout bounds how long scrapeFeeds and serve wait for webhook
+	// deliveries and notifications in flight when they exit.
+	shutdownTimeout = 30 * time.Second
 )
 
 type state struct {
 	config    *config.Config
 	db        *sql.DB
 	dbQueries *database.Queries
+	// discover finds the feeds behind a URL (see feed.Discover); nil skips
+	// autodiscovery and uses URLs as given.
+	discover func(ctx context.Context, pageURL string) ([]feed.Candidate, error)
+	// stdin is where interactive choices are read from; os.Stdin when nil.
+	stdin io.Reader
 }
 
 type command struct {
@@ -120,6 +157,11 @@ func handlerAddFeed(s *state, cmd command, currentUser database.User) error {
 	feedName := cmd.arguments[0]
 	feedURL := cmd.arguments[1]
 
+	feedURL, err := resolveFeedURL(s, feedURL)
+	if err != nil {
+		return err
+	}
+
 	fmt.Printf("Adding feed %s with URL %s for user %s\n", feedName, feedURL, currentUser.Name)
 
 	newFeed, err := s.dbQueries.CreateFeeds(context.Background(), database.CreateFeedsParams{
@@ -157,6 +199,57 @@ func handlerAddFeed(s *state, cmd command, currentUser database.User) error {
 	return nil
 }
 
+// resolveFeedURL runs autodiscovery on rawURL and returns the feed URL to
+// store. When the page announces several feeds the user picks one.
+func resolveFeedURL(s *state, rawURL string) (string, error) {
+	if s.discover == nil {
+		return rawURL, nil
+	}
+
+	candidates, err := s.discover(context.Background(), rawURL)
+	if err != nil {
+		return "", fmt.Errorf("discover feed: %w", err)
+	}
+	chosen := candidates[0]
+	if len(candidates) > 1 {
+		chosen, err = chooseFeed(s, candidates)
+		if err != nil {
+			return "", err
+		}
+	}
+	if chosen.URL != rawURL {
+		fmt.Printf("Found feed %s\n", chosen.URL)
+	}
+	return chosen.URL, nil
+}
+
+// chooseFeed lists candidates and reads the user's choice from stdin.
+func chooseFeed(s *state, candidates []feed.Candidate) (feed.Candidate, error) {
+	fmt.Println("Several feeds were found:")
+	for i, c := range candidates {
+		title := c.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		fmt.Printf("  %d) %s - %s\n", i+1, title, c.URL)
+	}
+	fmt.Printf("Choose a feed [1-%d]: ", len(candidates))
+
+	in := s.stdin
+	if in == nil {
+		in = os.Stdin
+	}
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return feed.Candidate{}, fmt.Errorf("read choice: %w", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || n < 1 || n > len(candidates) {
+		return feed.Candidate{}, fmt.Errorf("invalid choice %q", strings.TrimSpace(line))
+	}
+	return candidates[n-1], nil
+}
+
 func handlerRegister(s *state, cmd command) error {
 	if len(cmd.arguments) == 0 {
 		return fmt.Errorf("username argument is required")
@@ -214,6 +307,15 @@ func handlerAgg(s *state, cmd command) error {
 		return fmt.Errorf("invalid interval: %w", err)
 	}
 
+	scr, err := newScraper(s)
+	if err != nil {
+		return err
+	}
+	lease, err := configDuration("scrape_lease", s.config.ScrapeLease, scraper.DefaultLease)
+	if err != nil {
+		return err
+	}
+
 	fmt.Printf("Collecting feeds every %s\n", interval)
 
 	ticker := time.NewTicker(interval)
@@ -225,26 +327,29 @@ func handlerAgg(s *state, cmd command) error {
 
 	ctx := context.Background()
 
+	// Feeds are claimed like the scrapeFeeds pool does, so agg never fetches
+	// a feed another scraper is working on.
+	claimedBy := strToNullString(scraper.NewClaimID())
+
 	// Run immediately, then on each tick. Outer loop waits for ticker or signal.
 	for {
 		// Try up to 10 feeds per tick
-		for i := 0; i < 10; i++ {
-			f, err := s.dbQueries.GetNextFeedToFetch(ctx)
-			if err != nil {
-				// no ready feeds or DB error; stop inner loop and wait for next tick
-				if err == sql.ErrNoRows {
-					break
-				}
-				fmt.Println("Error selecting next feed to fetch:", err)
-				break
-			}
-
+		feeds, err := s.dbQueries.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+			LeaseSeconds: int32(lease / time.Second),
+			ClaimedBy:    claimedBy,
+			BatchSize:    10,
+		})
+		if err != nil {
+			fmt.Println("Error selecting feeds to fetch:", err)
+		}
+		for _, f := range feeds {
 			fmt.Println("Fetching feed:", f.Url)
-			feedData, err := feed.FetchFeed(ctx, f.Url)
-			if err != nil {
-				fmt.Println("Error fetching feed:", err)
+			// no validators: agg always fetches the whole feed
+			res, fetchErr := feed.FetchFeedConditional(ctx, f.Url, feed.Validators{})
+			if fetchErr != nil {
+				fmt.Println("Error fetching feed:", fetchErr)
 			} else {
-				for _, item := range feedData.Channel.Item {
+				for _, item := range res.Feed.Channel.Item {
 					fmt.Printf("- %s\n  %s\n", item.Title, item.Link)
 				}
 			}
@@ -252,9 +357,17 @@ func handlerAgg(s *state, cmd command) error {
 			if err := s.dbQueries.MarkFeedFetched(ctx, f.ID); err != nil {
 				fmt.Println("Error marking feed fetched:", err)
 			}
+			if fetchErr != nil {
+				scr.RecordFailure(ctx, f, fetchErr)
+			} else {
+				scr.RecordSuccess(ctx, f, res.StatusCode)
+			}
 			// be polite to remote servers — wait a bit between requests
 			time.Sleep(1 * time.Second)
 		}
+		if err := s.dbQueries.ReleaseFeedClaims(ctx, claimedBy); err != nil {
+			fmt.Println("Error releasing feed claims:", err)
+		}
 
 		select {
 		case <-ticker.C:
@@ -286,6 +399,16 @@ func handlerFollow(s *state, cmd command, currentUser database.User) error {
 	}
 
 	feedRecord, err := s.dbQueries.GetFeedByURL(context.Background(), feedURL)
+	if err == sql.ErrNoRows {
+		// maybe a website URL; look for the feed it announces
+		resolved, resolveErr := resolveFeedURL(s, feedURL)
+		if resolveErr != nil {
+			return resolveErr
+		}
+		if resolved != feedURL {
+			feedRecord, err = s.dbQueries.GetFeedByURL(context.Background(), resolved)
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("get feed by URL: %w", err)
 	}
@@ -371,73 +494,49 @@ func strToNullString(s string) sql.NullString {
 	return sql.NullString{String: s, Valid: true}
 }
 
-// ParseFeedDate attempts to parse a date string from RSS/Atom feeds using a comprehensive list of common formats.
-// It supports variations from RFC 822 (RSS) and RFC 3339/ISO 8601 (Atom), including:
-// - With/without weekdays
-// - Days with/without leading zeros
-// - Named timezones (e.g., MST, EST)
-// - Numeric offsets (e.g., -0700, +0200)
-// - UTC 'Z' designator
-// - Fractional seconds
-// - Rare cases with space instead of 'T' in ISO formats
-//
-// If parsing fails for all formats, it returns a zero time.Time and an error.
-func ParseFeedDate(dateStr string) (time.Time, error) {
-	formats := []string{
-		// RFC 822 / RSS variations (with weekday)
-		time.RFC1123,                   // "Mon, 02 Jan 2006 15:04:05 MST" (named TZ)
-		time.RFC1123Z,                  // "Mon, 02 Jan 2006 15:04:05 -0700" (numeric TZ)
-		"Mon, 2 Jan 2006 15:04:05 MST", // Day without leading zero, named TZ
-		"Mon, 2 Jan 2006 15:04:05 -0700",
-		"Mon, 02 Jan 2006 15:04:05 +0000", // +0000 offset
-		"Mon, 2 Jan 2006 15:04:05 +0000",
-
-		// Without weekday
-		"02 Jan 2006 15:04:05 MST",
-		"02 Jan 2006 15:04:05 -0700",
-		"2 Jan 2006 15:04:05 MST",
-		"2 Jan 2006 15:04:05 -0700",
-		"02 Jan 2006 15:04:05 +0000",
-		"2 Jan 2006 15:04:05 +0000",
-
-		// RFC 3339 / Atom variations
-		time.RFC3339,                     // "2006-01-02T15:04:05Z07:00" (wait, actually "2006-01-02T15:04:05-07:00")
-		time.RFC3339Nano,                 // With nanoseconds: "2006-01-02T15:04:05.999999999-07:00"
-		"2006-01-02T15:04:05Z",           // Z without offset
-		"2006-01-02T15:04:05.999999999Z", // Z with nano
-		"2006-01-02T15:04:05+00:00",      // +00:00
-		"2006-01-02T15:04:05-00:00",      // -00:00
-
-		// Rare: Space instead of 'T' (some non-standard feeds)
-		"2006-01-02 15:04:05Z",
-		"2006-01-02 15:04:05-07:00",
-		"2006-01-02 15:04:05+00:00",
-		"2006-01-02 15:04:05.999999999Z",
-
-		// Other observed formats from feeds
-		"Mon, 02 Jan 2006 15:04:05 GMT", // GMT specifically
-		"Mon, 2 Jan 2006 15:04:05 GMT",
-		"02 Jan 2006 15:04:05 GMT",
-		"2 Jan 2006 15:04:05 GMT",
-		"Mon, 02 Jan 2006 15:04:05 EST", // EST, etc.
-	}
-
-	var parsedTime time.Time
-	var lastErr error
-	for _, format := range formats {
-		parsedTime, lastErr = time.Parse(format, dateStr)
-		if lastErr == nil {
-			return parsedTime.UTC(), nil // Normalize to UTC for consistency
-		}
-	}
-
-	return time.Time{}, fmt.Errorf("unable to parse date '%s' with any known format: %w", dateStr, lastErr)
+// configDuration parses the Go duration string value of the config key name,
+// returning def when it is unset.
+func configDuration(name, value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s in config: %w", name, err)
+	}
+	return d, nil
+}
+
+// newScraper returns a scraper configured from the fetch scheduling, feed
+// health and retention settings in the config.
+func newScraper(s *state) (*scraper.Scraper, error) {
+	minFetch, err := configDuration("min_fetch_interval", s.config.MinFetchInterval, 0)
+	if err != nil {
+		return nil, err
+	}
+	maxFetch, err := configDuration("max_fetch_interval", s.config.MaxFetchInterval, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &scraper.Scraper{
+		DB:           s.dbQueries,
+		Schedule:     scraper.Schedule{Min: minFetch, Max: maxFetch},
+		DisableAfter: s.config.DisableAfterFailures,
+		Retention: scraper.Retention{
+			Days:     s.config.RetentionDays,
+			MaxPosts: s.config.RetentionMaxPosts,
+		},
+		Webhooks:  &webhook.Dispatcher{DB: s.dbQueries},
+		Notifiers: &notify.Dispatcher{},
+	}, nil
 }
 
 // handlerScrapeFeeds - runs in the background to scrape all feeds and store new items.
+// Usage: scrapeFeeds <interval> [workers]. The worker count defaults to the
+// scrape_workers config key, and host_delay sets the per-host politeness delay.
 func handlerScrapeFeeds(s *state, cmd command) error {
 	// takes 1 parameter: interval in seconds, minutes or hours, or days 1s etc.
-	if len(cmd.arguments) != 1 {
+	if len(cmd.arguments) < 1 || len(cmd.arguments) > 2 {
 		return fmt.Errorf("interval argument is required")
 	}
 	intervalStr := cmd.arguments[0]
@@ -446,174 +545,1924 @@ func handlerScrapeFeeds(s *state, cmd command) error {
 		return fmt.Errorf("invalid interval: %w", err)
 	}
 
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	workers := s.config.ScrapeWorkers
+	if len(cmd.arguments) == 2 {
+		workers, err = strconv.Atoi(cmd.arguments[1])
+		if err != nil || workers < 1 {
+			return fmt.Errorf("invalid workers argument: %s", cmd.arguments[1])
+		}
+	}
+	if workers < 1 {
+		workers = defaultScrapeWorkers
+	}
 
-	fmt.Printf("Starting feed scraping every %s %s\n", interval, s.config.CurrentUserName)
+	pool, err := newPool(s, workers)
+	if err != nil {
+		return err
+	}
 
-	ctx := context.Background()
+	fmt.Printf("Starting feed scraping every %s with %d workers %s\n", interval, workers, s.config.CurrentUserName)
 
-	for {
-		<-ticker.C
-		fmt.Println("Scraping feeds...")
-
-		// Fetch up to 10 feeds to process this tick using GetNextFeedToFetch
-		for i := 0; i < 10; i++ {
-			f, err := s.dbQueries.GetNextFeedToFetch(ctx)
-			if err != nil {
-				// no feed ready or other error
-				if err == sql.ErrNoRows {
-					break
-				}
-				fmt.Println("Error selecting next feed to fetch:", err)
-				break
-			}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-			fmt.Println("Fetching feed:", f.Url)
-			feedData, err := feed.FetchFeed(ctx, f.Url)
-			if err != nil {
-				fmt.Println("Error fetching feed:", err)
-			} else {
-				for _, item := range feedData.Channel.Item {
-					postDate, postErr := ParseFeedDate(item.PubDate)
-					if postErr != nil {
-						fmt.Println("Error parsing post date:", postErr, "- using current time")
-						postDate = time.Now().UTC()
-					}
+	err = pool.Run(ctx, interval)
+	stop()
+	finishDeliveries(pool.Scraper)
+	if err != nil {
+		return err
+	}
+	fmt.Println("received interrupt; exiting scrapeFeeds")
+	return nil
+}
 
-					fmt.Printf("- %s\n  %s\n", item.Title, item.Link)
-					// Insert the post into the database
-					_, err := s.dbQueries.CreatePost(ctx, database.CreatePostParams{
-						ID:          uuid.New(),
-						CreatedAt:   time.Now().UTC(),
-						UpdatedAt:   time.Now().UTC(),
-						Title:       item.Title,
-						Url:         item.Link,
-						Description: strToNullString(item.Description),
-						PublishedAt: postDate,
-						FeedID:      f.ID,
-					})
-					if err != nil {
-						fmt.Println("Error inserting post into database:", err)
-					}
-				}
-			}
+// finishDeliveries gives the webhook deliveries and notifications in flight
+// up to shutdownTimeout to finish and drops the queued ones. The caller has
+// stopped catching interrupts, so a second Ctrl-C exits at once.
+func finishDeliveries(scr *scraper.Scraper) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := scr.Shutdown(ctx); err != nil {
+		fmt.Println("Gave up waiting for webhook deliveries and notifications:", err)
+	}
+}
 
-			if err := s.dbQueries.MarkFeedFetched(ctx, f.ID); err != nil {
-				fmt.Println("Error marking feed fetched:", err)
-			}
+// newPool builds a scraper pool with the given number of workers and the
+// delays and intervals from the config.
+func newPool(s *state, workers int) (*scraper.Pool, error) {
+	hostDelay, err := configDuration("host_delay", s.config.HostDelay, defaultHostDelay)
+	if err != nil {
+		return nil, err
+	}
+	lease, err := configDuration("scrape_lease", s.config.ScrapeLease, 0)
+	if err != nil {
+		return nil, err
+	}
+	purgeEvery, err := configDuration("purge_interval", s.config.PurgeInterval, 0)
+	if err != nil {
+		return nil, err
+	}
+	scr, err := newScraper(s)
+	if err != nil {
+		return nil, err
+	}
+	return &scraper.Pool{
+		Scraper:    scr,
+		Workers:    workers,
+		HostDelay:  hostDelay,
+		Lease:      lease,
+		PurgeEvery: purgeEvery,
+	}, nil
+}
 
-			// be polite to remote servers
-			time.Sleep(1 * time.Second)
+// handlerUnhealthy lists feeds whose recent fetches failed, disabled feeds
+// first, with their failure count and last error.
+func handlerUnhealthy(s *state, cmd command) error {
+	if len(cmd.arguments) != 0 {
+		return fmt.Errorf("no arguments expected for unhealthy command")
+	}
+
+	feeds, err := s.dbQueries.GetUnhealthyFeeds(context.Background())
+	if err != nil {
+		return fmt.Errorf("error fetching unhealthy feeds: %w", err)
+	}
+	if len(feeds) == 0 {
+		fmt.Println("All feeds are healthy.")
+		return nil
+	}
+
+	for _, f := range feeds {
+		state := "failing"
+		if f.DisabledAt.Valid {
+			state = "disabled since " + f.DisabledAt.Time.Format(time.RFC3339)
+		}
+		fmt.Printf("* %s - %s (%s)\n", f.Name, f.Url, state)
+
+		status := "none"
+		if f.LastStatus.Valid {
+			status = strconv.Itoa(int(f.LastStatus.Int32))
+		}
+		lastSuccess := "never"
+		if f.LastSuccessAt.Valid {
+			lastSuccess = f.LastSuccessAt.Time.Format(time.RFC3339)
 		}
+		fmt.Printf("  %d consecutive failures, last status %s, last success %s\n", f.ConsecutiveFailures, status, lastSuccess)
+		if f.LastError.Valid {
+			fmt.Printf("  last error: %s\n", f.LastError.String)
+		}
+	}
+	return nil
+}
+
+// handlerEnableFeed re-enables the feed with the given URL, clears its
+// failure count and makes it due for fetching right away.
+func handlerEnableFeed(s *state, cmd command, currentUser database.User) error {
+	if len(cmd.arguments) != 1 {
+		return fmt.Errorf("feed URL argument is required")
+	}
+	feedURL := cmd.arguments[0]
+
+	f, err := s.dbQueries.EnableFeedByURL(context.Background(), feedURL)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("feed %s not found", feedURL)
+	}
+	if err != nil {
+		return fmt.Errorf("enable feed: %w", err)
 	}
 
+	fmt.Printf("Feed %s re-enabled by %s; it will be fetched on the next scrape.\n", f.Name, currentUser.Name)
+	return nil
 }
 
-// handlerBrowse command. It should take an optional "limit" parameter. If it's not provided, default the limit to 2. Print the posts in the terminal.
-func handlerBrowse(s *state, cmd command, currentUser database.User) error {
-	limit := 2
-	if len(cmd.arguments) > 0 {
-		var err error
-		limit, err = strconv.Atoi(cmd.arguments[0])
-		if err != nil {
-			return fmt.Errorf("invalid limit argument: %w", err)
-		}
+// handlerMigrate applies (up), rolls back (down) or lists (status) the
+// schema migrations embedded in the binary. baseline marks the migrations up
+// to a version as applied, for a database created without them.
+func handlerMigrate(s *state, cmd command) error {
+	baseline := len(cmd.arguments) == 2 && cmd.arguments[0] == "baseline"
+	if len(cmd.arguments) != 1 && !baseline {
+		return fmt.Errorf("usage: migrate up|down|status|baseline <version>")
 	}
 
-	posts, err := s.dbQueries.GetPostsForUser(context.Background(), database.GetPostsForUserParams{
-		UserID: currentUser.ID,
-		Limit:  int32(limit),
-		Offset: 0,
-	})
+	m, err := migrate.New(s.db, schema.FS)
 	if err != nil {
-		return fmt.Errorf("error fetching posts: %w", err)
+		return fmt.Errorf("load migrations: %w", err)
 	}
+	ctx := context.Background()
 
-	for _, post := range posts {
-		fmt.Printf("* %s\n  %s\n  Published at: %s\n", post.Title, post.Url, post.PublishedAt.String())
+	switch cmd.arguments[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, mig := range applied {
+			fmt.Println("Applied", mig.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database schema is up to date.")
+		}
+	case "down":
+		mig, err := m.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if mig == nil {
+			fmt.Println("No migrations to roll back.")
+			return nil
+		}
+		fmt.Println("Rolled back", mig.Name)
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			applied := "pending"
+			if st.AppliedAt.Valid {
+				applied = st.AppliedAt.Time.Format(time.RFC3339)
+			}
+			fmt.Printf("%-25s %s\n", applied, st.Name)
+		}
+	case "baseline":
+		if !baseline {
+			return fmt.Errorf("usage: migrate baseline <version>")
+		}
+		version, err := strconv.ParseInt(cmd.arguments[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", cmd.arguments[1])
+		}
+		marked, err := m.Baseline(ctx, version)
+		if err != nil {
+			return err
+		}
+		for _, mig := range marked {
+			fmt.Println("Marked", mig.Name, "as applied")
+		}
+		if len(marked) == 0 {
+			fmt.Println("Nothing to mark; those migrations are already applied.")
+		}
+	default:
+		return fmt.Errorf("unknown migrate subcommand %q; use up, down, status or baseline", cmd.arguments[0])
 	}
+	return nil
+}
 
+// checkSchema returns an error when the database is missing migrations, so
+// commands never run against a schema older than the code expects.
+func checkSchema(s *state) error {
+	m, err := migrate.New(s.db, schema.FS)
+	if err != nil {
+		return fmt.Errorf("load migrations: %w", err)
+	}
+	pending, err := m.Pending(context.Background())
+	if err != nil {
+		return fmt.Errorf("error checking database schema: %w", err)
+	}
+	if len(pending) == len(m.Migrations) {
+		return fmt.Errorf("database schema is not tracked: run `gator migrate up` on a new database, or `gator migrate baseline <version>` on one whose tables were created by hand")
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is behind: %d migration(s) pending, starting with %s; run `gator migrate up`", len(pending), pending[0].Name)
+	}
 	return nil
 }
 
-func main() {
-	conf, err := config.Read()
+// handlerImport reads an OPML file and follows every feed in it for the
+// current user, creating feeds that gator does not know yet. Outline folders
+// are kept on the follows; feeds that are already followed are moved to the
+// folder given in the file.
+func handlerImport(s *state, cmd command, currentUser database.User) error {
+	if len(cmd.arguments) != 1 {
+		return fmt.Errorf("OPML file argument is required")
+	}
+
+	file, err := os.Open(cmd.arguments[0])
 	if err != nil {
-		fmt.Println("Error reading config:", err)
-		os.Exit(1)
+		return fmt.Errorf("open OPML file: %w", err)
 	}
+	defer file.Close()
 
-	cmdState := &state{config: conf}
+	subs, err := opml.Parse(file)
+	if err != nil {
+		return fmt.Errorf("parse OPML file: %w", err)
+	}
 
-	db, err := sql.Open("postgres", conf.DbURL)
+	ctx := context.Background()
+	var created, followed, existing, failed int
+	for _, sub := range subs {
+		if _, err := url.ParseRequestURI(sub.XMLURL); err != nil {
+			fmt.Printf("Skipping %s: invalid feed URL %q\n", sub.Title, sub.XMLURL)
+			failed++
+			continue
+		}
+
+		f, err := s.dbQueries.GetFeedByURL(ctx, sub.XMLURL)
+		if err == sql.ErrNoRows {
+			f, err = s.dbQueries.CreateFeeds(ctx, database.CreateFeedsParams{
+				ID:        uuid.New(),
+				CreatedAt: time.Now().UTC(),
+				UpdatedAt: time.Now().UTC(),
+				Name:      sub.Title,
+				Url:       sub.XMLURL,
+				UserID:    currentUser.ID,
+			})
+			if err == nil {
+				created++
+			}
+		}
+		if err != nil {
+			fmt.Printf("Error importing %s: %v\n", sub.XMLURL, err)
+			failed++
+			continue
+		}
+
+		follow, err := s.dbQueries.UpsertFeedFollow(ctx, database.UpsertFeedFollowParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now().UTC(),
+			UpdatedAt: time.Now().UTC(),
+			UserID:    currentUser.ID,
+			FeedID:    f.ID,
+			Folder:    strToNullString(sub.Folder),
+		})
+		if err != nil {
+			fmt.Printf("Error following %s: %v\n", sub.XMLURL, err)
+			failed++
+			continue
+		}
+		if follow.Inserted {
+			followed++
+			fmt.Printf("+ %s - %s\n", f.Name, f.Url)
+		} else {
+			existing++
+		}
+	}
+
+	fmt.Printf("Imported %d feeds: %d new feeds, %d new follows, %d already followed, %d failed\n",
+		len(subs), created, followed, existing, failed)
+	return nil
+}
+
+// handlerExport writes the current user's followed feeds as OPML 2.0 to the
+// given file, or to stdout when no file is given.
+func handlerExport(s *state, cmd command, currentUser database.User) error {
+	if len(cmd.arguments) > 1 {
+		return fmt.Errorf("at most one file argument is expected")
+	}
+
+	feeds, err := s.dbQueries.GetFollowedFeedsForExport(context.Background(), currentUser.ID)
 	if err != nil {
-		fmt.Println("Error connecting to the database:", err)
-		os.Exit(1)
+		return fmt.Errorf("get followed feeds: %w", err)
 	}
-	defer db.Close()
-	cmdState.db = db
-	cmdState.dbQueries = database.New(db)
 
-	cmds := &commands{commandsMap: make(map[string]func(*state, command) error)}
-	if err := cmds.register("login", handlerLogin); err != nil {
-		fmt.Println("Error registering command:", err)
-		os.Exit(1)
+	subs := make([]opml.Subscription, 0, len(feeds))
+	for _, f := range feeds {
+		subs = append(subs, opml.Subscription{Title: f.Name, XMLURL: f.Url, Folder: f.Folder.String})
 	}
-	if err := cmds.register("register", handlerRegister); err != nil {
-		fmt.Println("Error registering command:", err)
-		os.Exit(1)
+
+	out := os.Stdout
+	if len(cmd.arguments) == 1 {
+		file, err := os.Create(cmd.arguments[0])
+		if err != nil {
+			return fmt.Errorf("create export file: %w", err)
+		}
+		defer file.Close()
+		out = file
 	}
-	if err := cmds.register("reset", handlerReset); err != nil {
-		fmt.Println("Error registering command:", err)
-		os.Exit(1)
+
+	title := fmt.Sprintf("gator subscriptions for %s", currentUser.Name)
+	if err := opml.Write(out, title, time.Now().UTC().Format(time.RFC1123Z), subs); err != nil {
+		return fmt.Errorf("write OPML: %w", err)
 	}
-	if err := cmds.register("users", handlerUsers); err != nil {
-		fmt.Println("Error registering command:", err)
-		os.Exit(1)
+	if out != os.Stdout {
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("close export file: %w", err)
+		}
+		fmt.Printf("Exported %d feeds to %s\n", len(subs), cmd.arguments[0])
 	}
-	if err := cmds.register("agg", handlerAgg); err != nil {
-		fmt.Println("Error registering command:", err)
-		os.Exit(1)
+	return nil
+}
+
+// handlerBrowse prints the newest unread posts from the feeds the user
+// follows. Usage: browse [--all] [--feed name|url] [--since date]
+// [--page n] [limit]. The limit defaults to 2; --all includes posts that
+// have been read or muted by a filter rule and --page steps back through
+// older posts, limit at a time.
+func handlerBrowse(s *state, cmd command, currentUser database.User) error {
+	const usage = "usage: browse [--all] [--feed name|url] [--since date] [--page n] [limit]"
+	fs := flag.NewFlagSet("browse", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	all := fs.Bool("all", false, "include read and muted posts")
+	feedRef := fs.String("feed", "", "only show posts from this feed (name or URL)")
+	since := fs.String("since", "", "only show posts published on or after this date")
+	page := fs.Int("page", 1, "page of results, 1 being the newest")
+	if err := fs.Parse(cmd.arguments); err != nil {
+		return fmt.Errorf("%s: %w", usage, err)
 	}
-	if err := cmds.register("addfeed", middlewareLoggedIn(handlerAddFeed)); err != nil {
-		fmt.Println("Error registering command:", err)
-		os.Exit(1)
+	// flag stops at the first non-flag, so flags after the limit would be
+	// ignored rather than applied
+	if fs.NArg() > 1 {
+		return fmt.Errorf("%s: flags go before the limit", usage)
 	}
-	if err := cmds.register("feeds", handlerFeeds); err != nil {
-		fmt.Println("Error registering command:", err)
-		os.Exit(1)
+	if *page < 1 {
+		return fmt.Errorf("invalid page %d: pages start at 1", *page)
 	}
-	if err := cmds.register("follow", middlewareLoggedIn(handlerFollow)); err != nil {
-		fmt.Println("Error registering command:", err)
-		os.Exit(1)
+
+	limit := 2
+	if fs.NArg() > 0 {
+		var err error
+		limit, err = strconv.Atoi(fs.Arg(0))
+		if err != nil || limit < 1 {
+			return fmt.Errorf("%s: limit must be a positive number", usage)
+		}
 	}
-	if err := cmds.register("following", middlewareLoggedIn(handlerFollowing)); err != nil {
-		fmt.Println("Error registering command:", err)
-		os.Exit(1)
+
+	params := database.GetPostsForUserParams{
+		UserID:     currentUser.ID,
+		IncludeAll: *all,
+		Feed:       strToNullString(*feedRef),
+		Limit:      int32(limit),
+		Offset:     int32((*page - 1) * limit),
 	}
-	if err := cmds.register("unfollow", middlewareLoggedIn(handlerUnfollow)); err != nil {
-		fmt.Println("Error registering command:", err)
-		os.Exit(1)
+	if *since != "" {
+		date, err := feed.ParseFeedDate(*since)
+		if err != nil {
+			return fmt.Errorf("invalid date %q: %w", *since, err)
+		}
+		params.Since = sql.NullTime{Time: date.UTC(), Valid: true}
 	}
-	if err := cmds.register("scrapeFeeds", handlerScrapeFeeds); err != nil {
-		fmt.Println("Error registering command:", err)
-		os.Exit(1)
+
+	posts, err := s.dbQueries.GetPostsForUser(context.Background(), params)
+	if err != nil {
+		return fmt.Errorf("error fetching posts: %w", err)
 	}
-	if err := cmds.register("browse", middlewareLoggedIn(handlerBrowse)); err != nil {
-		fmt.Println("Error registering command:", err)
-		os.Exit(1)
+	if len(posts) == 0 {
+		switch {
+		case *page > 1:
+			fmt.Println("No more posts.")
+		case !*all:
+			fmt.Println("No unread posts.")
+		}
+		return nil
 	}
 
-	args := os.Args
-	if len(args) < 2 {
-		fmt.Println("Usage: gator <command> [arguments]")
-		os.Exit(1)
+	listings := make([]postListing, 0, len(posts))
+	for _, post := range posts {
+		listings = append(listings, postListing{
+			ID:          post.ID,
+			Title:       post.Title,
+			Url:         post.Url,
+			PublishedAt: post.PublishedAt,
+			Read:        post.Read,
+			Highlighted: post.Highlighted,
+			Feed:        post.FeedName,
+		})
+	}
+	printPosts(listings)
+	return nil
+}
+
+// postListing is a post as shown by browse, starred and search.
+type postListing struct {
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	PublishedAt time.Time
+	Read        bool
+	Highlighted bool
+	Note        string
+	// Feed is the name of the post's feed, when it is worth showing.
+	Feed string
+}
+
+// printPosts prints posts one block each; unread posts are marked with "*"
+// and posts highlighted by a filter rule with "!".
+func printPosts(posts []postListing) {
+	for _, post := range posts {
+		marker := "*"
+		switch {
+		case post.Highlighted:
+			marker = "!"
+		case post.Read:
+			marker = " "
+		}
+		fmt.Printf("%s %s\n  %s\n", marker, post.Title, post.Url)
+		if post.Feed != "" {
+			fmt.Printf("  Feed: %s\n", post.Feed)
+		}
+		fmt.Printf("  Published at: %s\n  Post ID: %s\n", post.PublishedAt.String(), post.ID)
+		if post.Note != "" {
+			fmt.Printf("  Note: %s\n", post.Note)
+		}
+	}
+}
+
+// handlerMarkRead marks posts read for the current user.
+// Usage: markread <post-id|post-url> | markread --feed <feed-url> |
+// markread --before <date>.
+func handlerMarkRead(s *state, cmd command, currentUser database.User) error {
+	fs := flag.NewFlagSet("markread", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	feedURL := fs.String("feed", "", "mark every post of this feed read")
+	before := fs.String("before", "", "mark posts published before this date read")
+	if err := fs.Parse(cmd.arguments); err != nil {
+		return fmt.Errorf("usage: markread <post> | --feed <url> | --before <date>: %w", err)
+	}
+	ctx := context.Background()
+
+	switch {
+	case *feedURL != "" && *before == "" && fs.NArg() == 0:
+		f, err := s.dbQueries.GetFollowedFeedByURL(ctx, database.GetFollowedFeedByURLParams{UserID: currentUser.ID, Url: *feedURL})
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("you do not follow %s", *feedURL)
+		}
+		if err != nil {
+			return fmt.Errorf("get feed by URL: %w", err)
+		}
+		n, err := s.dbQueries.MarkFeedRead(ctx, database.MarkFeedReadParams{UserID: currentUser.ID, FeedID: f.ID})
+		if err != nil {
+			return fmt.Errorf("mark feed read: %w", err)
+		}
+		fmt.Printf("Marked %d posts from %s read.\n", n, f.Name)
+	case *before != "" && *feedURL == "" && fs.NArg() == 0:
+		date, err := feed.ParseFeedDate(*before)
+		if err != nil {
+			return fmt.Errorf("invalid date %q: %w", *before, err)
+		}
+		n, err := s.dbQueries.MarkPostsReadBefore(ctx, database.MarkPostsReadBeforeParams{UserID: currentUser.ID, Before: date.UTC()})
+		if err != nil {
+			return fmt.Errorf("mark posts read: %w", err)
+		}
+		fmt.Printf("Marked %d posts published before %s read.\n", n, date.Format(time.DateOnly))
+	case *feedURL == "" && *before == "" && fs.NArg() == 1:
+		return setPostRead(s, currentUser, fs.Arg(0), true)
+	default:
+		return fmt.Errorf("usage: markread <post> | --feed <url> | --before <date>")
+	}
+	return nil
+}
+
+// handlerMarkUnread marks a single post unread again.
+func handlerMarkUnread(s *state, cmd command, currentUser database.User) error {
+	if len(cmd.arguments) != 1 {
+		return fmt.Errorf("post ID or URL argument is required")
+	}
+	return setPostRead(s, currentUser, cmd.arguments[0], false)
+}
+
+// resolvePostID returns the ID of the post identified by ref, a post ID or
+// the post's link in one of the user's feeds.
+func resolvePostID(s *state, currentUser database.User, ref string) (uuid.UUID, error) {
+	ctx := context.Background()
+	if postID, err := uuid.Parse(ref); err == nil {
+		postID, err = s.dbQueries.GetPostIDForUser(ctx, database.GetPostIDForUserParams{UserID: currentUser.ID, ID: postID})
+		if err == sql.ErrNoRows {
+			return uuid.Nil, fmt.Errorf("no post %s in your feeds", ref)
+		}
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("get post: %w", err)
+		}
+		return postID, nil
+	}
+	post, err := s.dbQueries.GetPostByURLForUser(ctx, database.GetPostByURLForUserParams{UserID: currentUser.ID, Url: ref})
+	if err == sql.ErrNoRows {
+		return uuid.Nil, fmt.Errorf("no post %s in your feeds", ref)
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("get post by URL: %w", err)
+	}
+	return post.ID, nil
+}
+
+// setPostRead sets the read flag of the post identified by ref.
+func setPostRead(s *state, currentUser database.User, ref string, read bool) error {
+	ctx := context.Background()
+	postID, err := resolvePostID(s, currentUser, ref)
+	if err != nil {
+		return err
+	}
+
+	if err := s.dbQueries.SetPostRead(ctx, database.SetPostReadParams{UserID: currentUser.ID, PostID: postID, Read: read}); err != nil {
+		return fmt.Errorf("update post state: %w", err)
+	}
+	if read {
+		fmt.Println("Post marked read.")
+	} else {
+		fmt.Println("Post marked unread.")
+	}
+	return nil
+}
+
+// handlerStar stars a post for the current user. Usage: star <post>.
+func handlerStar(s *state, cmd command, currentUser database.User) error {
+	return setPostStarred(s, cmd, currentUser, true)
+}
+
+// handlerUnstar removes the star from a post. Usage: unstar <post>.
+func handlerUnstar(s *state, cmd command, currentUser database.User) error {
+	return setPostStarred(s, cmd, currentUser, false)
+}
+
+func setPostStarred(s *state, cmd command, currentUser database.User, starred bool) error {
+	if len(cmd.arguments) != 1 {
+		return fmt.Errorf("post ID or URL argument is required")
+	}
+	postID, err := resolvePostID(s, currentUser, cmd.arguments[0])
+	if err != nil {
+		return err
+	}
+
+	if err := s.dbQueries.SetPostStarred(context.Background(), database.SetPostStarredParams{
+		UserID:  currentUser.ID,
+		PostID:  postID,
+		Starred: starred,
+	}); err != nil {
+		return fmt.Errorf("update post state: %w", err)
+	}
+	if starred {
+		fmt.Println("Post starred.")
+	} else {
+		fmt.Println("Post unstarred.")
+	}
+	return nil
+}
+
+// handlerNote attaches a free-text note to a post, replacing any earlier
+// one. Usage: note <post> [text...]; without text the note is removed.
+func handlerNote(s *state, cmd command, currentUser database.User) error {
+	if len(cmd.arguments) < 1 {
+		return fmt.Errorf("post ID or URL argument is required")
+	}
+	postID, err := resolvePostID(s, currentUser, cmd.arguments[0])
+	if err != nil {
+		return err
+	}
+
+	note := strings.TrimSpace(strings.Join(cmd.arguments[1:], " "))
+	if err := s.dbQueries.SetPostNote(context.Background(), database.SetPostNoteParams{
+		UserID: currentUser.ID,
+		PostID: postID,
+		Note:   strToNullString(note),
+	}); err != nil {
+		return fmt.Errorf("update post note: %w", err)
+	}
+	if note == "" {
+		fmt.Println("Note removed.")
+	} else {
+		fmt.Println("Note saved.")
+	}
+	return nil
+}
+
+// handlerStarred lists the current user's starred posts, most recently
+// starred first. Usage: starred [limit]; the limit defaults to 20.
+func handlerStarred(s *state, cmd command, currentUser database.User) error {
+	limit := 20
+	if len(cmd.arguments) > 0 {
+		var err error
+		limit, err = strconv.Atoi(cmd.arguments[0])
+		if err != nil {
+			return fmt.Errorf("invalid limit argument: %w", err)
+		}
+	}
+
+	posts, err := s.dbQueries.GetStarredPostsForUser(context.Background(), database.GetStarredPostsForUserParams{
+		UserID: currentUser.ID,
+		Limit:  int32(limit),
+		Offset: 0,
+	})
+	if err != nil {
+		return fmt.Errorf("error fetching starred posts: %w", err)
+	}
+	if len(posts) == 0 {
+		fmt.Println("No starred posts.")
+		return nil
+	}
+
+	listings := make([]postListing, 0, len(posts))
+	for _, post := range posts {
+		listings = append(listings, postListing{
+			ID:          post.ID,
+			Title:       post.Title,
+			Url:         post.Url,
+			PublishedAt: post.PublishedAt,
+			Read:        post.Read,
+			Note:        post.Note.String,
+		})
+	}
+	printPosts(listings)
+	return nil
+}
+
+// handlerSearch ranks posts in the user's followed feeds against a query.
+// Usage: search [--feed name|url] [--since date] [--until date] [--limit n]
+// <query>. The query uses web search syntax: "quoted phrases", -excluded
+// words and OR.
+func handlerSearch(s *state, cmd command, currentUser database.User) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	feedRef := fs.String("feed", "", "only search this feed (name or URL)")
+	since := fs.String("since", "", "only posts published on or after this date")
+	until := fs.String("until", "", "only posts published before this date")
+	limit := fs.Int("limit", 20, "maximum number of results")
+	if err := fs.Parse(cmd.arguments); err != nil {
+		return fmt.Errorf("usage: search [--feed name|url] [--since date] [--until date] [--limit n] <query>: %w", err)
+	}
+	query := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if query == "" {
+		return fmt.Errorf("usage: search [--feed name|url] [--since date] [--until date] [--limit n] <query>")
+	}
+
+	params := database.SearchPostsForUserParams{
+		UserID: currentUser.ID,
+		Query:  query,
+		Feed:   strToNullString(*feedRef),
+		Limit:  int32(*limit),
+	}
+	if *since != "" {
+		date, err := feed.ParseFeedDate(*since)
+		if err != nil {
+			return fmt.Errorf("invalid date %q: %w", *since, err)
+		}
+		params.Since = sql.NullTime{Time: date.UTC(), Valid: true}
+	}
+	if *until != "" {
+		date, err := feed.ParseFeedDate(*until)
+		if err != nil {
+			return fmt.Errorf("invalid date %q: %w", *until, err)
+		}
+		params.Until = sql.NullTime{Time: date.UTC(), Valid: true}
+	}
+
+	posts, err := s.dbQueries.SearchPostsForUser(context.Background(), params)
+	if err != nil {
+		return fmt.Errorf("error searching posts: %w", err)
+	}
+	if len(posts) == 0 {
+		fmt.Println("No matching posts.")
+		return nil
+	}
+
+	listings := make([]postListing, 0, len(posts))
+	for _, post := range posts {
+		listings = append(listings, postListing{
+			ID:          post.ID,
+			Title:       post.Title,
+			Url:         post.Url,
+			PublishedAt: post.PublishedAt,
+			Read:        post.Read,
+			Feed:        post.FeedName,
+		})
+	}
+	printPosts(listings)
+	return nil
+}
+
+// handlerFilter manages the user's filter rules.
+// Usage: filter add [--feed url] [--field f] [--regex] <action> <pattern> |
+// filter list | filter delete <rule-id> | filter apply.
+func handlerFilter(s *state, cmd command, currentUser database.User) error {
+	if len(cmd.arguments) == 0 {
+		return fmt.Errorf("usage: filter add|list|delete|apply")
+	}
+	args := cmd.arguments[1:]
+	switch cmd.arguments[0] {
+	case "add":
+		return filterAdd(s, args, currentUser)
+	case "list":
+		return filterList(s, currentUser)
+	case "delete":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: filter delete <rule-id>")
+		}
+		return filterDelete(s, args[0], currentUser)
+	case "apply":
+		return filterApply(s, currentUser)
+	default:
+		return fmt.Errorf("unknown filter subcommand %q; use add, list, delete or apply", cmd.arguments[0])
+	}
+}
+
+// filterAdd stores a new rule after checking it compiles.
+func filterAdd(s *state, args []string, currentUser database.User) error {
+	const usage = "usage: filter add [--feed url] [--field any|title|description|author|category] [--regex] <mute|highlight|read|star> <pattern>"
+	fs := flag.NewFlagSet("filter add", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	feedURL := fs.String("feed", "", "only apply the rule to this feed")
+	field := fs.String("field", string(filter.FieldAny), "the part of the post to match")
+	regex := fs.Bool("regex", false, "treat the pattern as a regular expression")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", usage, err)
+	}
+	if fs.NArg() < 2 {
+		return fmt.Errorf(usage)
+	}
+	action, pattern := fs.Arg(0), strings.Join(fs.Args()[1:], " ")
+
+	if _, err := filter.NewRule(*field, pattern, *regex, action); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var feedID uuid.NullUUID
+	if *feedURL != "" {
+		f, err := s.dbQueries.GetFeedByURL(ctx, *feedURL)
+		if err != nil {
+			return fmt.Errorf("get feed by URL: %w", err)
+		}
+		feedID = uuid.NullUUID{UUID: f.ID, Valid: true}
+	}
+
+	rule, err := s.dbQueries.CreateFilterRule(ctx, database.CreateFilterRuleParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UserID:    currentUser.ID,
+		FeedID:    feedID,
+		Field:     *field,
+		Pattern:   pattern,
+		IsRegex:   *regex,
+		Action:    action,
+	})
+	if err != nil {
+		return fmt.Errorf("create filter rule: %w", err)
+	}
+	fmt.Println("Added filter rule", rule.ID)
+	fmt.Println("Run 'filter apply' to apply it to posts already stored.")
+	return nil
+}
+
+// filterList prints the user's rules.
+func filterList(s *state, currentUser database.User) error {
+	rules, err := s.dbQueries.GetFilterRulesForUser(context.Background(), currentUser.ID)
+	if err != nil {
+		return fmt.Errorf("get filter rules: %w", err)
+	}
+	if len(rules) == 0 {
+		fmt.Println("No filter rules.")
+		return nil
+	}
+	for _, r := range rules {
+		kind := "keyword"
+		if r.IsRegex {
+			kind = "regex"
+		}
+		scope := "all feeds"
+		if r.FeedName.Valid {
+			scope = r.FeedName.String
+		}
+		fmt.Printf("%s  %-9s %s %s %q (%s)\n", r.ID, r.Action, r.Field, kind, r.Pattern, scope)
+	}
+	return nil
+}
+
+// filterDelete removes one of the user's rules.
+func filterDelete(s *state, ref string, currentUser database.User) error {
+	ruleID, err := uuid.Parse(ref)
+	if err != nil {
+		return fmt.Errorf("invalid rule ID %q: %w", ref, err)
+	}
+	n, err := s.dbQueries.DeleteFilterRule(context.Background(), database.DeleteFilterRuleParams{ID: ruleID, UserID: currentUser.ID})
+	if err != nil {
+		return fmt.Errorf("delete filter rule: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("no filter rule %s", ruleID)
+	}
+	fmt.Println("Deleted filter rule", ruleID)
+	return nil
+}
+
+// filterApply runs the user's rules over every post already stored in the
+// feeds they follow. Mutes and highlights are recomputed from scratch; posts
+// are only ever marked read or starred, never the reverse.
+func filterApply(s *state, currentUser database.User) error {
+	ctx := context.Background()
+	rows, err := s.dbQueries.GetFilterRulesForUser(ctx, currentUser.ID)
+	if err != nil {
+		return fmt.Errorf("get filter rules: %w", err)
+	}
+	rules := make([]filter.Rule, 0, len(rows))
+	for _, row := range rows {
+		r, err := filter.FromDB(database.FilterRule{
+			ID:      row.ID,
+			FeedID:  row.FeedID,
+			Field:   row.Field,
+			Pattern: row.Pattern,
+			IsRegex: row.IsRegex,
+			Action:  row.Action,
+		})
+		if err != nil {
+			return err
+		}
+		rules = append(rules, r)
+	}
+
+	// Clearing and re-applying happen in one transaction, so a failure part
+	// way leaves the previous mutes and highlights in place.
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.dbQueries.WithTx(tx)
+
+	if err := qtx.ClearPostFilterFlags(ctx, currentUser.ID); err != nil {
+		return fmt.Errorf("clear filter flags: %w", err)
+	}
+	posts, err := qtx.GetFollowedPostsForFilter(ctx, currentUser.ID)
+	if err != nil {
+		return fmt.Errorf("get posts: %w", err)
+	}
+
+	var muted, highlighted, read, starred int
+	for _, p := range posts {
+		res := filter.Evaluate(rules, filter.Post{
+			FeedID:      p.FeedID,
+			Title:       p.Title,
+			Description: p.Description.String,
+			Author:      p.Author.String,
+			Categories:  p.Categories,
+		})
+		if !res.Any() {
+			continue
+		}
+		if err := qtx.ApplyPostFilter(ctx, database.ApplyPostFilterParams{
+			UserID:      currentUser.ID,
+			PostID:      p.ID,
+			Muted:       res.Mute,
+			Highlighted: res.Highlight,
+			Read:        res.Read,
+			Starred:     res.Star,
+		}); err != nil {
+			return fmt.Errorf("apply filter rules: %w", err)
+		}
+		if res.Mute {
+			muted++
+		}
+		if res.Highlight {
+			highlighted++
+		}
+		if res.Read {
+			read++
+		}
+		if res.Star {
+			starred++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit filter flags: %w", err)
+	}
+
+	fmt.Printf("Applied %d rules to %d posts: %d muted, %d highlighted, %d marked read, %d starred\n",
+		len(rules), len(posts), muted, highlighted, read, starred)
+	return nil
+}
+
+// handlerPurge deletes posts past their feed's retention policy. Starred
+// posts are kept.
+func handlerPurge(s *state, cmd command) error {
+	if len(cmd.arguments) != 0 {
+		return fmt.Errorf("usage: purge")
+	}
+	scr, err := newScraper(s)
+	if err != nil {
+		return err
+	}
+	n, err := scr.Purge(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Purged %d posts.\n", n)
+	return nil
+}
+
+// handlerRetention shows or overrides the retention policy of one feed.
+// Usage: retention [--days n] [--max-posts n] [--default] <feed-url>.
+// 0 keeps posts without limit; --default reverts to the config settings.
+// The policy deletes posts for every follower, so only the user who added
+// the feed may change it.
+func handlerRetention(s *state, cmd command, currentUser database.User) error {
+	const usage = "usage: retention [--days n] [--max-posts n] [--default] <feed-url>"
+	fs := flag.NewFlagSet("retention", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	days := fs.Int("days", 0, "delete posts older than this many days")
+	maxPosts := fs.Int("max-posts", 0, "keep only this many of the newest posts")
+	reset := fs.Bool("default", false, "use the retention settings from the config")
+	if err := fs.Parse(cmd.arguments); err != nil {
+		return fmt.Errorf("%s: %w", usage, err)
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf(usage)
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if *days < 0 || *maxPosts < 0 {
+		return fmt.Errorf("retention limits cannot be negative")
+	}
+	if *reset && (set["days"] || set["max-posts"]) {
+		return fmt.Errorf("--default cannot be combined with --days or --max-posts")
+	}
+
+	ctx := context.Background()
+	f, err := s.dbQueries.GetFeedByURL(ctx, fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("get feed by URL: %w", err)
+	}
+
+	if *reset || len(set) > 0 {
+		if f.UserID != currentUser.ID {
+			return fmt.Errorf("only the user who added %s can change its retention", f.Name)
+		}
+		params := database.SetFeedRetentionParams{
+			ID:                f.ID,
+			RetentionDays:     f.RetentionDays,
+			RetentionMaxPosts: f.RetentionMaxPosts,
+		}
+		if *reset {
+			params.RetentionDays = sql.NullInt32{}
+			params.RetentionMaxPosts = sql.NullInt32{}
+		}
+		if set["days"] {
+			params.RetentionDays = sql.NullInt32{Int32: int32(*days), Valid: true}
+		}
+		if set["max-posts"] {
+			params.RetentionMaxPosts = sql.NullInt32{Int32: int32(*maxPosts), Valid: true}
+		}
+		f, err = s.dbQueries.SetFeedRetention(ctx, params)
+		if err != nil {
+			return fmt.Errorf("set feed retention: %w", err)
+		}
+	}
+
+	fmt.Printf("Retention for %s:\n", f.Name)
+	fmt.Printf("  Max age:   %s\n", retentionLimit(f.RetentionDays, s.config.RetentionDays, "days"))
+	fmt.Printf("  Max posts: %s\n", retentionLimit(f.RetentionMaxPosts, s.config.RetentionMaxPosts, "posts"))
+	return nil
+}
+
+// retentionLimit describes a feed's retention limit, or the config default
+// it falls back to.
+func retentionLimit(feedLimit sql.NullInt32, def int, unit string) string {
+	limit, source := def, "default"
+	if feedLimit.Valid {
+		limit, source = int(feedLimit.Int32), "feed"
+	}
+	if limit == 0 {
+		return fmt.Sprintf("unlimited (%s)", source)
+	}
+	return fmt.Sprintf("%d %s (%s)", limit, unit, source)
+}
+
+// handlerServe serves the JSON API until interrupted. Usage: serve [addr].
+// Requests authenticate with tokens from the token command.
+func handlerServe(s *state, cmd command) error {
+	if len(cmd.arguments) > 1 {
+		return fmt.Errorf("usage: serve [addr]")
+	}
+	addr := defaultServeAddr
+	if len(cmd.arguments) == 1 {
+		addr = cmd.arguments[0]
+	}
+	workers := s.config.ScrapeWorkers
+	if workers < 1 {
+		workers = defaultScrapeWorkers
+	}
+	pool, err := newPool(s, workers)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Serving API on %s\n", addr)
+	srv := &api.Server{DB: s.dbQueries, Pool: pool}
+	err = srv.Run(ctx, addr)
+	stop()
+	finishDeliveries(pool.Scraper)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serve: %w", err)
+	}
+	fmt.Println("received interrupt; exiting serve")
+	return nil
+}
+
+// handlerToken manages the current user's API tokens.
+// Usage: token create [name] | token list | token revoke <id>.
+func handlerToken(s *state, cmd command, currentUser database.User) error {
+	const usage = "usage: token create [name] | token list | token revoke <id>"
+	if len(cmd.arguments) < 1 {
+		return fmt.Errorf(usage)
+	}
+	args := cmd.arguments[1:]
+	switch cmd.arguments[0] {
+	case "create":
+		if len(args) > 1 {
+			return fmt.Errorf("usage: token create [name]")
+		}
+		return tokenCreate(s, args, currentUser)
+	case "list":
+		if len(args) != 0 {
+			return fmt.Errorf("usage: token list")
+		}
+		return tokenList(s, currentUser)
+	case "revoke":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: token revoke <id>")
+		}
+		return tokenRevoke(s, args[0], currentUser)
+	default:
+		return fmt.Errorf(usage)
+	}
+}
+
+func tokenCreate(s *state, args []string, currentUser database.User) error {
+	name := "default"
+	if len(args) == 1 {
+		name = args[0]
+	}
+	token, hash, err := api.NewToken()
+	if err != nil {
+		return err
+	}
+	t, err := s.dbQueries.CreateAPIToken(context.Background(), database.CreateAPITokenParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UserID:    currentUser.ID,
+		Name:      name,
+		TokenHash: hash,
+	})
+	if err != nil {
+		return fmt.Errorf("create API token: %w", err)
+	}
+	fmt.Printf("Created token %s (%s) for %s:\n", t.ID, t.Name, currentUser.Name)
+	fmt.Println(token)
+	fmt.Println("Store it now; it will not be shown again.")
+	return nil
+}
+
+func tokenList(s *state, currentUser database.User) error {
+	tokens, err := s.dbQueries.GetAPITokensForUser(context.Background(), currentUser.ID)
+	if err != nil {
+		return fmt.Errorf("get API tokens: %w", err)
+	}
+	if len(tokens) == 0 {
+		fmt.Println("No API tokens.")
+		return nil
+	}
+	for _, t := range tokens {
+		lastUsed := "never used"
+		if t.LastUsedAt.Valid {
+			lastUsed = "last used " + t.LastUsedAt.Time.Format(time.RFC3339)
+		}
+		fmt.Printf("%s  %s  created %s, %s\n", t.ID, t.Name, t.CreatedAt.Format("2006-01-02"), lastUsed)
+	}
+	return nil
+}
+
+func tokenRevoke(s *state, idArg string, currentUser database.User) error {
+	id, err := uuid.Parse(idArg)
+	if err != nil {
+		return fmt.Errorf("invalid token id %q", idArg)
+	}
+	n, err := s.dbQueries.DeleteAPIToken(context.Background(), database.DeleteAPITokenParams{ID: id, UserID: currentUser.ID})
+	if err != nil {
+		return fmt.Errorf("revoke API token: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("no token %s for %s", id, currentUser.Name)
+	}
+	fmt.Printf("Revoked token %s\n", id)
+	return nil
+}
+
+// handlerFever sets or clears the password Fever API clients use to log in
+// as the current user. Usage: fever set <password> | fever clear.
+func handlerFever(s *state, cmd command, currentUser database.User) error {
+	const usage = "usage: fever set <password> | fever clear"
+	if len(cmd.arguments) < 1 {
+		return fmt.Errorf(usage)
+	}
+	ctx := context.Background()
+	switch cmd.arguments[0] {
+	case "set":
+		if len(cmd.arguments) != 2 || cmd.arguments[1] == "" {
+			return fmt.Errorf("usage: fever set <password>")
+		}
+		if err := s.dbQueries.SetFeverAPIKey(ctx, database.SetFeverAPIKeyParams{
+			UserID:    currentUser.ID,
+			CreatedAt: time.Now().UTC(),
+			ApiKey:    fever.APIKey(currentUser.Name, cmd.arguments[1]),
+		}); err != nil {
+			return fmt.Errorf("set Fever API key: %w", err)
+		}
+		fmt.Printf("Fever login set for %s. Point your reader at http://<host>/fever/ with username %q.\n", currentUser.Name, currentUser.Name)
+		return nil
+	case "clear":
+		if len(cmd.arguments) != 1 {
+			return fmt.Errorf("usage: fever clear")
+		}
+		n, err := s.dbQueries.DeleteFeverAPIKey(ctx, currentUser.ID)
+		if err != nil {
+			return fmt.Errorf("clear Fever API key: %w", err)
+		}
+		if n == 0 {
+			fmt.Printf("No Fever login set for %s.\n", currentUser.Name)
+			return nil
+		}
+		fmt.Printf("Fever login cleared for %s.\n", currentUser.Name)
+		return nil
+	default:
+		return fmt.Errorf(usage)
+	}
+}
+
+// handlerPublish writes the current user's timeline as an Atom or RSS feed.
+// Usage: publish [--format atom|rss] [--folder f] [--feed f]
+// [--only highlighted|starred|unread] [--limit n] [--self url] [--output file].
+func handlerPublish(s *state, cmd command, currentUser database.User) error {
+	const usage = "usage: publish [--format atom|rss] [--folder f] [--feed f] [--only highlighted|starred|unread] [--limit n] [--self url] [--output file]"
+	fs := flag.NewFlagSet("publish", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	format := fs.String("format", publish.Atom, "atom or rss")
+	folder := fs.String("folder", "", "only feeds followed in this folder or its subfolders")
+	feedFilter := fs.String("feed", "", "only this feed (name or URL)")
+	only := fs.String("only", "", "only highlighted, starred or unread posts")
+	limit := fs.Int("limit", publish.DefaultLimit, "number of posts")
+	self := fs.String("self", "", "URL the feed will be published at")
+	output := fs.String("output", "", "write to this file instead of stdout")
+	if err := fs.Parse(cmd.arguments); err != nil {
+		return fmt.Errorf("%s: %w", usage, err)
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf(usage)
+	}
+	if *format != publish.Atom && *format != publish.RSS {
+		return fmt.Errorf("unknown format %q (want atom or rss)", *format)
+	}
+	if *format == publish.RSS && *self == "" {
+		return fmt.Errorf("--format rss needs --self: RSS requires the URL the feed is published at")
+	}
+	if *limit < 1 {
+		return fmt.Errorf("limit must be at least 1")
+	}
+
+	t, err := publish.Build(context.Background(), s.dbQueries, currentUser, publish.Options{
+		Folder:  *folder,
+		Feed:    *feedFilter,
+		Only:    *only,
+		Limit:   *limit,
+		SelfURL: *self,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return publish.Write(os.Stdout, *format, t)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("create output: %w", err)
+	}
+	if err := publish.Write(file, *format, t); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close output: %w", err)
+	}
+	fmt.Printf("Published %d posts to %s\n", len(t.Entries), *output)
+	return nil
+}
+
+// handlerPlanet generates a static planet site of the newest posts in
+// outdir. Usage: planet [--all] [--title t] [--url base] [--per-page n]
+// [--pages n] [--templates dir] <outdir>. Without --all it shows the feeds
+// the current user follows; with it, every feed.
+func handlerPlanet(s *state, cmd command, currentUser database.User) error {
+	const usage = "usage: planet [--all] [--title t] [--url base] [--per-page n] [--pages n] [--templates dir] <outdir>"
+	fs := flag.NewFlagSet("planet", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	all := fs.Bool("all", false, "include every feed, not just the ones you follow")
+	title := fs.String("title", "", "site title")
+	baseURL := fs.String("url", "", "URL the site will be published at")
+	perPage := fs.Int("per-page", planet.DefaultPerPage, "posts per page")
+	pages := fs.Int("pages", 10, "number of pages")
+	templates := fs.String("templates", "", "directory with page.html and style.css overrides")
+	if err := fs.Parse(cmd.arguments); err != nil {
+		return fmt.Errorf("%s: %w", usage, err)
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf(usage)
+	}
+	if *perPage < 1 || *pages < 1 {
+		return fmt.Errorf("--per-page and --pages must be at least 1")
+	}
+
+	ctx := context.Background()
+	opts := publish.Options{Limit: *perPage * *pages}
+	if *baseURL != "" {
+		opts.SelfURL = strings.TrimSuffix(*baseURL, "/") + "/" + planet.AtomFile
+	}
+
+	var t publish.Timeline
+	var subs []opml.Subscription
+	if *all {
+		if *title == "" {
+			*title = "Planet gator"
+		}
+		var err error
+		t, err = publish.BuildAll(ctx, s.dbQueries, *title, opts)
+		if err != nil {
+			return err
+		}
+		feeds, err := s.dbQueries.GetActiveFeeds(ctx)
+		if err != nil {
+			return fmt.Errorf("get feeds: %w", err)
+		}
+		for _, f := range feeds {
+			subs = append(subs, opml.Subscription{Title: f.Name, XMLURL: f.Url})
+		}
+	} else {
+		if *title == "" {
+			*title = "Planet " + currentUser.Name
+		}
+		var err error
+		t, err = publish.Build(ctx, s.dbQueries, currentUser, opts)
+		if err != nil {
+			return err
+		}
+		t.Title = *title
+		feeds, err := s.dbQueries.GetFollowedFeedsForExport(ctx, currentUser.ID)
+		if err != nil {
+			return fmt.Errorf("get followed feeds: %w", err)
+		}
+		for _, f := range feeds {
+			subs = append(subs, opml.Subscription{Title: f.Name, XMLURL: f.Url, Folder: f.Folder.String})
+		}
+	}
+
+	n, err := planet.Generate(fs.Arg(0), t, subs, planet.Options{PerPage: *perPage, Templates: *templates})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d posts on %d pages, %s and %s to %s\n", len(t.Entries), n, planet.AtomFile, planet.OPMLFile, fs.Arg(0))
+	return nil
+}
+
+// handlerDigest manages email digests. Usage: digest subscribe <email> |
+// digest unsubscribe | digest send [--every interval] [--limit n] [--dry-run].
+// send mails every subscribed user, not just the current one.
+func handlerDigest(s *state, cmd command, currentUser database.User) error {
+	const usage = "usage: digest subscribe <email> | digest unsubscribe | digest send [--every interval] [--limit n] [--dry-run]"
+	if len(cmd.arguments) < 1 {
+		return fmt.Errorf(usage)
+	}
+	args := cmd.arguments[1:]
+	switch cmd.arguments[0] {
+	case "subscribe":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: digest subscribe <email>")
+		}
+		return digestSubscribe(s, args[0], currentUser)
+	case "unsubscribe":
+		if len(args) != 0 {
+			return fmt.Errorf("usage: digest unsubscribe")
+		}
+		n, err := s.dbQueries.DeleteDigestSubscription(context.Background(), currentUser.ID)
+		if err != nil {
+			return fmt.Errorf("unsubscribe: %w", err)
+		}
+		if n == 0 {
+			fmt.Printf("%s is not subscribed to digests.\n", currentUser.Name)
+			return nil
+		}
+		fmt.Printf("Unsubscribed %s from digests.\n", currentUser.Name)
+		return nil
+	case "send":
+		return digestSend(s, args)
+	default:
+		return fmt.Errorf(usage)
+	}
+}
+
+func digestSubscribe(s *state, email string, currentUser database.User) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return fmt.Errorf("invalid email address %q: %w", email, err)
+	}
+	if err := s.dbQueries.SetDigestSubscription(context.Background(), database.SetDigestSubscriptionParams{
+		UserID:    currentUser.ID,
+		CreatedAt: time.Now().UTC(),
+		Email:     addr.Address,
+	}); err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+	fmt.Printf("Digests for %s will be sent to %s.\n", currentUser.Name, addr.Address)
+	return nil
+}
+
+func digestSend(s *state, args []string) error {
+	const usage = "usage: digest send [--every interval] [--limit n] [--dry-run]"
+	fs := flag.NewFlagSet("digest send", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	every := fs.Duration("every", 0, "keep running and send digests this often")
+	limit := fs.Int("limit", digest.DefaultLimit, "most posts in one digest")
+	dryRun := fs.Bool("dry-run", false, "print the messages instead of sending them")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", usage, err)
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf(usage)
+	}
+	if *limit < 1 || *every < 0 {
+		return fmt.Errorf("--limit must be at least 1 and --every cannot be negative")
+	}
+
+	mailer := digest.Mailer{
+		Addr:     s.config.SMTPAddr,
+		Username: s.config.SMTPUsername,
+		Password: s.config.SMTPPassword,
+		From:     s.config.SMTPFrom,
+	}
+	if mailer.From == "" {
+		mailer.From = "gator@localhost"
+	}
+	var sender digest.Sender = mailer
+	if *dryRun {
+		sender = printSender{}
+	} else if mailer.Addr == "" {
+		return fmt.Errorf("no SMTP server configured: set smtp_addr in ~/.gatorconfig.json")
+	}
+	opts := digest.Options{From: mailer.From, Limit: int32(*limit), DryRun: *dryRun}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	send := func() error {
+		n, err := digest.Run(ctx, s.dbQueries, sender, opts)
+		fmt.Printf("Sent %d digests\n", n)
+		return err
+	}
+	if *every == 0 {
+		return send()
+	}
+
+	fmt.Printf("Sending digests every %s\n", *every)
+	ticker := time.NewTicker(*every)
+	defer ticker.Stop()
+	for {
+		if err := send(); err != nil {
+			fmt.Println("Error sending digests:", err)
+		}
+		select {
+		case <-ctx.Done():
+			fmt.Println("received interrupt; exiting digest")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// printSender is the digest.Sender for --dry-run: it prints each message
+// instead of mailing it.
+type printSender struct{}
+
+func (printSender) Send(to string, msg []byte) error {
+	fmt.Printf("--- digest for %s ---\n%s\n", to, msg)
+	return nil
+}
+
+// handlerWebhook manages the current user's webhooks.
+// Usage: webhook add|list|delete|log.
+func handlerWebhook(s *state, cmd command, currentUser database.User) error {
+	if len(cmd.arguments) == 0 {
+		return fmt.Errorf("usage: webhook add|list|delete|log")
+	}
+	args := cmd.arguments[1:]
+	switch cmd.arguments[0] {
+	case "add":
+		return webhookAdd(s, args, currentUser)
+	case "list":
+		if len(args) != 0 {
+			return fmt.Errorf("usage: webhook list")
+		}
+		return webhookList(s, currentUser)
+	case "delete":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: webhook delete <webhook-id>")
+		}
+		return webhookDelete(s, args[0], currentUser)
+	case "log":
+		return webhookLog(s, args, currentUser)
+	default:
+		return fmt.Errorf("unknown webhook subcommand %q; use add, list, delete or log", cmd.arguments[0])
+	}
+}
+
+// webhookAdd registers a webhook that new posts are POSTed to.
+func webhookAdd(s *state, args []string, currentUser database.User) error {
+	const usage = "usage: webhook add [--secret s] [--feed url] [--keyword k] <url>"
+	fs := flag.NewFlagSet("webhook add", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	secret := fs.String("secret", "", "sign requests with this secret")
+	feedURL := fs.String("feed", "", "only fire for this feed")
+	keyword := fs.String("keyword", "", "only fire for posts mentioning this")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", usage, err)
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf(usage)
+	}
+	target, err := url.Parse(fs.Arg(0))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q: want an http or https URL", fs.Arg(0))
+	}
+
+	ctx := context.Background()
+	var feedID uuid.NullUUID
+	if *feedURL != "" {
+		f, err := s.dbQueries.GetFollowedFeedByURL(ctx, database.GetFollowedFeedByURLParams{UserID: currentUser.ID, Url: *feedURL})
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("you do not follow %s", *feedURL)
+		}
+		if err != nil {
+			return fmt.Errorf("get feed by URL: %w", err)
+		}
+		feedID = uuid.NullUUID{UUID: f.ID, Valid: true}
+	}
+
+	w, err := s.dbQueries.CreateWebhook(ctx, database.CreateWebhookParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UserID:    currentUser.ID,
+		Url:       target.String(),
+		Secret:    strToNullString(*secret),
+		FeedID:    feedID,
+		Keyword:   strToNullString(strings.TrimSpace(*keyword)),
+	})
+	if err != nil {
+		return fmt.Errorf("create webhook: %w", err)
+	}
+	fmt.Println("Added webhook", w.ID)
+	return nil
+}
+
+// webhookList prints the user's webhooks. Secrets are not shown.
+func webhookList(s *state, currentUser database.User) error {
+	hooks, err := s.dbQueries.GetWebhooksForUser(context.Background(), currentUser.ID)
+	if err != nil {
+		return fmt.Errorf("get webhooks: %w", err)
+	}
+	if len(hooks) == 0 {
+		fmt.Println("No webhooks.")
+		return nil
+	}
+	for _, w := range hooks {
+		scope := "all feeds"
+		if w.FeedName.Valid {
+			scope = w.FeedName.String
+		}
+		if w.Keyword.Valid {
+			scope += fmt.Sprintf(", keyword %q", w.Keyword.String)
+		}
+		if w.Secret.Valid {
+			scope += ", signed"
+		}
+		fmt.Printf("%s  %s (%s)\n", w.ID, w.Url, scope)
+	}
+	return nil
+}
+
+// webhookDelete removes one of the user's webhooks and its delivery log.
+func webhookDelete(s *state, ref string, currentUser database.User) error {
+	id, err := uuid.Parse(ref)
+	if err != nil {
+		return fmt.Errorf("invalid webhook ID %q: %w", ref, err)
+	}
+	n, err := s.dbQueries.DeleteWebhook(context.Background(), database.DeleteWebhookParams{ID: id, UserID: currentUser.ID})
+	if err != nil {
+		return fmt.Errorf("delete webhook: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("no webhook %s", id)
+	}
+	fmt.Println("Deleted webhook", id)
+	return nil
+}
+
+// webhookLog prints the user's latest webhook deliveries.
+func webhookLog(s *state, args []string, currentUser database.User) error {
+	const usage = "usage: webhook log [--failed] [--limit n]"
+	fs := flag.NewFlagSet("webhook log", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	failed := fs.Bool("failed", false, "only failed deliveries")
+	limit := fs.Int("limit", 20, "number of deliveries")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", usage, err)
+	}
+	if fs.NArg() != 0 || *limit < 1 {
+		return fmt.Errorf(usage)
+	}
+	rows, err := s.dbQueries.GetWebhookDeliveriesForUser(context.Background(), database.GetWebhookDeliveriesForUserParams{
+		UserID:     currentUser.ID,
+		FailedOnly: *failed,
+		Limit:      int32(*limit),
+	})
+	if err != nil {
+		return fmt.Errorf("get webhook deliveries: %w", err)
+	}
+	if len(rows) == 0 {
+		fmt.Println("No webhook deliveries.")
+		return nil
+	}
+	for _, d := range rows {
+		outcome := "ok"
+		if !d.Succeeded {
+			outcome = "FAILED: " + d.Error.String
+		}
+		fmt.Printf("%s  %s  %q  %d attempts  %s\n", d.CreatedAt.Format(time.RFC3339), d.WebhookUrl, d.PostTitle, d.Attempts, outcome)
+	}
+	return nil
+}
+
+// handlerNotify manages the current user's chat notifiers.
+// Usage: notify add|list|delete|test.
+func handlerNotify(s *state, cmd command, currentUser database.User) error {
+	if len(cmd.arguments) == 0 {
+		return fmt.Errorf("usage: notify add|list|delete|test")
+	}
+	args := cmd.arguments[1:]
+	switch cmd.arguments[0] {
+	case "add":
+		return notifyAdd(s, args, currentUser)
+	case "list":
+		if len(args) != 0 {
+			return fmt.Errorf("usage: notify list")
+		}
+		return notifyList(s, currentUser)
+	case "delete":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: notify delete <notifier-id>")
+		}
+		return notifyDelete(s, args[0], currentUser)
+	case "test":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: notify test <notifier-id>")
+		}
+		return notifyTest(s, args[0], currentUser)
+	default:
+		return fmt.Errorf("unknown notify subcommand %q; use add, list, delete or test", cmd.arguments[0])
+	}
+}
+
+// notifyAdd registers a Slack, Discord or Matrix notifier after checking
+// its settings.
+func notifyAdd(s *state, args []string, currentUser database.User) error {
+	const usage = "usage: notify add [--feed url] [--room id] [--token t] <slack|discord|matrix> <url>"
+	fs := flag.NewFlagSet("notify add", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	feedURL := fs.String("feed", "", "only notify about this feed")
+	room := fs.String("room", "", "Matrix room ID")
+	token := fs.String("token", "", "Matrix access token")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", usage, err)
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf(usage)
+	}
+	kind, target := fs.Arg(0), fs.Arg(1)
+	if kind != notify.KindMatrix && (*room != "" || *token != "") {
+		return fmt.Errorf("--room and --token are only for matrix")
+	}
+	if _, err := notify.New(kind, target, *room, *token); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var feedID uuid.NullUUID
+	if *feedURL != "" {
+		f, err := s.dbQueries.GetFollowedFeedByURL(ctx, database.GetFollowedFeedByURLParams{UserID: currentUser.ID, Url: *feedURL})
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("you do not follow %s", *feedURL)
+		}
+		if err != nil {
+			return fmt.Errorf("get feed by URL: %w", err)
+		}
+		feedID = uuid.NullUUID{UUID: f.ID, Valid: true}
+	}
+
+	n, err := s.dbQueries.CreateNotifier(ctx, database.CreateNotifierParams{
+		ID:          uuid.New(),
+		CreatedAt:   time.Now().UTC(),
+		UserID:      currentUser.ID,
+		Kind:        kind,
+		Url:         target,
+		RoomID:      strToNullString(*room),
+		AccessToken: strToNullString(*token),
+		FeedID:      feedID,
+	})
+	if err != nil {
+		return fmt.Errorf("create notifier: %w", err)
+	}
+	fmt.Println("Added", kind, "notifier", n.ID)
+	fmt.Printf("Run 'notify test %s' to send a test message.\n", n.ID)
+	return nil
+}
+
+// notifyList prints the user's notifiers. Webhook URLs carry a secret, so
+// only their host is shown; access tokens are never shown.
+func notifyList(s *state, currentUser database.User) error {
+	rows, err := s.dbQueries.GetNotifiersForUser(context.Background(), currentUser.ID)
+	if err != nil {
+		return fmt.Errorf("get notifiers: %w", err)
+	}
+	if len(rows) == 0 {
+		fmt.Println("No notifiers.")
+		return nil
+	}
+	for _, n := range rows {
+		target := n.Url
+		if u, err := url.Parse(n.Url); err == nil && n.Kind != notify.KindMatrix {
+			target = u.Scheme + "://" + u.Host + "/…"
+		}
+		if n.RoomID.Valid {
+			target += " " + n.RoomID.String
+		}
+		scope := "all feeds"
+		if n.FeedName.Valid {
+			scope = n.FeedName.String
+		}
+		fmt.Printf("%s  %-7s %s (%s)\n", n.ID, n.Kind, target, scope)
+	}
+	return nil
+}
+
+// notifyDelete removes one of the user's notifiers.
+func notifyDelete(s *state, ref string, currentUser database.User) error {
+	id, err := uuid.Parse(ref)
+	if err != nil {
+		return fmt.Errorf("invalid notifier ID %q: %w", ref, err)
+	}
+	n, err := s.dbQueries.DeleteNotifier(context.Background(), database.DeleteNotifierParams{ID: id, UserID: currentUser.ID})
+	if err != nil {
+		return fmt.Errorf("delete notifier: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("no notifier %s", id)
+	}
+	fmt.Println("Deleted notifier", id)
+	return nil
+}
+
+// notifyTest sends a sample notification through one of the user's
+// notifiers and reports the outcome.
+func notifyTest(s *state, ref string, currentUser database.User) error {
+	id, err := uuid.Parse(ref)
+	if err != nil {
+		return fmt.Errorf("invalid notifier ID %q: %w", ref, err)
+	}
+	ctx := context.Background()
+	row, err := s.dbQueries.GetNotifierForUser(ctx, database.GetNotifierForUserParams{ID: id, UserID: currentUser.ID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no notifier %s", id)
+	}
+	if err != nil {
+		return fmt.Errorf("get notifier: %w", err)
+	}
+	n, err := notify.FromDB(row)
+	if err != nil {
+		return err
+	}
+	if err := n.Notify(ctx, notify.Post{
+		Title:       "Test notification from gator",
+		URL:         "https://github.com/markcromwell/gator",
+		PublishedAt: time.Now().UTC(),
+		FeedName:    "gator",
+		FeedURL:     "https://github.com/markcromwell/gator",
+	}); err != nil {
+		return fmt.Errorf("send test notification: %w", err)
+	}
+	fmt.Println("Sent a test notification to", row.Kind)
+	return nil
+}
+
+func main() {
+	conf, err := config.Read()
+	if err != nil {
+		fmt.Println("Error reading config:", err)
+		os.Exit(1)
+	}
+
+	cmdState := &state{config: conf, discover: feed.Discover}
+
+	db, err := sql.Open("postgres", conf.DbURL)
+	if err != nil {
+		fmt.Println("Error connecting to the database:", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	cmdState.db = db
+	cmdState.dbQueries = database.New(db)
+
+	cmds := &commands{commandsMap: make(map[string]func(*state, command) error)}
+	if err := cmds.register("login", handlerLogin); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("register", handlerRegister); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("reset", handlerReset); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("users", handlerUsers); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("agg", handlerAgg); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("addfeed", middlewareLoggedIn(handlerAddFeed)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("feeds", handlerFeeds); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("follow", middlewareLoggedIn(handlerFollow)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("following", middlewareLoggedIn(handlerFollowing)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("unfollow", middlewareLoggedIn(handlerUnfollow)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("scrapeFeeds", handlerScrapeFeeds); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("unhealthy", handlerUnhealthy); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("enablefeed", middlewareLoggedIn(handlerEnableFeed)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("migrate", handlerMigrate); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("import", middlewareLoggedIn(handlerImport)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("export", middlewareLoggedIn(handlerExport)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("browse", middlewareLoggedIn(handlerBrowse)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("markread", middlewareLoggedIn(handlerMarkRead)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("markunread", middlewareLoggedIn(handlerMarkUnread)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("star", middlewareLoggedIn(handlerStar)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("unstar", middlewareLoggedIn(handlerUnstar)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("note", middlewareLoggedIn(handlerNote)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("starred", middlewareLoggedIn(handlerStarred)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("search", middlewareLoggedIn(handlerSearch)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("filter", middlewareLoggedIn(handlerFilter)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("purge", handlerPurge); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("retention", middlewareLoggedIn(handlerRetention)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("serve", handlerServe); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("token", middlewareLoggedIn(handlerToken)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("fever", middlewareLoggedIn(handlerFever)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("publish", middlewareLoggedIn(handlerPublish)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("planet", middlewareLoggedIn(handlerPlanet)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("digest", middlewareLoggedIn(handlerDigest)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("webhook", middlewareLoggedIn(handlerWebhook)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+	if err := cmds.register("notify", middlewareLoggedIn(handlerNotify)); err != nil {
+		fmt.Println("Error registering command:", err)
+		os.Exit(1)
+	}
+
+	args := os.Args
+	if len(args) < 2 {
+		fmt.Println("Usage: gator <command> [arguments]")
+		os.Exit(1)
 	}
 
 	cmdName := args[1]
 	cmdArgs := args[2:]
 	cmd2Run := command{name: cmdName, arguments: cmdArgs}
+	if cmdName != "migrate" {
+		if err := checkSchema(cmdState); err != nil {
+			fmt.Println(err)
+			db.Close()
+			os.Exit(1)
+		}
+	}
 	err = cmds.run(cmdState, cmd2Run)
 	db.Close()
 	if err != nil {
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+)
+
+func TestHandlerDigest(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	mock.ExpectExec(`(?i)INSERT INTO digest_subscriptions`).
+		WithArgs(user.ID, sqlmock.AnyArg(), "bob@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`(?i)FROM digest_subscriptions`).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "name", "email", "last_seq", "last_sent_at"}).
+			AddRow(user.ID, "bob", "bob@example.com", int64(7), nil))
+	mock.ExpectQuery(`(?i)FROM posts p\s+JOIN feed_follows`).
+		WithArgs(user.ID, int64(7), int32(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"seq", "title", "url", "published_at", "feed_name", "feed_url"}).
+			AddRow(int64(8), "Comic", "https://xkcd.com/1", time.Now(), "xkcd", "https://xkcd.com/rss.xml"))
+	// --dry-run leaves the watermark alone
+	mock.ExpectExec(`(?i)DELETE FROM digest_subscriptions`).
+		WithArgs(user.ID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	out := captureStdout(t, func() {
+		for _, args := range [][]string{
+			{"subscribe", "Bob <bob@example.com>"},
+			{"send", "--dry-run", "--limit", "10"},
+			{"unsubscribe"},
+		} {
+			if err := handlerDigest(s, command{name: "digest", arguments: args}, user); err != nil {
+				t.Fatalf("handlerDigest %v: %v", args, err)
+			}
+		}
+	})
+	for _, want := range []string{
+		"Digests for bob will be sent to bob@example.com.",
+		"--- digest for bob@example.com ---",
+		"Subject: gator digest: 1 new post",
+		"Sent 1 digests",
+		"bob is not subscribed to digests.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"subscribe"},
+		{"subscribe", "not an address"},
+		{"unsubscribe", "x"},
+		{"send"}, // no smtp_addr configured
+		{"send", "--limit", "0"},
+		{"send", "extra"},
+		{"bogus"},
+	} {
+		if err := handlerDigest(s, command{name: "digest", arguments: args}, user); err == nil {
+			t.Errorf("expected error for digest %v", args)
+		}
+	}
+}
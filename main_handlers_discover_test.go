@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/feed"
+)
+
+// stubDiscover returns a discover hook that answers from found, keyed by
+// page URL.
+func stubDiscover(found map[string][]feed.Candidate) func(context.Context, string) ([]feed.Candidate, error) {
+	return func(_ context.Context, pageURL string) ([]feed.Candidate, error) {
+		if c, ok := found[pageURL]; ok {
+			return c, nil
+		}
+		return nil, errors.New("no feed found at " + pageURL)
+	}
+}
+
+func TestHandlerAddFeed_Autodiscovery(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+	s.discover = stubDiscover(map[string][]feed.Candidate{
+		"https://blog.example.com": {{URL: "https://blog.example.com/index.xml", Title: "Blog"}},
+	})
+
+	uid, fid := uuid.New(), uuid.New()
+	now := time.Now()
+
+	// the resolved feed URL is stored, not the homepage
+	mock.ExpectQuery(`INSERT INTO feeds`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "blog", "https://blog.example.com/index.xml", uid).
+		WillReturnRows(feedRows(fid, now, "blog", "https://blog.example.com/index.xml", uid))
+	mock.ExpectQuery(`WITH inserted AS`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "user_id", "feed_id", "user_name", "feed_name"}).
+			AddRow(uuid.New(), now, now, uid, fid, "bob", "blog"))
+
+	user := database.User{ID: uid, Name: "bob"}
+	out := captureStdout(t, func() {
+		if err := handlerAddFeed(s, command{name: "addfeed", arguments: []string{"blog", "https://blog.example.com"}}, user); err != nil {
+			t.Fatalf("handlerAddFeed: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Found feed https://blog.example.com/index.xml") {
+		t.Errorf("expected discovery notice, got: %s", out)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestHandlerAddFeed_NoFeedFound(t *testing.T) {
+	s, _, cleanup := makeStateWithMock(t)
+	defer cleanup()
+	s.discover = stubDiscover(nil)
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	if err := handlerAddFeed(s, command{name: "addfeed", arguments: []string{"x", "https://nofeed.example.com"}}, user); err == nil {
+		t.Fatalf("expected error when no feed is found")
+	}
+}
+
+func TestHandlerFollow_ChoosesAmongSeveralFeeds(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+	s.discover = stubDiscover(map[string][]feed.Candidate{
+		"https://blog.example.com": {
+			{URL: "https://blog.example.com/posts.xml", Title: "Posts"},
+			{URL: "https://blog.example.com/comments.xml", Title: "Comments"},
+		},
+	})
+	s.stdin = strings.NewReader("2\n")
+
+	uid, fid := uuid.New(), uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds\s+where url`).
+		WithArgs("https://blog.example.com").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds\s+where url`).
+		WithArgs("https://blog.example.com/comments.xml").
+		WillReturnRows(feedRows(fid, now, "comments", "https://blog.example.com/comments.xml", uid))
+	mock.ExpectQuery(`WITH inserted AS`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "user_id", "feed_id", "user_name", "feed_name"}).
+			AddRow(uuid.New(), now, now, uid, fid, "bob", "comments"))
+
+	user := database.User{ID: uid, Name: "bob"}
+	out := captureStdout(t, func() {
+		if err := handlerFollow(s, command{name: "follow", arguments: []string{"https://blog.example.com"}}, user); err != nil {
+			t.Fatalf("handlerFollow: %v", err)
+		}
+	})
+	if !strings.Contains(out, "1) Posts - https://blog.example.com/posts.xml") {
+		t.Errorf("expected candidate list, got: %s", out)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	s.stdin = strings.NewReader("7\n")
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds\s+where url`).WillReturnError(sql.ErrNoRows)
+	captureStdout(t, func() {
+		if err := handlerFollow(s, command{name: "follow", arguments: []string{"https://blog.example.com"}}, user); err == nil {
+			t.Errorf("expected error for an out-of-range choice")
+		}
+	})
+}
@@ -4,9 +4,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
 	"github.com/markcromwell/gator/internal/database"
 )
@@ -77,3 +79,46 @@ func TestHandlerLogin_DBError(t *testing.T) {
 		t.Fatalf("expected error when DB query fails")
 	}
 }
+
+func TestHandlerMigrate_InvalidArgs(t *testing.T) {
+	s, _, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	if err := handlerMigrate(s, command{name: "migrate"}); err == nil {
+		t.Fatalf("expected error for missing subcommand")
+	}
+	if err := handlerMigrate(s, command{name: "migrate", arguments: []string{"sideways"}}); err == nil {
+		t.Fatalf("expected error for unknown subcommand")
+	}
+	if err := handlerMigrate(s, command{name: "migrate", arguments: []string{"baseline"}}); err == nil {
+		t.Fatalf("expected error for baseline without a version")
+	}
+	if err := handlerMigrate(s, command{name: "migrate", arguments: []string{"baseline", "latest"}}); err == nil {
+		t.Fatalf("expected error for a non-numeric baseline version")
+	}
+}
+
+func TestCheckSchema_Behind(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	// a database without schema_migrations or goose_db_version is either new
+	// or was set up by hand
+	mock.ExpectQuery(`SELECT to_regclass`).WithArgs("schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow(nil))
+	mock.ExpectQuery(`SELECT to_regclass`).WithArgs("goose_db_version").WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow(nil))
+
+	err := checkSchema(s)
+	if err == nil || !strings.Contains(err.Error(), "gator migrate up") || !strings.Contains(err.Error(), "gator migrate baseline") {
+		t.Fatalf("expected untracked-schema error, got %v", err)
+	}
+
+	// a tracked database missing the latest migrations
+	mock.ExpectQuery(`SELECT to_regclass`).WithArgs("schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow("schema_migrations"))
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, time.Now()))
+
+	err = checkSchema(s)
+	if err == nil || !strings.Contains(err.Error(), "pending, starting with 002_feeds.sql") {
+		t.Fatalf("expected schema-behind error, got %v", err)
+	}
+}
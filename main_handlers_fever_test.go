@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+	"github.com/markcromwell/gator/internal/fever"
+)
+
+func TestHandlerFever(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	mock.ExpectExec(`(?i)INSERT INTO fever_credentials`).
+		WithArgs(user.ID, sqlmock.AnyArg(), fever.APIKey("bob", "hunter2")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`(?i)DELETE FROM fever_credentials`).
+		WithArgs(user.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	out := captureStdout(t, func() {
+		for _, args := range [][]string{{"set", "hunter2"}, {"clear"}} {
+			if err := handlerFever(s, command{name: "fever", arguments: args}, user); err != nil {
+				t.Fatalf("handlerFever %v: %v", args, err)
+			}
+		}
+	})
+	if !strings.Contains(out, "Fever login set for bob") || !strings.Contains(out, "Fever login cleared for bob") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	for _, args := range [][]string{{}, {"set"}, {"clear", "x"}, {"bogus"}} {
+		if err := handlerFever(s, command{name: "fever", arguments: args}, user); err == nil {
+			t.Errorf("expected error for fever %v", args)
+		}
+	}
+}
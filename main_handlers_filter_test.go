@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+)
+
+var filterRuleColumns = []string{"id", "created_at", "user_id", "feed_id", "field", "pattern", "is_regex", "action"}
+
+func TestHandlerFilter_AddListDelete(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	feedID, ruleID := uuid.New(), uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds\s+where url`).
+		WithArgs("https://example.com/feed").
+		WillReturnRows(feedRows(feedID, now, "example", "https://example.com/feed", user.ID))
+	mock.ExpectQuery(`(?i)INSERT INTO filter_rules`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), user.ID, uuid.NullUUID{UUID: feedID, Valid: true}, "title", "^Sponsored:", true, "mute").
+		WillReturnRows(sqlmock.NewRows(filterRuleColumns).
+			AddRow(ruleID, now, user.ID, feedID, "title", "^Sponsored:", true, "mute"))
+	mock.ExpectQuery(`(?i)SELECT .+ FROM filter_rules r\s+LEFT JOIN feeds`).
+		WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows(append(filterRuleColumns, "feed_name")).
+			AddRow(ruleID, now, user.ID, feedID, "title", "^Sponsored:", true, "mute", "example"))
+	mock.ExpectExec(`(?i)DELETE FROM filter_rules`).
+		WithArgs(ruleID, user.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	out := captureStdout(t, func() {
+		for _, args := range [][]string{
+			{"add", "--feed", "https://example.com/feed", "--field", "title", "--regex", "mute", "^Sponsored:"},
+			{"list"},
+			{"delete", ruleID.String()},
+		} {
+			if err := handlerFilter(s, command{name: "filter", arguments: args}, user); err != nil {
+				t.Fatalf("handlerFilter %v: %v", args, err)
+			}
+		}
+	})
+	if !strings.Contains(out, "Added filter rule "+ruleID.String()) ||
+		!strings.Contains(out, `mute      title regex "^Sponsored:" (example)`) ||
+		!strings.Contains(out, "Deleted filter rule") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"add", "--field", "body", "mute", "x"},
+		{"add", "explode", "x"},
+		{"add", "--regex", "mute", "("},
+		{"add", "mute"},
+		{"bogus"},
+	} {
+		if err := handlerFilter(s, command{name: "filter", arguments: args}, user); err == nil {
+			t.Errorf("expected error for filter %v", args)
+		}
+	}
+}
+
+func TestHandlerFilter_Apply(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	feedID, noisy, release, plain := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(`(?i)SELECT .+ FROM filter_rules r\s+LEFT JOIN feeds`).
+		WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows(append(filterRuleColumns, "feed_name")).
+			AddRow(uuid.New(), now, user.ID, nil, "category", "ads", false, "mute", nil).
+			AddRow(uuid.New(), now, user.ID, nil, "title", "release", false, "highlight", nil).
+			AddRow(uuid.New(), now, user.ID, nil, "title", "release", false, "star", nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(`(?i)UPDATE user_post_state\s+SET muted = FALSE`).
+		WithArgs(user.ID).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectQuery(`(?i)SELECT .+ FROM posts p\s+JOIN feed_follows`).
+		WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "feed_id", "title", "description", "author", "categories"}).
+			AddRow(noisy, feedID, "Buy now", nil, nil, "{Ads}").
+			AddRow(release, feedID, "v2 release", "notes", "alice", "{}").
+			AddRow(plain, feedID, "Just a post", nil, nil, "{}"))
+	mock.ExpectExec(`(?i)INSERT INTO user_post_state .+muted`).
+		WithArgs(user.ID, noisy, true, false, false, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`(?i)INSERT INTO user_post_state .+muted`).
+		WithArgs(user.ID, release, false, true, false, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	out := captureStdout(t, func() {
+		if err := handlerFilter(s, command{name: "filter", arguments: []string{"apply"}}, user); err != nil {
+			t.Fatalf("filter apply: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Applied 3 rules to 3 posts: 1 muted, 1 highlighted, 0 marked read, 1 starred") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestHandlerFilter_ApplyRollsBack(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	now := time.Now()
+
+	mock.ExpectQuery(`(?i)SELECT .+ FROM filter_rules r\s+LEFT JOIN feeds`).
+		WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows(append(filterRuleColumns, "feed_name")).
+			AddRow(uuid.New(), now, user.ID, nil, "title", "v2", false, "mute", nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(`(?i)UPDATE user_post_state\s+SET muted = FALSE`).
+		WithArgs(user.ID).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectQuery(`(?i)SELECT .+ FROM posts p\s+JOIN feed_follows`).
+		WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "feed_id", "title", "description", "author", "categories"}).
+			AddRow(uuid.New(), uuid.New(), "v2", nil, nil, "{}"))
+	mock.ExpectExec(`(?i)INSERT INTO user_post_state .+muted`).
+		WillReturnError(errors.New("connection reset"))
+	// the cleared flags are restored
+	mock.ExpectRollback()
+
+	if err := handlerFilter(s, command{name: "filter", arguments: []string{"apply"}}, user); err == nil {
+		t.Fatalf("expected error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
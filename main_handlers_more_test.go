@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"strings"
 	"testing"
 	"time"
@@ -18,11 +19,9 @@ func TestHandlerFeeds(t *testing.T) {
 	uid := uuid.New()
 	now := time.Now()
 
-	// feed rows: id, created_at, last_fetched_at, updated_at, name, url, user_id
-	feedRows := sqlmock.NewRows([]string{"id", "created_at", "last_fetched_at", "updated_at", "name", "url", "user_id"}).
-		AddRow(fid, now, nil, now, "feed1", "https://example.com/feed", uid)
+	fRows := feedRows(fid, now, "feed1", "https://example.com/feed", uid)
 
-	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds ORDER BY`).WillReturnRows(feedRows)
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds ORDER BY`).WillReturnRows(fRows)
 
 	// expect user lookup
 	userRows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "name"}).
@@ -55,9 +54,8 @@ func TestHandlerFollowing(t *testing.T) {
 	mock.ExpectQuery(`(?i)SELECT .+ FROM feed_follows`).WillReturnRows(followsRows)
 
 	// GetFeedByID returns feed row
-	feedRows := sqlmock.NewRows([]string{"id", "created_at", "last_fetched_at", "updated_at", "name", "url", "user_id"}).
-		AddRow(fid, now, nil, now, "f1", "https://example.com", uid)
-	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds WHERE id`).WillReturnRows(feedRows)
+	fRows := feedRows(fid, now, "f1", "https://example.com", uid)
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds WHERE id`).WillReturnRows(fRows)
 
 	currentUser := database.User{ID: uid, CreatedAt: now, UpdatedAt: now, Name: "bob"}
 
@@ -81,9 +79,8 @@ func TestHandlerUnfollow(t *testing.T) {
 	now := time.Now()
 
 	// GetFeedByURL
-	feedRows := sqlmock.NewRows([]string{"id", "created_at", "last_fetched_at", "updated_at", "name", "url", "user_id"}).
-		AddRow(fid, now, nil, now, "f1", "https://example.com", uid)
-	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds WHERE url`).WillReturnRows(feedRows)
+	fRows := feedRows(fid, now, "f1", "https://example.com", uid)
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds WHERE url`).WillReturnRows(fRows)
 
 	// Expect delete exec
 	mock.ExpectExec(`DELETE FROM feed_follows`).WillReturnResult(sqlmock.NewResult(0, 1))
@@ -128,3 +125,58 @@ func TestMiddlewareLoggedIn(t *testing.T) {
 		t.Fatalf("wrapped handler was not called")
 	}
 }
+
+func TestHandlerUnhealthy(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	now := time.Now()
+	rows := sqlmock.NewRows(feedColumns).
+		AddRow(uuid.New(), now, now, now, "dead", "https://dead.example/feed", uuid.New(), nil, nil, nil, nil, 600, nil,
+			10, "fetch https://dead.example/feed: unexpected status: 404 Not Found", 404, nil, now, nil, nil, int64(1)).
+		AddRow(uuid.New(), now, now, now, "flaky", "https://flaky.example/feed", uuid.New(), nil, nil, nil, nil, 600, nil,
+			2, "fetch https://flaky.example/feed: http do: timeout", nil, now, nil, nil, nil, int64(2))
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds\s+WHERE consecutive_failures > 0`).WillReturnRows(rows)
+
+	out := captureStdout(t, func() {
+		if err := handlerUnhealthy(s, command{name: "unhealthy"}); err != nil {
+			t.Fatalf("handlerUnhealthy: %v", err)
+		}
+	})
+
+	for _, want := range []string{
+		"dead - https://dead.example/feed (disabled since",
+		"10 consecutive failures, last status 404, last success never",
+		"flaky - https://flaky.example/feed (failing)",
+		"last error: fetch https://flaky.example/feed: http do: timeout",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output: %s", want, out)
+		}
+	}
+}
+
+func TestHandlerEnableFeed(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	now := time.Now()
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	mock.ExpectQuery(`(?i)UPDATE feeds\s+SET disabled_at = NULL`).
+		WithArgs("https://dead.example/feed").
+		WillReturnRows(feedRows(uuid.New(), now, "dead", "https://dead.example/feed", user.ID))
+
+	out := captureStdout(t, func() {
+		if err := handlerEnableFeed(s, command{name: "enablefeed", arguments: []string{"https://dead.example/feed"}}, user); err != nil {
+			t.Fatalf("handlerEnableFeed: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Feed dead re-enabled") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	mock.ExpectQuery(`(?i)UPDATE feeds\s+SET disabled_at = NULL`).WillReturnError(sql.ErrNoRows)
+	if err := handlerEnableFeed(s, command{name: "enablefeed", arguments: []string{"https://nope.example/feed"}}, user); err == nil {
+		t.Fatalf("expected error for unknown feed")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+)
+
+var notifierColumns = []string{"id", "created_at", "user_id", "kind", "url", "room_id", "access_token", "feed_id"}
+
+func TestHandlerNotify(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	var hits int
+	matrix := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.Method != http.MethodPut || r.Header.Get("Authorization") != "Bearer syt_secret" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer matrix.Close()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	feedID, slackID, matrixID := uuid.New(), uuid.New(), uuid.New()
+	now := time.Now()
+	slackURL := "https://hooks.slack.com/services/T0/B0/secret"
+
+	mock.ExpectQuery(`(?i)FROM feeds f\s+JOIN feed_follows ff .+ f.url`).
+		WithArgs(user.ID, "https://example.com/feed").
+		WillReturnRows(feedRows(feedID, now, "example", "https://example.com/feed", user.ID))
+	mock.ExpectQuery(`(?i)INSERT INTO notifiers`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), user.ID, "slack", slackURL, sql.NullString{}, sql.NullString{}, uuid.NullUUID{UUID: feedID, Valid: true}).
+		WillReturnRows(sqlmock.NewRows(notifierColumns).AddRow(slackID, now, user.ID, "slack", slackURL, nil, nil, feedID))
+	mock.ExpectQuery(`(?i)INSERT INTO notifiers`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), user.ID, "matrix", matrix.URL,
+			sql.NullString{String: "!abc:example.org", Valid: true}, sql.NullString{String: "syt_secret", Valid: true}, uuid.NullUUID{}).
+		WillReturnRows(sqlmock.NewRows(notifierColumns).AddRow(matrixID, now, user.ID, "matrix", matrix.URL, "!abc:example.org", "syt_secret", nil))
+	mock.ExpectQuery(`(?i)FROM notifiers n\s+LEFT JOIN feeds`).
+		WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows(append(notifierColumns, "feed_name")).
+			AddRow(slackID, now, user.ID, "slack", slackURL, nil, nil, feedID, "example").
+			AddRow(matrixID, now, user.ID, "matrix", matrix.URL, "!abc:example.org", "syt_secret", nil, nil))
+	mock.ExpectQuery(`(?i)FROM notifiers\s+WHERE id`).
+		WithArgs(matrixID, user.ID).
+		WillReturnRows(sqlmock.NewRows(notifierColumns).AddRow(matrixID, now, user.ID, "matrix", matrix.URL, "!abc:example.org", "syt_secret", nil))
+	mock.ExpectExec(`(?i)DELETE FROM notifiers`).
+		WithArgs(slackID, user.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	out := captureStdout(t, func() {
+		for _, args := range [][]string{
+			{"add", "--feed", "https://example.com/feed", "slack", slackURL},
+			{"add", "--room", "!abc:example.org", "--token", "syt_secret", "matrix", matrix.URL},
+			{"list"},
+			{"test", matrixID.String()},
+			{"delete", slackID.String()},
+		} {
+			if err := handlerNotify(s, command{name: "notify", arguments: args}, user); err != nil {
+				t.Fatalf("handlerNotify %v: %v", args, err)
+			}
+		}
+	})
+	for _, want := range []string{
+		"Added slack notifier " + slackID.String(),
+		"slack   https://hooks.slack.com/… (example)",
+		"matrix  " + matrix.URL + " !abc:example.org (all feeds)",
+		"Sent a test notification to matrix",
+		"Deleted notifier " + slackID.String(),
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "syt_secret") || strings.Contains(out, "/B0/secret") {
+		t.Errorf("secret leaked into output:\n%s", out)
+	}
+	if hits != 1 {
+		t.Errorf("matrix requests = %d, want 1", hits)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"add", "slack"},
+		{"add", "irc", "https://example.com"},
+		{"add", "--room", "!abc:example.org", "slack", slackURL},
+		{"add", "matrix", "https://matrix.example.org"},
+		{"list", "x"},
+		{"delete", "not-a-uuid"},
+		{"test"},
+		{"bogus"},
+	} {
+		if err := handlerNotify(s, command{name: "notify", arguments: args}, user); err == nil {
+			t.Errorf("expected error for notify %v", args)
+		}
+	}
+
+	// a feed the user does not follow
+	mock.ExpectQuery(`(?i)FROM feeds f\s+JOIN feed_follows ff .+ f.url`).
+		WithArgs(user.ID, "https://example.com/other").
+		WillReturnError(sql.ErrNoRows)
+	err := handlerNotify(s, command{name: "notify", arguments: []string{"add", "--feed", "https://example.com/other", "slack", slackURL}}, user)
+	if err == nil || !strings.Contains(err.Error(), "you do not follow https://example.com/other") {
+		t.Fatalf("expected a not-followed error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+)
+
+func TestHandlerImport(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	path := filepath.Join(t.TempDir(), "subs.opml")
+	doc := `<opml version="2.0"><body>
+  <outline text="Known" xmlUrl="https://known.example/feed"/>
+  <outline text="Tech">
+    <outline text="New Feed" xmlUrl="https://new.example/feed"/>
+  </outline>
+</body></opml>`
+	if err := os.WriteFile(path, []byte(doc), 0644); err != nil {
+		t.Fatalf("write opml: %v", err)
+	}
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	now := time.Now()
+	knownID, newID := uuid.New(), uuid.New()
+	followCols := []string{"id", "inserted"}
+
+	// an existing feed that is already followed
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds\s+where url`).
+		WithArgs("https://known.example/feed").
+		WillReturnRows(feedRows(knownID, now, "Known", "https://known.example/feed", uuid.New()))
+	mock.ExpectQuery(`(?i)INSERT INTO feed_follows .+ ON CONFLICT`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), user.ID, knownID, sql.NullString{}).
+		WillReturnRows(sqlmock.NewRows(followCols).AddRow(uuid.New(), false))
+
+	// a new feed in a folder
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds\s+where url`).
+		WithArgs("https://new.example/feed").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`(?i)INSERT INTO feeds`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "New Feed", "https://new.example/feed", user.ID).
+		WillReturnRows(feedRows(newID, now, "New Feed", "https://new.example/feed", user.ID))
+	mock.ExpectQuery(`(?i)INSERT INTO feed_follows .+ ON CONFLICT`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), user.ID, newID, sql.NullString{String: "Tech", Valid: true}).
+		WillReturnRows(sqlmock.NewRows(followCols).AddRow(uuid.New(), true))
+
+	out := captureStdout(t, func() {
+		if err := handlerImport(s, command{name: "import", arguments: []string{path}}, user); err != nil {
+			t.Fatalf("handlerImport: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Imported 2 feeds: 1 new feeds, 1 new follows, 1 already followed, 0 failed") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestHandlerExport(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	mock.ExpectQuery(`(?i)SELECT f.name, f.url, ff.folder`).
+		WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "url", "folder"}).
+			AddRow("xkcd", "https://xkcd.com/rss.xml", nil).
+			AddRow("Go Blog", "https://go.dev/blog/feed.atom", "Tech"))
+
+	path := filepath.Join(t.TempDir(), "out.opml")
+	captureStdout(t, func() {
+		if err := handlerExport(s, command{name: "export", arguments: []string{path}}, user); err != nil {
+			t.Fatalf("handlerExport: %v", err)
+		}
+	})
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	out := string(b)
+	for _, want := range []string{
+		`<opml version="2.0">`,
+		`xmlUrl="https://xkcd.com/rss.xml"`,
+		`<outline text="Tech" title="Tech">`,
+		`xmlUrl="https://go.dev/blog/feed.atom"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in export:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+)
+
+var timelineColumns = []string{"id", "title", "url", "description", "author", "categories", "published_at", "updated_at", "feed_name", "feed_url"}
+
+func TestHandlerPlanet(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	now := time.Now()
+	mock.ExpectQuery(`(?i)FROM posts p\s+JOIN feed_follows`).
+		WithArgs(user.ID, sql.NullString{}, sql.NullString{}, false, false, false, int32(6)).
+		WillReturnRows(sqlmock.NewRows(timelineColumns).
+			AddRow(uuid.New(), "Comic", "https://xkcd.com/1", "<p>Stick figures</p>", nil, "{}", now, now, "xkcd", "https://xkcd.com/rss.xml").
+			AddRow(uuid.New(), "Go 1.23", "https://go.dev/blog/go1.23", nil, nil, "{}", now.Add(-time.Hour), now, "Go Blog", "https://go.dev/blog/feed.atom"))
+	mock.ExpectQuery(`(?i)SELECT f.name, f.url, ff.folder`).
+		WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "url", "folder"}).
+			AddRow("Go Blog", "https://go.dev/blog/feed.atom", "Tech").
+			AddRow("xkcd", "https://xkcd.com/rss.xml", nil))
+
+	dir := filepath.Join(t.TempDir(), "site")
+	stdout := captureStdout(t, func() {
+		args := []string{"--per-page", "1", "--pages", "6", "--url", "https://planet.example.com/", dir}
+		if err := handlerPlanet(s, command{name: "planet", arguments: args}, user); err != nil {
+			t.Fatalf("handlerPlanet: %v", err)
+		}
+	})
+	if !strings.Contains(stdout, "Wrote 2 posts on 2 pages, atom.xml and blogroll.opml to "+dir) {
+		t.Errorf("unexpected output: %s", stdout)
+	}
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatalf("read index.html: %v", err)
+	}
+	if !strings.Contains(string(index), "<title>Planet bob</title>") || !strings.Contains(string(index), "Stick figures") {
+		t.Errorf("unexpected index.html:\n%s", index)
+	}
+	atom, err := os.ReadFile(filepath.Join(dir, "atom.xml"))
+	if err != nil || !strings.Contains(string(atom), "https://planet.example.com/atom.xml") {
+		t.Errorf("unexpected atom.xml (%v):\n%s", err, atom)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestHandlerPlanet_All(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	now := time.Now()
+	mock.ExpectQuery(`(?i)FROM posts p\s+JOIN feeds f .+LIMIT`).
+		WithArgs(int32(200)).
+		WillReturnRows(sqlmock.NewRows(timelineColumns).
+			AddRow(uuid.New(), "Comic", "https://xkcd.com/1", nil, nil, "{}", now, now, "xkcd", "https://xkcd.com/rss.xml"))
+	mock.ExpectQuery(`(?i)FROM feeds\s+WHERE disabled_at IS NULL`).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "url"}).AddRow("xkcd", "https://xkcd.com/rss.xml"))
+
+	dir := t.TempDir()
+	captureStdout(t, func() {
+		if err := handlerPlanet(s, command{name: "planet", arguments: []string{"--all", dir}}, database.User{Name: "bob"}); err != nil {
+			t.Fatalf("handlerPlanet: %v", err)
+		}
+	})
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil || !strings.Contains(string(index), "<title>Planet gator</title>") {
+		t.Errorf("unexpected index.html (%v):\n%s", err, index)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"--per-page", "0", dir},
+		{"a", "b"},
+	} {
+		if err := handlerPlanet(s, command{name: "planet", arguments: args}, database.User{}); err == nil {
+			t.Errorf("expected error for planet %v", args)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+)
+
+// postStateColumns are the columns returned by GetStarredPostsForUser,
+// less the note.
+var postStateColumns = []string{"id", "created_at", "updated_at", "title", "url", "description", "published_at", "feed_id", "guid", "search_vector", "author", "categories", "seq", "read"}
+
+// browseColumns are the columns returned by GetPostsForUser.
+var browseColumns = []string{"id", "created_at", "updated_at", "title", "url", "description", "published_at", "feed_id", "guid", "search_vector", "author", "categories", "seq", "feed_name", "read", "highlighted"}
+
+func TestHandlerBrowse_UnreadByDefault(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	now := time.Now()
+	mock.ExpectQuery(`(?i)SELECT .+ FROM posts p\s+JOIN feed_follows ff`).
+		WithArgs(user.ID, false, sql.NullString{}, sql.NullTime{}, int32(2), int32(0)).
+		WillReturnRows(sqlmock.NewRows(browseColumns).
+			AddRow(uuid.New(), now, now, "Fresh", "https://example.com/fresh", nil, now, uuid.New(), "g1", nil, nil, "{}", int64(2), "example", false, false))
+
+	out := captureStdout(t, func() {
+		if err := handlerBrowse(s, command{name: "browse"}, user); err != nil {
+			t.Fatalf("handlerBrowse: %v", err)
+		}
+	})
+	if !strings.Contains(out, "* Fresh") || !strings.Contains(out, "Feed: example") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	// --all includes read posts, which are shown without the marker
+	mock.ExpectQuery(`(?i)SELECT .+ FROM posts p`).
+		WithArgs(user.ID, true, sql.NullString{}, sql.NullTime{}, int32(5), int32(0)).
+		WillReturnRows(sqlmock.NewRows(browseColumns).
+			AddRow(uuid.New(), now, now, "Old", "https://example.com/old", nil, now, uuid.New(), "g2", nil, nil, "{}", int64(1), "example", true, false))
+	out = captureStdout(t, func() {
+		if err := handlerBrowse(s, command{name: "browse", arguments: []string{"--all", "5"}}, user); err != nil {
+			t.Fatalf("handlerBrowse --all: %v", err)
+		}
+	})
+	if !strings.Contains(out, "  Old") || strings.Contains(out, "* Old") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	if err := handlerBrowse(s, command{name: "browse", arguments: []string{"--bogus"}}, user); err == nil {
+		t.Fatalf("expected error for unknown flag")
+	}
+}
+
+func TestHandlerBrowse_FiltersAndPaging(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	now := time.Now()
+	mock.ExpectQuery(`(?i)SELECT .+ FROM posts p\s+JOIN feed_follows ff`).
+		WithArgs(user.ID, false,
+			sql.NullString{String: "xkcd", Valid: true},
+			sql.NullTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+			int32(10), int32(20)).
+		WillReturnRows(sqlmock.NewRows(browseColumns).
+			AddRow(uuid.New(), now, now, "Older", "https://xkcd.com/1", nil, now, uuid.New(), "g", nil, "Randall", "{comics}", int64(2), "xkcd", false, true))
+	mock.ExpectQuery(`(?i)SELECT .+ FROM posts p`).
+		WithArgs(user.ID, false, sql.NullString{}, sql.NullTime{}, int32(2), int32(8)).
+		WillReturnRows(sqlmock.NewRows(browseColumns))
+
+	out := captureStdout(t, func() {
+		args := []string{"--feed", "xkcd", "--since", "2024-01-01", "--page", "3", "10"}
+		if err := handlerBrowse(s, command{name: "browse", arguments: args}, user); err != nil {
+			t.Fatalf("handlerBrowse: %v", err)
+		}
+		if err := handlerBrowse(s, command{name: "browse", arguments: []string{"--page", "5"}}, user); err != nil {
+			t.Fatalf("handlerBrowse: %v", err)
+		}
+	})
+	// highlighted by a filter rule
+	if !strings.Contains(out, "! Older") || !strings.Contains(out, "No more posts.") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	if err := handlerBrowse(s, command{name: "browse", arguments: []string{"--page", "0"}}, user); err == nil {
+		t.Fatalf("expected error for page 0")
+	}
+	if err := handlerBrowse(s, command{name: "browse", arguments: []string{"--since", "whenever"}}, user); err == nil {
+		t.Fatalf("expected error for invalid date")
+	}
+	for _, args := range [][]string{{"5", "--all"}, {"0"}, {"-3"}, {"many"}} {
+		if err := handlerBrowse(s, command{name: "browse", arguments: args}, user); err == nil || !strings.Contains(err.Error(), "usage: browse") {
+			t.Errorf("browse %v: expected a usage error, got %v", args, err)
+		}
+	}
+}
+
+func TestHandlerMarkRead(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	postID, feedID := uuid.New(), uuid.New()
+	now := time.Now()
+
+	// by post ID, in a followed feed
+	mock.ExpectQuery(`(?i)SELECT p.id\s+FROM posts p\s+JOIN feed_follows`).
+		WithArgs(user.ID, postID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(postID))
+	mock.ExpectExec(`(?i)INSERT INTO user_post_state`).
+		WithArgs(user.ID, postID, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// by post URL
+	mock.ExpectQuery(`(?i)SELECT .+ FROM posts p\s+JOIN feed_follows`).
+		WithArgs(user.ID, "https://example.com/post").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "title", "url", "description", "published_at", "feed_id", "guid", "search_vector", "author", "categories", "seq"}).
+			AddRow(postID, now, now, "Post", "https://example.com/post", nil, now, feedID, "g", nil, nil, "{}", int64(6)))
+	mock.ExpectExec(`(?i)INSERT INTO user_post_state`).
+		WithArgs(user.ID, postID, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// whole feed, when followed
+	mock.ExpectQuery(`(?i)FROM feeds f\s+JOIN feed_follows ff .+ f.url`).
+		WithArgs(user.ID, "https://example.com/feed").
+		WillReturnRows(feedRows(feedID, now, "example", "https://example.com/feed", user.ID))
+	mock.ExpectExec(`(?i)INSERT INTO user_post_state .+ JOIN feed_follows ff .+ p.feed_id`).
+		WithArgs(user.ID, feedID).
+		WillReturnResult(sqlmock.NewResult(0, 7))
+	// everything before a date
+	mock.ExpectExec(`(?i)INSERT INTO user_post_state .+ p.published_at <`).
+		WithArgs(user.ID, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	out := captureStdout(t, func() {
+		for _, args := range [][]string{
+			{postID.String()},
+			{"https://example.com/post"},
+			{"--feed", "https://example.com/feed"},
+			{"--before", "2024-01-31"},
+		} {
+			if err := handlerMarkRead(s, command{name: "markread", arguments: args}, user); err != nil {
+				t.Fatalf("handlerMarkRead %v: %v", args, err)
+			}
+		}
+	})
+	if !strings.Contains(out, "Marked 7 posts from example read.") || !strings.Contains(out, "Marked 3 posts published before 2024-01-31 read.") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	if err := handlerMarkRead(s, command{name: "markread", arguments: []string{"--feed", "x", "--before", "2024-01-01"}}, user); err == nil {
+		t.Fatalf("expected error when combining --feed and --before")
+	}
+
+	// a feed the user does not follow
+	mock.ExpectQuery(`(?i)FROM feeds f\s+JOIN feed_follows ff .+ f.url`).
+		WithArgs(user.ID, "https://example.com/other").
+		WillReturnError(sql.ErrNoRows)
+	err := handlerMarkRead(s, command{name: "markread", arguments: []string{"--feed", "https://example.com/other"}}, user)
+	if err == nil || !strings.Contains(err.Error(), "you do not follow https://example.com/other") {
+		t.Fatalf("expected a not-followed error, got %v", err)
+	}
+}
+
+func TestHandlerMarkUnread_UnknownPost(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	mock.ExpectQuery(`(?i)SELECT .+ FROM posts p\s+JOIN feed_follows`).WillReturnError(sql.ErrNoRows)
+
+	if err := handlerMarkUnread(s, command{name: "markunread", arguments: []string{"https://example.com/missing"}}, user); err == nil {
+		t.Fatalf("expected error for unknown post")
+	}
+}
+
+func TestHandlerStar_PostNotFollowed(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	postID := uuid.New()
+	// the post exists, but not in a feed bob follows: no user_post_state row
+	mock.ExpectQuery(`(?i)SELECT p.id\s+FROM posts p\s+JOIN feed_follows`).
+		WithArgs(user.ID, postID).
+		WillReturnError(sql.ErrNoRows)
+
+	err := handlerStar(s, command{name: "star", arguments: []string{postID.String()}}, user)
+	if err == nil || !strings.Contains(err.Error(), "in your feeds") {
+		t.Fatalf("expected not-in-your-feeds error, got %v", err)
+	}
+}
+
+func TestHandlerStarNoteAndStarred(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	postID := uuid.New()
+	now := time.Now()
+
+	expectFollowedPost := func() {
+		mock.ExpectQuery(`(?i)SELECT p.id\s+FROM posts p\s+JOIN feed_follows`).
+			WithArgs(user.ID, postID).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(postID))
+	}
+
+	expectFollowedPost()
+	mock.ExpectExec(`(?i)INSERT INTO user_post_state .+starred`).
+		WithArgs(user.ID, postID, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectFollowedPost()
+	mock.ExpectExec(`(?i)INSERT INTO user_post_state .+note`).
+		WithArgs(user.ID, postID, sql.NullString{String: "read this again", Valid: true}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`(?i)SELECT .+ FROM user_post_state ups`).
+		WithArgs(user.ID, int32(20), int32(0)).
+		WillReturnRows(sqlmock.NewRows(append(postStateColumns, "note")).
+			AddRow(postID, now, now, "Keeper", "https://example.com/keeper", nil, now, uuid.New(), "g", nil, nil, "{}", int64(5), true, "read this again"))
+	expectFollowedPost()
+	mock.ExpectExec(`(?i)INSERT INTO user_post_state .+starred`).
+		WithArgs(user.ID, postID, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	out := captureStdout(t, func() {
+		if err := handlerStar(s, command{name: "star", arguments: []string{postID.String()}}, user); err != nil {
+			t.Fatalf("handlerStar: %v", err)
+		}
+		if err := handlerNote(s, command{name: "note", arguments: []string{postID.String(), "read", "this", "again"}}, user); err != nil {
+			t.Fatalf("handlerNote: %v", err)
+		}
+		if err := handlerStarred(s, command{name: "starred"}, user); err != nil {
+			t.Fatalf("handlerStarred: %v", err)
+		}
+		if err := handlerUnstar(s, command{name: "unstar", arguments: []string{postID.String()}}, user); err != nil {
+			t.Fatalf("handlerUnstar: %v", err)
+		}
+	})
+
+	for _, want := range []string{"Post starred.", "Note saved.", "  Keeper", "Note: read this again", "Post unstarred."} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output: %s", want, out)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestHandlerSearch(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	now := time.Now()
+	mock.ExpectQuery(`(?i)SELECT .+ FROM posts p\s+JOIN feed_follows .+websearch_to_tsquery`).
+		WithArgs(user.ID, `"go generics" -rust`,
+			sql.NullString{String: "golang", Valid: true},
+			sql.NullTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+			sql.NullTime{},
+			int32(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "url", "published_at", "feed_name", "read", "rank"}).
+			AddRow(uuid.New(), "Generics in Go", "https://example.com/generics", now, "golang", false, float32(0.6)))
+
+	out := captureStdout(t, func() {
+		args := []string{"--feed", "golang", "--since", "2024-01-01", "--limit", "5", `"go generics"`, "-rust"}
+		if err := handlerSearch(s, command{name: "search", arguments: args}, user); err != nil {
+			t.Fatalf("handlerSearch: %v", err)
+		}
+	})
+	if !strings.Contains(out, "* Generics in Go") || !strings.Contains(out, "Feed: golang") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	if err := handlerSearch(s, command{name: "search"}, user); err == nil {
+		t.Fatalf("expected error without a query")
+	}
+	if err := handlerSearch(s, command{name: "search", arguments: []string{"--since", "someday", "go"}}, user); err == nil {
+		t.Fatalf("expected error for invalid date")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+)
+
+func TestHandlerPublish(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	now := time.Now()
+	mock.ExpectQuery(`(?i)FROM posts p\s+JOIN feed_follows`).
+		WithArgs(user.ID, sql.NullString{}, sql.NullString{String: "xkcd", Valid: true}, true, false, false, int32(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "url", "description", "author", "categories", "published_at", "updated_at", "feed_name", "feed_url"}).
+			AddRow(uuid.New(), "Comic", "https://xkcd.com/1", nil, nil, "{}", now, now, "xkcd", "https://xkcd.com/rss.xml"))
+
+	out := filepath.Join(t.TempDir(), "bob.rss")
+	stdout := captureStdout(t, func() {
+		args := []string{"--format", "rss", "--feed", "xkcd", "--only", "highlighted", "--limit", "5", "--self", "https://example.org/bob.rss", "--output", out}
+		if err := handlerPublish(s, command{name: "publish", arguments: args}, user); err != nil {
+			t.Fatalf("handlerPublish: %v", err)
+		}
+	})
+	if !strings.Contains(stdout, "Published 1 posts to "+out) {
+		t.Errorf("unexpected output: %s", stdout)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read output: %v", err)
+	}
+	if !strings.Contains(string(b), `<rss version="2.0"`) || !strings.Contains(string(b), "<title>Comic</title>") ||
+		!strings.Contains(string(b), "<link>https://example.org/bob.rss</link>") {
+		t.Errorf("unexpected feed:\n%s", b)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"--format", "json"},
+		{"--format", "rss"},
+		{"--only", "spam"},
+		{"--limit", "0"},
+		{"extra"},
+	} {
+		if err := handlerPublish(s, command{name: "publish", arguments: args}, user); err == nil {
+			t.Errorf("expected error for publish %v", args)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+)
+
+func TestHandlerPurge(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+	s.config.RetentionDays = 30
+	s.config.RetentionMaxPosts = 200
+
+	mock.ExpectQuery(`(?i)DELETE FROM posts`).
+		WithArgs(int32(30), int32(200), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"feed_name", "deleted"}).AddRow("xkcd", int64(7)))
+
+	out := captureStdout(t, func() {
+		if err := handlerPurge(s, command{name: "purge"}); err != nil {
+			t.Fatalf("handlerPurge: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Purged 7 posts from xkcd") || !strings.Contains(out, "Purged 7 posts.") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+}
+
+func TestHandlerRetention(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+	s.config.RetentionDays = 90
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	feedID := uuid.New()
+	now := time.Now()
+	feedURL := "https://example.com/feed"
+
+	withRetention := func(days, maxPosts driver.Value) *sqlmock.Rows {
+		values := []driver.Value{feedID, now, nil, now, "example", feedURL, user.ID}
+		for _, col := range feedColumns[len(values):] {
+			values = append(values, feedColumnDefaults[col])
+		}
+		values[len(values)-3], values[len(values)-2] = days, maxPosts
+		return sqlmock.NewRows(feedColumns).AddRow(values...)
+	}
+
+	// only --max-posts given: the feed's age limit is left alone
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds\s+where url`).
+		WithArgs(feedURL).
+		WillReturnRows(withRetention(nil, nil))
+	mock.ExpectQuery(`(?i)UPDATE feeds\s+SET retention_days`).
+		WithArgs(feedID, sql.NullInt32{}, sql.NullInt32{Int32: 50, Valid: true}).
+		WillReturnRows(withRetention(nil, 50))
+	// --default clears both overrides
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds\s+where url`).
+		WithArgs(feedURL).
+		WillReturnRows(withRetention(0, 50))
+	mock.ExpectQuery(`(?i)UPDATE feeds\s+SET retention_days`).
+		WithArgs(feedID, sql.NullInt32{}, sql.NullInt32{}).
+		WillReturnRows(withRetention(nil, nil))
+
+	var outs []string
+	for _, args := range [][]string{
+		{"--max-posts", "50", feedURL},
+		{"--default", feedURL},
+	} {
+		outs = append(outs, captureStdout(t, func() {
+			if err := handlerRetention(s, command{name: "retention", arguments: args}, user); err != nil {
+				t.Fatalf("handlerRetention %v: %v", args, err)
+			}
+		}))
+	}
+	if !strings.Contains(outs[0], "Max age:   90 days (default)") || !strings.Contains(outs[0], "Max posts: 50 posts (feed)") {
+		t.Errorf("unexpected output: %s", outs[0])
+	}
+	if !strings.Contains(outs[1], "Max posts: unlimited (default)") {
+		t.Errorf("unexpected output: %s", outs[1])
+	}
+	// a follower who did not add the feed can see the policy but not change it
+	other := database.User{ID: uuid.New(), Name: "carol"}
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds\s+where url`).
+		WithArgs(feedURL).
+		WillReturnRows(withRetention(nil, nil))
+	if err := handlerRetention(s, command{name: "retention", arguments: []string{"--days", "1", feedURL}}, other); err == nil || !strings.Contains(err.Error(), "only the user who added example") {
+		t.Errorf("expected an ownership error, got %v", err)
+	}
+	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds\s+where url`).
+		WithArgs(feedURL).
+		WillReturnRows(withRetention(nil, nil))
+	out := captureStdout(t, func() {
+		if err := handlerRetention(s, command{name: "retention", arguments: []string{feedURL}}, other); err != nil {
+			t.Errorf("showing retention: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Max age:   90 days (default)") {
+		t.Errorf("unexpected output: %s", out)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"--days", "-1", feedURL},
+		{"--default", "--days", "3", feedURL},
+		{},
+	} {
+		if err := handlerRetention(s, command{name: "retention", arguments: args}, user); err == nil {
+			t.Errorf("expected error for retention %v", args)
+		}
+	}
+}
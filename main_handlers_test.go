@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql/driver"
 	"os"
 	"strings"
 	"testing"
@@ -38,6 +39,22 @@ func makeStateWithMock(t *testing.T) (*state, sqlmock.Sqlmock, func()) {
 	return s, mock, cleanup
 }
 
+// feedColumns lists the columns of the feeds table in schema order.
+var feedColumns = []string{"id", "created_at", "last_fetched_at", "updated_at", "name", "url", "user_id", "etag", "last_modified", "claimed_until", "claimed_by", "fetch_interval_seconds", "next_fetch_at", "consecutive_failures", "last_error", "last_status", "last_success_at", "disabled_at", "retention_days", "retention_max_posts", "seq"}
+
+// feedColumnDefaults holds values for NOT NULL feed columns after user_id.
+var feedColumnDefaults = map[string]driver.Value{"fetch_interval_seconds": 600, "consecutive_failures": 0, "seq": int64(1)}
+
+// feedRows returns sqlmock rows holding a single feed. Columns after user_id
+// take their default, or NULL.
+func feedRows(id uuid.UUID, now time.Time, name, url string, userID uuid.UUID) *sqlmock.Rows {
+	values := []driver.Value{id, now, nil, now, name, url, userID}
+	for _, col := range feedColumns[len(values):] {
+		values = append(values, feedColumnDefaults[col])
+	}
+	return sqlmock.NewRows(feedColumns).AddRow(values...)
+}
+
 // captureStdout captures stdout during fn execution and returns the output.
 func captureStdout(t *testing.T, fn func()) string {
 	t.Helper()
@@ -175,8 +192,7 @@ func TestHandlerAddFeed(t *testing.T) {
 
 	// CreateFeeds INSERT
 	mock.ExpectQuery(`INSERT INTO feeds`).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "last_fetched_at", "updated_at", "name", "url", "user_id"}).
-			AddRow(fid, now, nil, now, "f1", "https://example.com/feed", uid))
+		WillReturnRows(feedRows(fid, now, "f1", "https://example.com/feed", uid))
 
 	// CreateFeedFollow (WITH inserted AS ...)
 	mock.ExpectQuery(`WITH inserted AS`).
@@ -211,8 +227,7 @@ func TestHandlerFollow(t *testing.T) {
 
 	// GetFeedByURL
 	mock.ExpectQuery(`(?i)SELECT .+ FROM feeds WHERE url`).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "last_fetched_at", "updated_at", "name", "url", "user_id"}).
-			AddRow(fid, now, nil, now, "feed1", "https://example.com/feed", uid))
+		WillReturnRows(feedRows(fid, now, "feed1", "https://example.com/feed", uid))
 
 	// CreateFeedFollow (WITH inserted AS ...)
 	mock.ExpectQuery(`WITH inserted AS`).
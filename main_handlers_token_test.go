@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+)
+
+func TestHandlerToken_CreateListRevoke(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	tokenID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(`(?i)INSERT INTO api_tokens`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), user.ID, "phone", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "user_id", "name", "token_hash", "last_used_at"}).
+			AddRow(tokenID, now, user.ID, "phone", "hash", nil))
+	mock.ExpectQuery(`(?i)SELECT .+ FROM api_tokens`).
+		WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "name", "last_used_at"}).
+			AddRow(tokenID, now, "phone", nil))
+	mock.ExpectExec(`(?i)DELETE FROM api_tokens`).
+		WithArgs(tokenID, user.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	out := captureStdout(t, func() {
+		for _, args := range [][]string{
+			{"create", "phone"},
+			{"list"},
+			{"revoke", tokenID.String()},
+		} {
+			if err := handlerToken(s, command{name: "token", arguments: args}, user); err != nil {
+				t.Fatalf("handlerToken %v: %v", args, err)
+			}
+		}
+	})
+	if !strings.Contains(out, "Created token "+tokenID.String()+" (phone) for bob") ||
+		!strings.Contains(out, "phone  created "+now.Format("2006-01-02")+", never used") ||
+		!strings.Contains(out, "Revoked token "+tokenID.String()) {
+		t.Fatalf("unexpected output: %s", out)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	mock.ExpectExec(`(?i)DELETE FROM api_tokens`).
+		WithArgs(tokenID, user.ID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, args := range [][]string{
+		{"revoke", tokenID.String()},
+		{"revoke", "nope"},
+		{"bogus"},
+		{},
+	} {
+		if err := handlerToken(s, command{name: "token", arguments: args}, user); err == nil {
+			t.Errorf("expected error for token %v", args)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/markcromwell/gator/internal/database"
+)
+
+var webhookColumns = []string{"id", "created_at", "user_id", "url", "secret", "feed_id", "keyword"}
+
+func TestHandlerWebhook(t *testing.T) {
+	s, mock, cleanup := makeStateWithMock(t)
+	defer cleanup()
+
+	user := database.User{ID: uuid.New(), Name: "bob"}
+	feedID, hookID := uuid.New(), uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(`(?i)FROM feeds f\s+JOIN feed_follows ff .+ f.url`).
+		WithArgs(user.ID, "https://example.com/feed").
+		WillReturnRows(feedRows(feedID, now, "example", "https://example.com/feed", user.ID))
+	mock.ExpectQuery(`(?i)INSERT INTO webhooks`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), user.ID, "https://hooks.example.com/gator",
+			sql.NullString{String: "s3cret", Valid: true}, uuid.NullUUID{UUID: feedID, Valid: true}, sql.NullString{String: "release", Valid: true}).
+		WillReturnRows(sqlmock.NewRows(webhookColumns).
+			AddRow(hookID, now, user.ID, "https://hooks.example.com/gator", "s3cret", feedID, "release"))
+	mock.ExpectQuery(`(?i)FROM webhooks w\s+LEFT JOIN feeds`).
+		WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows(append(webhookColumns, "feed_name")).
+			AddRow(hookID, now, user.ID, "https://hooks.example.com/gator", "s3cret", feedID, "release", "example"))
+	mock.ExpectQuery(`(?i)FROM webhook_deliveries d`).
+		WithArgs(user.ID, true, int32(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "webhook_id", "webhook_url", "post_title", "attempts", "status_code", "error", "succeeded"}).
+			AddRow(uuid.New(), now, hookID, "https://hooks.example.com/gator", "Go 1.23", int32(3), int32(502), "HTTP 502 Bad Gateway", false))
+	mock.ExpectExec(`(?i)DELETE FROM webhooks`).
+		WithArgs(hookID, user.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	out := captureStdout(t, func() {
+		for _, args := range [][]string{
+			{"add", "--secret", "s3cret", "--feed", "https://example.com/feed", "--keyword", "release", "https://hooks.example.com/gator"},
+			{"list"},
+			{"log", "--failed", "--limit", "5"},
+			{"delete", hookID.String()},
+		} {
+			if err := handlerWebhook(s, command{name: "webhook", arguments: args}, user); err != nil {
+				t.Fatalf("handlerWebhook %v: %v", args, err)
+			}
+		}
+	})
+	for _, want := range []string{
+		"Added webhook " + hookID.String(),
+		`https://hooks.example.com/gator (example, keyword "release", signed)`,
+		`"Go 1.23"  3 attempts  FAILED: HTTP 502 Bad Gateway`,
+		"Deleted webhook " + hookID.String(),
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "s3cret") {
+		t.Errorf("secret leaked into output:\n%s", out)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"add"},
+		{"add", "ftp://example.com"},
+		{"list", "x"},
+		{"delete", "not-a-uuid"},
+		{"log", "--limit", "0"},
+		{"bogus"},
+	} {
+		if err := handlerWebhook(s, command{name: "webhook", arguments: args}, user); err == nil {
+			t.Errorf("expected error for webhook %v", args)
+		}
+	}
+
+	// a feed the user does not follow
+	mock.ExpectQuery(`(?i)FROM feeds f\s+JOIN feed_follows ff .+ f.url`).
+		WithArgs(user.ID, "https://example.com/other").
+		WillReturnError(sql.ErrNoRows)
+	err := handlerWebhook(s, command{name: "webhook", arguments: []string{"add", "--feed", "https://example.com/other", "https://hooks.example.com/gator"}}, user)
+	if err == nil || !strings.Contains(err.Error(), "you do not follow https://example.com/other") {
+		t.Fatalf("expected a not-followed error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
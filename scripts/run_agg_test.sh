@@ -19,6 +19,9 @@ if [ ! -f ./gator ]; then
   go build -o gator .
 fi
 
+# bring the schema up to date
+./gator migrate up
+
 # register and login (ignore failures so script continues)
 ./gator register testuser || true
 ./gator login testuser || true
@@ -0,0 +1,26 @@
+-- name: CreateAPIToken :one
+INSERT INTO api_tokens (id, created_at, user_id, name, token_hash)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetUserByAPIToken :one
+-- the user a token belongs to; records that the token was used
+WITH used AS (
+    UPDATE api_tokens
+    SET last_used_at = CURRENT_TIMESTAMP
+    WHERE token_hash = $1
+    RETURNING user_id
+)
+SELECT users.*
+FROM users
+JOIN used ON used.user_id = users.id;
+
+-- name: GetAPITokensForUser :many
+SELECT id, created_at, name, last_used_at
+FROM api_tokens
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: DeleteAPIToken :execrows
+DELETE FROM api_tokens
+WHERE id = $1 AND user_id = $2;
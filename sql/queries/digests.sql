@@ -0,0 +1,36 @@
+-- name: SetDigestSubscription :exec
+-- subscribe the user or change their address. A new subscription starts
+-- after the newest stored post, so the first digest is not every old post.
+INSERT INTO digest_subscriptions (user_id, created_at, email, last_seq)
+VALUES ($1, $2, $3, (SELECT COALESCE(MAX(seq), 0)::bigint FROM posts))
+ON CONFLICT (user_id) DO UPDATE
+SET email = EXCLUDED.email;
+
+-- name: DeleteDigestSubscription :execrows
+DELETE FROM digest_subscriptions
+WHERE user_id = $1;
+
+-- name: GetDigestSubscriptions :many
+SELECT ds.user_id, u.name, ds.email, ds.last_seq, ds.last_sent_at
+FROM digest_subscriptions ds
+JOIN users u ON u.id = ds.user_id
+ORDER BY u.name;
+
+-- name: GetDigestPosts :many
+-- up to limit unread, unmuted posts of the user's followed feeds stored
+-- after the watermark, oldest first
+SELECT p.seq, p.title, p.url, p.published_at, f.name AS feed_name, f.url AS feed_url
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id AND ff.user_id = sqlc.arg(user_id)
+JOIN feeds f ON f.id = p.feed_id
+LEFT JOIN user_post_state ups ON ups.post_id = p.id AND ups.user_id = sqlc.arg(user_id)
+WHERE p.seq > sqlc.arg(after_seq)
+  AND ups.read IS NOT TRUE
+  AND ups.muted IS NOT TRUE
+ORDER BY p.seq
+LIMIT sqlc.arg('limit');
+
+-- name: MarkDigestSent :exec
+UPDATE digest_subscriptions
+SET last_seq = $2, last_sent_at = $3
+WHERE user_id = $1;
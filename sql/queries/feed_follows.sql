@@ -48,4 +48,42 @@ DELETE FROM feed_follows;
 DELETE FROM feed_follows
 WHERE feed_id = $1 AND user_id = $2;
 
+-- name: UpsertFeedFollow :one
+-- follow a feed, or move an existing follow to folder; inserted is false when
+-- the user already followed the feed
+INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id, folder)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (user_id, feed_id) DO UPDATE
+SET folder = EXCLUDED.folder, updated_at = EXCLUDED.updated_at
+RETURNING id, (xmax = 0) AS inserted;
 
+-- name: GetFollowedFeedsForExport :many
+-- every feed a user follows with its folder, grouped by folder
+SELECT f.name, f.url, ff.folder
+FROM feed_follows ff
+JOIN feeds f ON ff.feed_id = f.id
+WHERE ff.user_id = $1
+ORDER BY ff.folder NULLS FIRST, f.name;
+
+-- name: GetFollowedFeeds :many
+-- the feeds a user follows, by name
+SELECT f.*
+FROM feeds f
+JOIN feed_follows ff ON ff.feed_id = f.id
+WHERE ff.user_id = $1
+ORDER BY f.name
+LIMIT $2 OFFSET $3;
+
+-- name: GetFollowedFeedByID :one
+-- the feed with this ID when the user follows it
+SELECT f.*
+FROM feeds f
+JOIN feed_follows ff ON ff.feed_id = f.id
+WHERE ff.user_id = $1 AND f.id = $2;
+
+-- name: GetFollowedFeedByURL :one
+-- the feed with this URL when the user follows it
+SELECT f.*
+FROM feeds f
+JOIN feed_follows ff ON ff.feed_id = f.id
+WHERE ff.user_id = $1 AND f.url = $2;
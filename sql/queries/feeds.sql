@@ -27,15 +27,110 @@ DELETE FROM feeds
 WHERE id = $1 AND user_id = $2;
 
 -- name: MarkFeedFetched :exec
--- set last_fetched_at and updated_at to current timestamp
+-- set last_fetched_at and updated_at to current timestamp, schedule the next
+-- fetch one interval from now, and release any claim
 UPDATE feeds
-SET last_fetched_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+SET last_fetched_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP,
+    next_fetch_at = CURRENT_TIMESTAMP + make_interval(secs => fetch_interval_seconds),
+    claimed_until = NULL, claimed_by = NULL
 WHERE id = $1;
 
--- name: GetNextFeedToFetch :one
+-- name: UpdateFeedValidators :exec
+-- store the HTTP cache validators from the last successful fetch
+UPDATE feeds
+SET etag = $2, last_modified = $3, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: ClaimFeed :one
+-- lease one enabled feed to a scraper, due or not, unless another scraper
+-- holds it
+UPDATE feeds
+SET claimed_until = NOW() + make_interval(secs => sqlc.arg(lease_seconds)::int),
+    claimed_by = sqlc.arg(claimed_by)
+WHERE id = sqlc.arg(id)
+  AND (claimed_until IS NULL OR claimed_until < NOW())
+  AND disabled_at IS NULL
+RETURNING *;
+
+-- name: ClaimFeedsToFetch :many
+-- Atomically lease up to batch_size due feeds to one scraper. Rows locked by
+-- a concurrent claim are skipped rather than waited on, and leases that have
+-- expired (a crashed scraper) are claimable again.
+UPDATE feeds
+SET claimed_until = NOW() + make_interval(secs => sqlc.arg(lease_seconds)::int),
+    claimed_by = sqlc.arg(claimed_by)
+WHERE id IN (
+    SELECT id
+    FROM feeds
+    WHERE (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+      AND (claimed_until IS NULL OR claimed_until < NOW())
+      AND disabled_at IS NULL
+    ORDER BY next_fetch_at ASC NULLS FIRST
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: ScheduleFeed :exec
+-- store the adapted polling interval and when the feed is next due
+UPDATE feeds
+SET fetch_interval_seconds = $2, next_fetch_at = $3
+WHERE id = $1;
+
+-- name: ReleaseFeedClaims :exec
+-- give back every lease a scraper still holds, e.g. on shutdown
+UPDATE feeds
+SET claimed_until = NULL, claimed_by = NULL
+WHERE claimed_by = $1;
+
+-- name: RecordFeedSuccess :exec
+-- reset the failure count after a successful fetch
+UPDATE feeds
+SET consecutive_failures = 0, last_error = NULL, last_status = $2,
+    last_success_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: RecordFeedFailure :one
+-- count a failed fetch, back the feed off until next_fetch_at, and disable it
+-- once it has failed disable_after times in a row
+UPDATE feeds
+SET consecutive_failures = consecutive_failures + 1,
+    last_error = sqlc.arg(last_error),
+    last_status = sqlc.arg(last_status),
+    next_fetch_at = sqlc.arg(next_fetch_at),
+    disabled_at = CASE
+        WHEN consecutive_failures + 1 >= sqlc.arg(disable_after)::int THEN CURRENT_TIMESTAMP
+        ELSE disabled_at
+    END,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id)
+RETURNING consecutive_failures, disabled_at;
+
+-- name: GetUnhealthyFeeds :many
+-- feeds whose last fetch failed or that have been disabled, disabled first
 SELECT *
 FROM feeds
-WHERE last_fetched_at IS NULL
-	OR last_fetched_at <= NOW() - INTERVAL '10 minutes'
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1;
+WHERE consecutive_failures > 0 OR disabled_at IS NOT NULL
+ORDER BY disabled_at IS NULL, consecutive_failures DESC, name;
+
+-- name: EnableFeedByURL :one
+-- re-enable a feed, clear its failure record and make it due immediately
+UPDATE feeds
+SET disabled_at = NULL, consecutive_failures = 0, last_error = NULL,
+    next_fetch_at = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE url = $1
+RETURNING *;
+
+-- name: SetFeedRetention :one
+-- override the retention policy for one feed; NULL falls back to the config
+UPDATE feeds
+SET retention_days = $2, retention_max_posts = $3, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: GetActiveFeeds :many
+-- every feed that is not disabled, by name
+SELECT name, url
+FROM feeds
+WHERE disabled_at IS NULL
+ORDER BY name;
@@ -0,0 +1,88 @@
+-- name: SetFeverAPIKey :exec
+-- set or replace the user's Fever API key
+INSERT INTO fever_credentials (user_id, created_at, api_key)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE
+SET api_key = EXCLUDED.api_key, created_at = EXCLUDED.created_at;
+
+-- name: DeleteFeverAPIKey :execrows
+DELETE FROM fever_credentials
+WHERE user_id = $1;
+
+-- name: GetUserByFeverAPIKey :one
+SELECT users.*
+FROM users
+JOIN fever_credentials fc ON fc.user_id = users.id
+WHERE fc.api_key = $1;
+
+-- name: GetFeverFeeds :many
+-- the user's followed feeds with their folder, by name
+SELECT f.seq, f.name, f.url, ff.folder, f.last_fetched_at
+FROM feed_follows ff
+JOIN feeds f ON f.id = ff.feed_id
+WHERE ff.user_id = $1
+ORDER BY f.name;
+
+-- name: GetFeverItems :many
+-- up to limit unmuted posts of the user's followed feeds: after since_id in
+-- ascending order, or before max_id in descending order, or those in with_ids
+SELECT p.seq, f.seq AS feed_seq, p.title, p.author, p.description, p.url, p.published_at,
+    COALESCE(ups.read, FALSE)::bool AS read,
+    COALESCE(ups.starred, FALSE)::bool AS starred
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id AND ff.user_id = sqlc.arg(user_id)
+JOIN feeds f ON f.id = p.feed_id
+LEFT JOIN user_post_state ups ON ups.post_id = p.id AND ups.user_id = sqlc.arg(user_id)
+WHERE ups.muted IS NOT TRUE
+  AND (sqlc.narg(since_id)::bigint IS NULL OR p.seq > sqlc.narg(since_id))
+  AND (sqlc.narg(max_id)::bigint IS NULL OR p.seq < sqlc.narg(max_id))
+  AND (sqlc.narg(with_ids)::bigint[] IS NULL OR p.seq = ANY(sqlc.narg(with_ids)::bigint[]))
+ORDER BY CASE WHEN sqlc.narg(max_id)::bigint IS NULL THEN p.seq END, p.seq DESC
+LIMIT sqlc.arg('limit');
+
+-- name: CountFeverItems :one
+-- how many unmuted posts the user's followed feeds hold
+SELECT COUNT(*)
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id AND ff.user_id = $1
+LEFT JOIN user_post_state ups ON ups.post_id = p.id AND ups.user_id = $1
+WHERE ups.muted IS NOT TRUE;
+
+-- name: GetFeverUnreadItemIDs :many
+SELECT p.seq
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id AND ff.user_id = $1
+LEFT JOIN user_post_state ups ON ups.post_id = p.id AND ups.user_id = $1
+WHERE ups.read IS NOT TRUE AND ups.muted IS NOT TRUE
+ORDER BY p.seq;
+
+-- name: GetFeverSavedItemIDs :many
+SELECT p.seq
+FROM user_post_state ups
+JOIN posts p ON p.id = ups.post_id
+WHERE ups.user_id = $1 AND ups.starred
+ORDER BY p.seq;
+
+-- name: GetPostIDBySeqForUser :one
+-- the ID of the post with this Fever item ID when it is in a feed the user
+-- follows
+SELECT p.id
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = $1 AND p.seq = $2;
+
+-- name: MarkFeedsReadBefore :execrows
+-- mark posts stored before a time read, in one followed feed (feed_seq), in
+-- one folder, or in every followed feed; returns how many were unread
+INSERT INTO user_post_state (user_id, post_id, read, read_at)
+SELECT ff.user_id, p.id, TRUE, CURRENT_TIMESTAMP
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id
+JOIN feeds f ON f.id = p.feed_id
+WHERE ff.user_id = sqlc.arg(user_id)
+  AND (sqlc.narg(feed_seq)::bigint IS NULL OR f.seq = sqlc.narg(feed_seq))
+  AND (sqlc.narg(folder)::text IS NULL OR ff.folder = sqlc.narg(folder))
+  AND p.created_at < sqlc.arg(before)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE, read_at = EXCLUDED.read_at
+WHERE NOT user_post_state.read;
@@ -0,0 +1,26 @@
+-- name: CreateFilterRule :one
+INSERT INTO filter_rules (id, created_at, user_id, feed_id, field, pattern, is_regex, action)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: GetFilterRulesForUser :many
+-- the user's rules in the order they were added, with the name of the feed
+-- a rule is scoped to
+SELECT r.*, f.name AS feed_name
+FROM filter_rules r
+LEFT JOIN feeds f ON f.id = r.feed_id
+WHERE r.user_id = $1
+ORDER BY r.created_at;
+
+-- name: GetFilterRulesForFeed :many
+-- the rules that apply to new posts of a feed: those of every user following
+-- it that are unscoped or scoped to this feed
+SELECT r.*
+FROM filter_rules r
+JOIN feed_follows ff ON ff.user_id = r.user_id AND ff.feed_id = sqlc.arg(feed_id)
+WHERE r.feed_id IS NULL OR r.feed_id = sqlc.arg(feed_id)
+ORDER BY r.user_id, r.created_at;
+
+-- name: DeleteFilterRule :execrows
+DELETE FROM filter_rules
+WHERE id = $1 AND user_id = $2;
@@ -0,0 +1,31 @@
+-- name: CreateNotifier :one
+INSERT INTO notifiers (id, created_at, user_id, kind, url, room_id, access_token, feed_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: GetNotifiersForUser :many
+-- the user's notifiers in the order they were added, with the name of the
+-- feed a notifier is scoped to
+SELECT n.*, f.name AS feed_name
+FROM notifiers n
+LEFT JOIN feeds f ON f.id = n.feed_id
+WHERE n.user_id = $1
+ORDER BY n.created_at;
+
+-- name: GetNotifierForUser :one
+SELECT *
+FROM notifiers
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetNotifiersForFeed :many
+-- the notifiers that fire for new posts of a feed: those of every user
+-- following it that are unscoped or scoped to this feed
+SELECT n.*
+FROM notifiers n
+JOIN feed_follows ff ON ff.user_id = n.user_id AND ff.feed_id = sqlc.arg(feed_id)
+WHERE n.feed_id IS NULL OR n.feed_id = sqlc.arg(feed_id)
+ORDER BY n.created_at;
+
+-- name: DeleteNotifier :execrows
+DELETE FROM notifiers
+WHERE id = $1 AND user_id = $2;
@@ -1,12 +1,155 @@
--- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-RETURNING *;    
+-- name: UpsertPost :one
+-- Insert a new post, or refresh it when the publisher has edited the title,
+-- link, description, author or categories. Returns no row when the stored
+-- post is unchanged or was purged by retention.
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, guid, author, categories)
+SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+WHERE NOT EXISTS (
+    SELECT 1 FROM purged_posts pp WHERE pp.feed_id = $8 AND pp.guid = $9
+)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    author = EXCLUDED.author,
+    categories = EXCLUDED.categories,
+    updated_at = EXCLUDED.updated_at
+WHERE posts.title IS DISTINCT FROM EXCLUDED.title
+    OR posts.url IS DISTINCT FROM EXCLUDED.url
+    OR posts.description IS DISTINCT FROM EXCLUDED.description
+    OR posts.author IS DISTINCT FROM EXCLUDED.author
+    OR posts.categories IS DISTINCT FROM EXCLUDED.categories
+RETURNING *, (xmax = 0) AS inserted;
 
 -- name: GetPostsForUser :many
+-- newest posts first from the feeds the user follows, with the user's read
+-- and highlight flags; read and muted posts are left out unless include_all
+-- is set. feed (a name or URL) and since narrow the listing.
+SELECT p.*, f.name AS feed_name,
+    COALESCE(ups.read, FALSE)::bool AS read,
+    COALESCE(ups.highlighted, FALSE)::bool AS highlighted
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id AND ff.user_id = sqlc.arg(user_id)
+JOIN feeds f ON f.id = p.feed_id
+LEFT JOIN user_post_state ups ON ups.post_id = p.id AND ups.user_id = sqlc.arg(user_id)
+WHERE (sqlc.arg(include_all)::bool OR (ups.read IS NOT TRUE AND ups.muted IS NOT TRUE))
+  AND (sqlc.narg(feed)::text IS NULL OR f.url = sqlc.narg(feed) OR f.name = sqlc.narg(feed))
+  AND (sqlc.narg(since)::timestamp IS NULL OR p.published_at >= sqlc.narg(since))
+ORDER BY p.published_at DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: GetTimelineForUser :many
+-- newest unmuted posts first from the feeds the user follows, for
+-- publishing. folder also matches its subfolders; feed is a name or URL;
+-- the *_only flags keep just highlighted, starred or unread posts.
+SELECT p.id, p.title, p.url, p.description, p.author, p.categories, p.published_at, p.updated_at,
+    f.name AS feed_name, f.url AS feed_url
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id AND ff.user_id = sqlc.arg(user_id)
+JOIN feeds f ON f.id = p.feed_id
+LEFT JOIN user_post_state ups ON ups.post_id = p.id AND ups.user_id = sqlc.arg(user_id)
+WHERE ups.muted IS NOT TRUE
+  AND (sqlc.narg(folder)::text IS NULL OR ff.folder = sqlc.narg(folder) OR ff.folder LIKE sqlc.narg(folder) || '/%')
+  AND (sqlc.narg(feed)::text IS NULL OR f.url = sqlc.narg(feed) OR f.name = sqlc.narg(feed))
+  AND (NOT sqlc.arg(highlighted_only)::bool OR ups.highlighted)
+  AND (NOT sqlc.arg(starred_only)::bool OR ups.starred)
+  AND (NOT sqlc.arg(unread_only)::bool OR ups.read IS NOT TRUE)
+ORDER BY p.published_at DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetRecentPosts :many
+-- newest posts first from every feed, for publishing a site shared by all
+-- users
+SELECT p.id, p.title, p.url, p.description, p.author, p.categories, p.published_at, p.updated_at,
+    f.name AS feed_name, f.url AS feed_url
+FROM posts p
+JOIN feeds f ON f.id = p.feed_id
+ORDER BY p.published_at DESC
+LIMIT $1;
+
+-- name: PurgePosts :many
+-- delete posts outside their feed's retention policy: published more than
+-- days ago, or older than the newest max_posts. A feed's own settings override
+-- the defaults and 0 means no limit. Starred posts are never deleted and do
+-- not count toward max_posts. Each deleted post is recorded in purged_posts so
+-- that UpsertPost does not store it again. Returns how many posts each feed
+-- lost.
+WITH policy AS (
+    SELECT f.id AS feed_id,
+        COALESCE(f.retention_days, sqlc.arg(default_days)::int) AS days,
+        COALESCE(f.retention_max_posts, sqlc.arg(default_max_posts)::int) AS max_posts
+    FROM feeds f
+),
+ranked AS (
+    SELECT p.id, p.published_at, pol.days, pol.max_posts,
+        row_number() OVER (PARTITION BY p.feed_id ORDER BY p.published_at DESC, p.id) AS position
+    FROM posts p
+    JOIN policy pol ON pol.feed_id = p.feed_id
+    WHERE (pol.days > 0 OR pol.max_posts > 0)
+      AND NOT EXISTS (
+          SELECT 1 FROM user_post_state ups WHERE ups.post_id = p.id AND ups.starred
+      )
+),
+deleted AS (
+    DELETE FROM posts
+    WHERE id IN (
+        SELECT r.id
+        FROM ranked r
+        WHERE (r.days > 0 AND r.published_at < sqlc.arg(now)::timestamp - make_interval(days => r.days))
+           OR (r.max_posts > 0 AND r.position > r.max_posts)
+    )
+    RETURNING feed_id, guid
+),
+tombstones AS (
+    INSERT INTO purged_posts (feed_id, guid, purged_at)
+    SELECT feed_id, guid, sqlc.arg(now)::timestamp FROM deleted
+    ON CONFLICT (feed_id, guid) DO NOTHING
+)
+SELECT f.name AS feed_name, COUNT(*) AS deleted
+FROM deleted d
+JOIN feeds f ON f.id = d.feed_id
+GROUP BY f.name
+ORDER BY f.name;
+
+-- name: GetFollowedPostsForFilter :many
+-- every post in the user's followed feeds, with the fields filter rules
+-- match on
+SELECT p.id, p.feed_id, p.title, p.description, p.author, p.categories
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = $1;
+
+-- name: GetPostIDForUser :one
+-- the post's ID when it is in a feed the user follows
+SELECT p.id
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = $1 AND p.id = $2;
+
+-- name: GetPostByURLForUser :one
+-- the newest post with this link in a feed the user follows
 SELECT p.*
 FROM posts p
-JOIN feeds f ON p.feed_id = f.id
-WHERE f.user_id = $1
+JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = $1 AND p.url = $2
 ORDER BY p.published_at DESC
-LIMIT $2 OFFSET $3;
+LIMIT 1;
+
+-- name: SearchPostsForUser :many
+-- rank posts in the user's followed feeds against a web-search style query
+-- ("phrases", -negation, OR), optionally limited to one feed (name or URL)
+-- and a published_at range
+SELECT p.id, p.title, p.url, p.published_at, f.name AS feed_name,
+    COALESCE(ups.read, FALSE)::bool AS read,
+    ts_rank(p.search_vector, q.query) AS rank
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id AND ff.user_id = sqlc.arg(user_id)
+JOIN feeds f ON f.id = p.feed_id
+CROSS JOIN websearch_to_tsquery('english', sqlc.arg(query)) AS q(query)
+LEFT JOIN user_post_state ups ON ups.post_id = p.id AND ups.user_id = sqlc.arg(user_id)
+WHERE p.search_vector @@ q.query
+  AND (sqlc.narg(feed)::text IS NULL OR f.url = sqlc.narg(feed) OR f.name = sqlc.narg(feed))
+  AND (sqlc.narg(since)::timestamp IS NULL OR p.published_at >= sqlc.narg(since))
+  AND (sqlc.narg(until)::timestamp IS NULL OR p.published_at < sqlc.narg(until))
+ORDER BY rank DESC, p.published_at DESC
+LIMIT sqlc.arg('limit');
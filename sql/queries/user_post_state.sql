@@ -0,0 +1,93 @@
+-- name: SetPostRead :exec
+-- mark one post read or unread for a user
+INSERT INTO user_post_state (user_id, post_id, read, read_at)
+VALUES (
+    sqlc.arg(user_id),
+    sqlc.arg(post_id),
+    sqlc.arg(read)::bool,
+    CASE WHEN sqlc.arg(read)::bool THEN CURRENT_TIMESTAMP END
+)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = EXCLUDED.read, read_at = EXCLUDED.read_at;
+
+-- name: MarkFeedRead :execrows
+-- mark every post of a feed the user follows read; returns how many were
+-- unread
+INSERT INTO user_post_state (user_id, post_id, read, read_at)
+SELECT ff.user_id, p.id, TRUE, CURRENT_TIMESTAMP
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = sqlc.arg(user_id) AND p.feed_id = sqlc.arg(feed_id)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE, read_at = EXCLUDED.read_at
+WHERE NOT user_post_state.read;
+
+-- name: MarkPostsReadBefore :execrows
+-- mark every post of the user's followed feeds published before a date
+-- read; returns how many were unread
+INSERT INTO user_post_state (user_id, post_id, read, read_at)
+SELECT ff.user_id, p.id, TRUE, CURRENT_TIMESTAMP
+FROM posts p
+JOIN feed_follows ff ON ff.feed_id = p.feed_id
+WHERE ff.user_id = sqlc.arg(user_id)
+  AND p.published_at < sqlc.arg(before)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE, read_at = EXCLUDED.read_at
+WHERE NOT user_post_state.read;
+
+-- name: SetPostStarred :exec
+-- star or unstar one post for a user
+INSERT INTO user_post_state (user_id, post_id, starred, starred_at)
+VALUES (
+    sqlc.arg(user_id),
+    sqlc.arg(post_id),
+    sqlc.arg(starred)::bool,
+    CASE WHEN sqlc.arg(starred)::bool THEN CURRENT_TIMESTAMP END
+)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET starred = EXCLUDED.starred, starred_at = EXCLUDED.starred_at;
+
+-- name: SetPostNote :exec
+-- attach a note to a post, or clear it with NULL
+INSERT INTO user_post_state (user_id, post_id, note)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET note = EXCLUDED.note;
+
+-- name: GetStarredPostsForUser :many
+-- the user's starred posts, most recently starred first
+SELECT p.*, ups.read, ups.note
+FROM user_post_state ups
+JOIN posts p ON p.id = ups.post_id
+WHERE ups.user_id = $1 AND ups.starred
+ORDER BY ups.starred_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: ApplyPostFilter :exec
+-- record what a user's filter rules decided for a post. muted and highlighted
+-- are replaced; read and starred are only ever turned on.
+INSERT INTO user_post_state (user_id, post_id, muted, highlighted, read, read_at, starred, starred_at)
+VALUES (
+    sqlc.arg(user_id),
+    sqlc.arg(post_id),
+    sqlc.arg(muted)::bool,
+    sqlc.arg(highlighted)::bool,
+    sqlc.arg(read)::bool,
+    CASE WHEN sqlc.arg(read)::bool THEN CURRENT_TIMESTAMP END,
+    sqlc.arg(starred)::bool,
+    CASE WHEN sqlc.arg(starred)::bool THEN CURRENT_TIMESTAMP END
+)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET muted = EXCLUDED.muted,
+    highlighted = EXCLUDED.highlighted,
+    read = user_post_state.read OR EXCLUDED.read,
+    read_at = CASE WHEN user_post_state.read THEN user_post_state.read_at ELSE EXCLUDED.read_at END,
+    starred = user_post_state.starred OR EXCLUDED.starred,
+    starred_at = CASE WHEN user_post_state.starred THEN user_post_state.starred_at ELSE EXCLUDED.starred_at END;
+
+-- name: ClearPostFilterFlags :exec
+-- forget which posts the user's filter rules muted or highlighted, before
+-- applying the rules again
+UPDATE user_post_state
+SET muted = FALSE, highlighted = FALSE
+WHERE user_id = $1 AND (muted OR highlighted);
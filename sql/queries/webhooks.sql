@@ -0,0 +1,42 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, user_id, url, secret, feed_id, keyword)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: GetWebhooksForUser :many
+-- the user's webhooks in the order they were added, with the name of the
+-- feed a webhook is scoped to
+SELECT w.*, f.name AS feed_name
+FROM webhooks w
+LEFT JOIN feeds f ON f.id = w.feed_id
+WHERE w.user_id = $1
+ORDER BY w.created_at;
+
+-- name: GetWebhooksForFeed :many
+-- the webhooks that fire for new posts of a feed: those of every user
+-- following it that are unscoped or scoped to this feed
+SELECT w.*
+FROM webhooks w
+JOIN feed_follows ff ON ff.user_id = w.user_id AND ff.feed_id = sqlc.arg(feed_id)
+WHERE w.feed_id IS NULL OR w.feed_id = sqlc.arg(feed_id)
+ORDER BY w.created_at;
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
+WHERE id = $1 AND user_id = $2;
+
+-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (id, created_at, webhook_id, post_id, attempts, status_code, error, succeeded)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+
+-- name: GetWebhookDeliveriesForUser :many
+-- the user's latest deliveries first, optionally only the failed ones
+SELECT d.id, d.created_at, d.webhook_id, w.url AS webhook_url, p.title AS post_title,
+    d.attempts, d.status_code, d.error, d.succeeded
+FROM webhook_deliveries d
+JOIN webhooks w ON w.id = d.webhook_id
+JOIN posts p ON p.id = d.post_id
+WHERE w.user_id = sqlc.arg(user_id)
+  AND (NOT sqlc.arg(failed_only)::bool OR NOT d.succeeded)
+ORDER BY d.created_at DESC
+LIMIT sqlc.arg('limit');
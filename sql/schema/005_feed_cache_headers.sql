@@ -0,0 +1,9 @@
+-- +goose Up
+-- HTTP cache validators from the last successful fetch, sent back as
+-- If-None-Match / If-Modified-Since so unchanged feeds return 304.
+ALTER TABLE feeds ADD COLUMN etag TEXT;
+ALTER TABLE feeds ADD COLUMN last_modified TEXT;
+
+-- +goose Down
+ALTER TABLE feeds DROP COLUMN last_modified;
+ALTER TABLE feeds DROP COLUMN etag;
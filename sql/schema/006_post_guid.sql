@@ -0,0 +1,17 @@
+-- +goose Up
+-- guid identifies a post within its feed (RSS <guid>, Atom <id>, JSON Feed
+-- id), falling back to the link. Posts are upserted on (feed_id, guid), so
+-- the same URL may now appear in more than one feed.
+ALTER TABLE posts ADD COLUMN guid TEXT;
+UPDATE posts SET guid = url WHERE guid IS NULL;
+ALTER TABLE posts ALTER COLUMN guid SET NOT NULL;
+ALTER TABLE posts DROP CONSTRAINT posts_url_key;
+CREATE UNIQUE INDEX posts_feed_id_guid_key ON posts (feed_id, guid);
+CREATE INDEX posts_url_idx ON posts (url);
+
+-- +goose Down
+DROP INDEX IF EXISTS posts_url_idx;
+DROP INDEX IF EXISTS posts_feed_id_guid_key;
+DELETE FROM posts a USING posts b WHERE a.url = b.url AND a.created_at > b.created_at;
+ALTER TABLE posts ADD CONSTRAINT posts_url_key UNIQUE (url);
+ALTER TABLE posts DROP COLUMN guid;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- A scraper leases the feeds it is about to fetch so that concurrent
+-- scrapers never fetch the same feed; an expired lease can be reclaimed.
+ALTER TABLE feeds ADD COLUMN claimed_until TIMESTAMP;
+ALTER TABLE feeds ADD COLUMN claimed_by TEXT;
+
+-- +goose Down
+ALTER TABLE feeds DROP COLUMN claimed_by;
+ALTER TABLE feeds DROP COLUMN claimed_until;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Each feed is polled on its own interval, adapted to how often it posts and
+-- to publisher hints (<ttl>, sy:updatePeriod, skipHours/skipDays).
+ALTER TABLE feeds ADD COLUMN fetch_interval_seconds INTEGER NOT NULL DEFAULT 600;
+ALTER TABLE feeds ADD COLUMN next_fetch_at TIMESTAMP;
+UPDATE feeds SET next_fetch_at = last_fetched_at + INTERVAL '10 minutes' WHERE last_fetched_at IS NOT NULL;
+CREATE INDEX feeds_next_fetch_at_idx ON feeds (next_fetch_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS feeds_next_fetch_at_idx;
+ALTER TABLE feeds DROP COLUMN next_fetch_at;
+ALTER TABLE feeds DROP COLUMN fetch_interval_seconds;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- folder is the OPML outline path a follow was imported under, with nested
+-- folders joined by "/". NULL means top level.
+ALTER TABLE feed_follows ADD COLUMN folder TEXT;
+
+-- +goose Down
+ALTER TABLE feed_follows DROP COLUMN folder;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Starred posts are bookmarks a user keeps; they are never purged by
+-- retention. note is the user's free-text annotation.
+ALTER TABLE user_post_state ADD COLUMN starred BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE user_post_state ADD COLUMN starred_at TIMESTAMP;
+ALTER TABLE user_post_state ADD COLUMN note TEXT;
+CREATE INDEX user_post_state_starred_idx ON user_post_state (user_id, starred_at) WHERE starred;
+
+-- +goose Down
+DROP INDEX IF EXISTS user_post_state_starred_idx;
+ALTER TABLE user_post_state DROP COLUMN note;
+ALTER TABLE user_post_state DROP COLUMN starred_at;
+ALTER TABLE user_post_state DROP COLUMN starred;
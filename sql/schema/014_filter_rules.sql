@@ -0,0 +1,29 @@
+-- +goose Up
+-- Author and categories are kept on posts so filter rules can match them.
+ALTER TABLE posts ADD COLUMN author TEXT;
+ALTER TABLE posts ADD COLUMN categories TEXT[] NOT NULL DEFAULT '{}';
+
+-- Per-user rules that mute, highlight, mark read or star matching posts.
+-- A rule without a feed_id applies to every feed the user follows.
+CREATE TABLE filter_rules (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    feed_id UUID REFERENCES feeds(id) ON DELETE CASCADE,
+    field TEXT NOT NULL CHECK (field IN ('any', 'title', 'description', 'author', 'category')),
+    pattern TEXT NOT NULL,
+    is_regex BOOLEAN NOT NULL DEFAULT FALSE,
+    action TEXT NOT NULL CHECK (action IN ('mute', 'highlight', 'read', 'star'))
+);
+CREATE INDEX filter_rules_user_id_idx ON filter_rules (user_id);
+
+-- Set from the user's filter rules; recomputed by `filter apply`.
+ALTER TABLE user_post_state ADD COLUMN muted BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE user_post_state ADD COLUMN highlighted BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE user_post_state DROP COLUMN highlighted;
+ALTER TABLE user_post_state DROP COLUMN muted;
+DROP TABLE IF EXISTS filter_rules;
+ALTER TABLE posts DROP COLUMN categories;
+ALTER TABLE posts DROP COLUMN author;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Per-feed overrides of the retention policy in the config. NULL uses the
+-- global setting; 0 keeps posts regardless of age or count.
+ALTER TABLE feeds ADD COLUMN retention_days INTEGER CHECK (retention_days >= 0);
+ALTER TABLE feeds ADD COLUMN retention_max_posts INTEGER CHECK (retention_max_posts >= 0);
+
+-- +goose Down
+ALTER TABLE feeds DROP COLUMN retention_max_posts;
+ALTER TABLE feeds DROP COLUMN retention_days;
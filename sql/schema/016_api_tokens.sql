@@ -0,0 +1,14 @@
+-- +goose Up
+-- Bearer tokens for the HTTP API. Only a SHA-256 hash of each token is
+-- stored; the token itself is shown once, when it is created.
+CREATE TABLE api_tokens (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    last_used_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS api_tokens;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- The Fever API identifies feeds and items by integer. seq gives each feed
+-- and post one; post seqs increase as posts are stored, which is what
+-- clients page through with since_id and max_id.
+ALTER TABLE feeds ADD COLUMN seq BIGSERIAL NOT NULL UNIQUE;
+ALTER TABLE posts ADD COLUMN seq BIGSERIAL NOT NULL UNIQUE;
+
+-- Fever clients log in with an API key, the MD5 of "username:password".
+-- Only the key is stored.
+CREATE TABLE fever_credentials (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    api_key TEXT NOT NULL UNIQUE
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS fever_credentials;
+ALTER TABLE posts DROP COLUMN IF EXISTS seq;
+ALTER TABLE feeds DROP COLUMN IF EXISTS seq;
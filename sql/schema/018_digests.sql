@@ -0,0 +1,14 @@
+-- +goose Up
+-- Users who get new posts by email. last_seq is the watermark: the seq of
+-- the newest post already sent, so each digest holds only posts stored
+-- since the one before.
+CREATE TABLE digest_subscriptions (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    email TEXT NOT NULL,
+    last_seq BIGINT NOT NULL DEFAULT 0,
+    last_sent_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS digest_subscriptions;
@@ -0,0 +1,33 @@
+-- +goose Up
+-- Per-user targets that new posts are POSTed to as JSON. A webhook with a
+-- feed_id only fires for that feed, one with a keyword only for posts
+-- mentioning it; either way only for feeds the user follows. When a secret
+-- is set each request is signed with it.
+CREATE TABLE webhooks (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret TEXT,
+    feed_id UUID REFERENCES feeds(id) ON DELETE CASCADE,
+    keyword TEXT
+);
+CREATE INDEX webhooks_user_id_idx ON webhooks (user_id);
+
+-- One row per post sent to a webhook, written once the delivery succeeded
+-- or ran out of attempts.
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    attempts INTEGER NOT NULL,
+    status_code INTEGER,
+    error TEXT,
+    succeeded BOOLEAN NOT NULL
+);
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- Chat notifications of new posts. kind picks the message format: url is a
+-- Slack or Discord incoming webhook, or a Matrix homeserver, in which case
+-- room_id and access_token say where and as whom to post. Like webhooks, a
+-- notifier with a feed_id only fires for that feed.
+CREATE TABLE notifiers (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('slack', 'discord', 'matrix')),
+    url TEXT NOT NULL,
+    room_id TEXT,
+    access_token TEXT,
+    feed_id UUID REFERENCES feeds(id) ON DELETE CASCADE,
+    CHECK (kind <> 'matrix' OR (room_id IS NOT NULL AND access_token IS NOT NULL))
+);
+CREATE INDEX notifiers_user_id_idx ON notifiers (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS notifiers;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- One row per post deleted by retention, so that an item still in the feed
+-- is not stored again as a new unread post the next time it is scraped.
+CREATE TABLE purged_posts (
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    guid TEXT NOT NULL,
+    purged_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (feed_id, guid)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS purged_posts;
@@ -0,0 +1,10 @@
+// Package schema embeds the goose-style SQL migrations in this directory so
+// the gator binary can apply them itself (see internal/migrate).
+package schema
+
+import "embed"
+
+// FS holds the NNN_name.sql migration files.
+//
+//go:embed *.sql
+var FS embed.FS